@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -14,9 +15,31 @@ import (
 )
 
 const (
-	updateURLFormat = "http://%s/update/"
+	updateURLFormat   = "http://%s/update/"
+	updatesURLFormat  = "http://%s/updates/"
+	metadataURLFormat = "http://%s/metadata/"
 )
 
+func NewTransport(cfg *config.Config) (agent.Transport, error) {
+	if cfg == nil {
+		return nil, errors.New("invalid cfg value: nil")
+	}
+
+	if cfg.Agent.Transport == agent.TransportGRPC {
+		if cfg.GRPC == nil || cfg.GRPC.ServerAddress == "" {
+			return nil, errors.New("missing gRPC server address")
+		}
+		return agent.NewGRPCTransport(cfg.GRPC.ServerAddress)
+	}
+
+	return agent.NewHTTPTransport(
+		*cfg.Agent,
+		fmt.Sprintf(updateURLFormat, cfg.HTTP.ServerAddress),
+		fmt.Sprintf(updatesURLFormat, cfg.HTTP.ServerAddress),
+		fmt.Sprintf(metadataURLFormat, cfg.HTTP.ServerAddress),
+	), nil
+}
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -35,10 +58,13 @@ func main() {
 		log.Fatalf("Missing config for agent")
 	}
 
-	agent, err := agent.NewAgent(
-		*cfg.Agent,
-		fmt.Sprintf(updateURLFormat, cfg.HTTP.ServerAddress),
-	)
+	transport, err := NewTransport(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create a transport: %v", err)
+	}
+	defer transport.Close()
+
+	agent, err := agent.NewAgent(*cfg.Agent, transport)
 	if err != nil {
 		log.Fatalf("Failed to create an agent: %v", err)
 	}
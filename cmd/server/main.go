@@ -4,11 +4,17 @@ import (
 	"context"
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os/signal"
+	"sync"
 	"syscall"
 
+	"google.golang.org/grpc"
+
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/config"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ingest/graphite"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ingest/statsd"
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/service/server"
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage"
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/db"
@@ -64,12 +70,83 @@ func main() {
 		Addr:    cfg.HTTP.ServerAddress,
 		Handler: h.Router,
 	}
+	httpServer.RegisterOnShutdown(h.CloseStreams)
+
+	var grpcServer *grpc.Server
+	if cfg.GRPC != nil && cfg.GRPC.ServerAddress != "" {
+		gh, err := server.NewGRPCHandler(s)
+		if err != nil {
+			log.Fatalf("Failed to create a gRPC handler: %v", err)
+		}
+
+		listener, err := net.Listen("tcp", cfg.GRPC.ServerAddress)
+		if err != nil {
+			log.Fatalf("Failed to listen for gRPC: %v", err)
+		}
+
+		grpcServer = server.NewGRPCServer(gh)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Fatalf("Failed to start gRPC server: %v", err)
+			}
+		}()
+	}
+
+	// The ingest listeners push their last batches on shutdown, so the server
+	// is stopped only after they are done.
+	ingestWG := &sync.WaitGroup{}
+	runCtx, stopRun := context.WithCancel(context.Background())
+	defer stopRun()
+
+	if cfg.StatsD != nil && cfg.StatsD.Address != "" {
+		listener, err := statsd.NewListener(*cfg.StatsD, s)
+		if err != nil {
+			log.Fatalf("Failed to create a StatsD listener: %v", err)
+		}
+
+		ingestWG.Add(1)
+		go func() {
+			defer ingestWG.Done()
+			if err := listener.Run(ctx); err != nil {
+				log.Fatalf("Failed in a running StatsD listener: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Graphite != nil && cfg.Graphite.Address != "" {
+		listener, err := graphite.NewListener(*cfg.Graphite, s)
+		if err != nil {
+			log.Fatalf("Failed to create a Graphite listener: %v", err)
+		}
+
+		ingestWG.Add(1)
+		go func() {
+			defer ingestWG.Done()
+			if err := listener.Run(ctx); err != nil {
+				log.Fatalf("Failed in a running Graphite listener: %v", err)
+			}
+		}()
+	}
 
 	go func() {
-		if err := s.Run(ctx); err != nil {
+		<-ctx.Done()
+		ingestWG.Wait()
+		stopRun()
+	}()
+
+	go func() {
+		if err := s.Run(runCtx); err != nil {
 			log.Fatalf("Failed in a running server: %v", err)
 		}
-		if err := httpServer.Shutdown(ctx); err != nil {
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+
+		// ctx is done by now, so the open streams get their own time to end.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
 			log.Fatalf("HTTP Server failed: %v", err)
 		}
 	}()
@@ -6,6 +6,8 @@ import (
 
 	"github.com/caarlos0/env/v6"
 
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ingest/graphite"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ingest/statsd"
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/service/agent"
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/service/server"
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/db"
@@ -14,15 +16,19 @@ import (
 
 type Config struct {
 	HTTP      *HTTPConfig
+	GRPC      *GRPCConfig
 	Server    *server.Config
 	StoreFile *file.Config
 	Agent     *agent.Config
 	DB        *db.Config
+	StatsD    *statsd.Config
+	Graphite  *graphite.Config
 }
 
 func LoadAgentConfig() *Config {
 	conf := &Config{
 		HTTP:  NewHTTPConfig(),
+		GRPC:  NewGRPCConfig(),
 		Agent: NewAgentConfig(),
 	}
 
@@ -32,6 +38,10 @@ func LoadAgentConfig() *Config {
 		log.Fatalf("Failed to parse http config options: %v", err)
 	}
 
+	if err := env.Parse(conf.GRPC); err != nil {
+		log.Fatalf("Failed to parse grpc config options: %v", err)
+	}
+
 	if err := env.Parse(conf.Agent); err != nil {
 		log.Fatalf("Failed to parse agent config options: %v", err)
 	}
@@ -42,9 +52,12 @@ func LoadAgentConfig() *Config {
 func LoadServerConfig() *Config {
 	conf := &Config{
 		HTTP:      NewHTTPConfig(),
+		GRPC:      NewGRPCConfig(),
 		Server:    NewServerConfig(),
 		StoreFile: NewStoreFileConfig(),
 		DB:        NewDBConfig(),
+		StatsD:    NewStatsDConfig(),
+		Graphite:  NewGraphiteConfig(),
 	}
 
 	flag.Parse()
@@ -53,6 +66,10 @@ func LoadServerConfig() *Config {
 		log.Fatalf("Failed to parse http config options: %v", err)
 	}
 
+	if err := env.Parse(conf.GRPC); err != nil {
+		log.Fatalf("Failed to parse grpc config options: %v", err)
+	}
+
 	if err := env.Parse(conf.Server); err != nil {
 		log.Fatalf("Failed to parse server config options: %v", err)
 	}
@@ -65,5 +82,13 @@ func LoadServerConfig() *Config {
 		log.Fatalf("Failed to parse DB config options: %v", err)
 	}
 
+	if err := env.Parse(conf.StatsD); err != nil {
+		log.Fatalf("Failed to parse StatsD config options: %v", err)
+	}
+
+	if err := env.Parse(conf.Graphite); err != nil {
+		log.Fatalf("Failed to parse Graphite config options: %v", err)
+	}
+
 	return conf
 }
@@ -15,11 +15,28 @@ func NewAgentConfig() *agent.Config {
 		RetryMaxWaitTime:    agent.DefaultRetryMaxWaitTime,
 		PollMetricsBuffSize: agent.DefaultPollMetricsBuffSize,
 		PostWorkersPoolSize: agent.DefaultPostWorkersPoolSize,
+		OutboxMaxSize:       agent.DefaultOutboxMaxSize,
+		Collectors:          agent.DefaultCollectors,
+		NetExclude:          agent.DefaultNetExclude,
 	}
 
 	flag.DurationVar(&cfg.ReportInterval, "r", agent.DefaultReportInterval, "REPORT_INTERVAL")
 	flag.DurationVar(&cfg.PollInterval, "p", agent.DefaultPollInterval, "POLL_INTERVAL")
 	flag.StringVar(&cfg.Key, "k", "", "KEY")
+	flag.BoolVar(&cfg.SendTimestamps, "send-timestamps", false, "SEND_TIMESTAMPS")
+	flag.StringVar((*string)(&cfg.ReportMode), "report-mode", string(agent.DefaultReportMode), "REPORT_MODE")
+	flag.StringVar((*string)(&cfg.Transport), "transport", string(agent.DefaultTransport), "TRANSPORT")
+	flag.IntVar(&cfg.WindowMaxSize, "window-max-size", agent.DefaultWindowMaxSize, "WINDOW_MAX_SIZE")
+	flag.StringVar(&cfg.OutboxFile, "outbox-file", "", "OUTBOX_FILE")
+	flag.StringVar((*string)(&cfg.OutboxDropPolicy), "outbox-drop-policy", string(agent.DefaultOutboxDropPolicy), "OUTBOX_DROP_POLICY")
+	flag.Var(&cfg.Collectors, "collectors", "COLLECTORS")
+	flag.Var(&cfg.CollectorIntervals, "collector-intervals", "COLLECTOR_INTERVALS")
+	flag.Var(&cfg.DiskInclude, "disk-include", "DISK_INCLUDE")
+	flag.Var(&cfg.DiskExclude, "disk-exclude", "DISK_EXCLUDE")
+	flag.Var(&cfg.NetInclude, "net-include", "NET_INCLUDE")
+	flag.Var(&cfg.NetExclude, "net-exclude", "NET_EXCLUDE")
+	flag.Var(&cfg.GaugeAggregations, "gauge-aggregations", "GAUGE_AGGREGATIONS")
+	flag.StringVar(&cfg.CgroupRoot, "cgroup-root", agent.DefaultCgroupRoot, "CGROUP_ROOT")
 
 	return &cfg
 }
@@ -15,5 +15,6 @@ func NewDBConfig() *db.Config {
 		MigrationsURL: DefaultMigrationsURL,
 	}
 	flag.StringVar(&cfg.DSN, "d", "", "DATABASE_DSN")
+	flag.DurationVar(&cfg.HistoryRetention, "history-retention", db.DefaultHistoryRetention, "HISTORY_RETENTION")
 	return cfg
 }
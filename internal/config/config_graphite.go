@@ -0,0 +1,21 @@
+package config
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ingest/graphite"
+)
+
+func NewGraphiteConfig() *graphite.Config {
+	cfg := graphite.Config{}
+	flag.StringVar(&cfg.Address, "graphite-address", "", "GRAPHITE_ADDRESS")
+	flag.Func("graphite-counter-patterns", "GRAPHITE_COUNTER_PATTERNS", func(s string) error {
+		cfg.CounterPatterns = strings.Split(s, ",")
+		return nil
+	})
+	flag.IntVar(&cfg.BatchSize, "graphite-batch-size", graphite.DefaultBatchSize, "GRAPHITE_BATCH_SIZE")
+	flag.DurationVar(&cfg.FlushInterval, "graphite-flush-interval", graphite.DefaultFlushInterval, "GRAPHITE_FLUSH_INTERVAL")
+	flag.DurationVar(&cfg.IdleTimeout, "graphite-idle-timeout", graphite.DefaultIdleTimeout, "GRAPHITE_IDLE_TIMEOUT")
+	return &cfg
+}
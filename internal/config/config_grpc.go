@@ -0,0 +1,17 @@
+package config
+
+import (
+	"flag"
+)
+
+type GRPCConfig struct {
+	// ServerAddress is the gRPC API address. The server doesn't serve gRPC
+	// when it is empty.
+	ServerAddress string `env:"GRPC_ADDRESS"`
+}
+
+func NewGRPCConfig() *GRPCConfig {
+	cfg := GRPCConfig{}
+	flag.StringVar(&cfg.ServerAddress, "grpc-address", "", "GRPC_ADDRESS")
+	return &cfg
+}
@@ -2,7 +2,12 @@ package config
 
 import (
 	"flag"
+	"strings"
 
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ingest/influx"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ingest/otlp"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/pubsub"
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/service/server"
 )
 
@@ -12,5 +17,19 @@ func NewServerConfig() *server.Config {
 	}
 	flag.DurationVar(&cfg.StoreInterval, "i", server.DefaultStoreInterval, "STORE_INTERVAL")
 	flag.StringVar(&cfg.Key, "k", "", "KEY")
+	flag.DurationVar(&cfg.MaxTimestampSkew, "max-timestamp-skew", server.DefaultMaxTimestampSkew, "MAX_TIMESTAMP_SKEW")
+	flag.IntVar(&cfg.StreamBufferSize, "stream-buffer-size", pubsub.DefaultBufferSize, "STREAM_BUFFER_SIZE")
+	flag.StringVar((*string)(&cfg.StreamDropPolicy), "stream-drop-policy", string(pubsub.DefaultDropPolicy), "STREAM_DROP_POLICY")
+	flag.StringVar(&cfg.NamePattern, "name-pattern", model.DefaultNamePattern, "NAME_PATTERN")
+	flag.IntVar(&cfg.NameMaxLength, "name-max-length", model.DefaultNameMaxLength, "NAME_MAX_LENGTH")
+	flag.StringVar(&cfg.NameReservedPrefix, "name-reserved-prefix", "", "NAME_RESERVED_PREFIX")
+	flag.StringVar((*string)(&cfg.NameCase), "name-case", string(model.NameCasePreserve), "NAME_CASE")
+	flag.StringVar(&cfg.NameSeparator, "name-separator", "", "NAME_SEPARATOR")
+	flag.Func("influx-integer-counters", "INFLUX_INTEGER_COUNTERS", func(s string) error {
+		cfg.InfluxIntegerCounters = strings.Split(s, ",")
+		return nil
+	})
+	flag.DurationVar(&cfg.InfluxSeriesTTL, "influx-series-ttl", influx.DefaultSeriesTTL, "INFLUX_SERIES_TTL")
+	flag.DurationVar(&cfg.OTLPSeriesTTL, "otlp-series-ttl", otlp.DefaultSeriesTTL, "OTLP_SERIES_TTL")
 	return &cfg
 }
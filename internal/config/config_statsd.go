@@ -0,0 +1,17 @@
+package config
+
+import (
+	"flag"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ingest/statsd"
+)
+
+func NewStatsDConfig() *statsd.Config {
+	cfg := statsd.Config{
+		QueueSize: statsd.DefaultQueueSize,
+	}
+	flag.StringVar(&cfg.Address, "statsd-address", "", "STATSD_ADDRESS")
+	flag.IntVar(&cfg.BatchSize, "statsd-batch-size", statsd.DefaultBatchSize, "STATSD_BATCH_SIZE")
+	flag.DurationVar(&cfg.FlushInterval, "statsd-flush-interval", statsd.DefaultFlushInterval, "STATSD_FLUSH_INTERVAL")
+	return &cfg
+}
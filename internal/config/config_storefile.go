@@ -2,18 +2,26 @@ package config
 
 import (
 	"flag"
+	"time"
 
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/file"
 )
 
 const (
-	DefaultInitStore = true
-	DefaultStoreFile = "/tmp/devops-metrics-db.json"
+	DefaultInitStore       = true
+	DefaultStoreFile       = "/tmp/devops-metrics-db.json"
+	DefaultStoreBackups    = 2
+	DefaultWALSyncPolicy   = file.WALSyncInterval
+	DefaultWALSyncInterval = 1 * time.Second
 )
 
 func NewStoreFileConfig() *file.Config {
 	cfg := file.Config{}
 	flag.BoolVar(&cfg.InitStore, "r", DefaultInitStore, "RESTORE")
 	flag.StringVar(&cfg.StoreFile, "f", DefaultStoreFile, "STORE_FILE")
+	flag.IntVar(&cfg.StoreBackups, "store-backups", DefaultStoreBackups, "STORE_BACKUPS")
+	flag.StringVar(&cfg.WALFile, "wal-file", "", "WAL_FILE")
+	flag.StringVar((*string)(&cfg.WALSyncPolicy), "wal-sync-policy", string(DefaultWALSyncPolicy), "WAL_SYNC_POLICY")
+	flag.DurationVar(&cfg.WALSyncInterval, "wal-sync-interval", DefaultWALSyncInterval, "WAL_SYNC_INTERVAL")
 	return &cfg
 }
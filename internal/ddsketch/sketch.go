@@ -0,0 +1,282 @@
+// Package ddsketch implements DDSketch, a mergeable quantile sketch with
+// relative-error guarantees: a quantile is estimated within
+// RelativeAccuracy of the value of the matching rank.
+//
+// See "DDSketch: A Fast and Fully-Mergeable Quantile Sketch with
+// Relative-Error Guarantees" by C. Masson, J. E. Rim and H. K. Lee.
+package ddsketch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	DefaultRelativeAccuracy = 0.01
+	// MaxBins limits the bins kept for each sign. Once reached, the bins of
+	// the values closest to zero are collapsed, so only the accuracy of the
+	// lowest quantiles of the magnitudes degrades.
+	MaxBins = 2048
+	// maxOffset bounds the bin indexes, far beyond the ones of finite
+	// values, so that the index arithmetic never overflows.
+	maxOffset = 1 << 30
+)
+
+var (
+	ErrAccuracyMismatch = errors.New("sketch relative accuracy mismatch")
+	ErrEmpty            = errors.New("sketch is empty")
+)
+
+// Sketch counts values into logarithmically sized bins: a positive value v
+// falls into the bin ceil(log_gamma(v)), where
+// gamma = (1 + RelativeAccuracy) / (1 - RelativeAccuracy). Negative values
+// are binned by their magnitude and zeros are counted separately.
+type Sketch struct {
+	RelativeAccuracy float64 `json:"relativeAccuracy"`
+	Positive         Bins    `json:"positive"`
+	Negative         Bins    `json:"negative"`
+	ZeroCount        uint64  `json:"zeroCount"`
+	Count            uint64  `json:"count"`
+	Sum              float64 `json:"sum"`
+	Min              float64 `json:"min"`
+	Max              float64 `json:"max"`
+}
+
+// Bins are contiguous: Counts[i] is the count of the bin Offset+i.
+type Bins struct {
+	Offset int      `json:"offset"`
+	Counts []uint64 `json:"counts"`
+}
+
+func NewSketch(relativeAccuracy float64) (*Sketch, error) {
+	s := &Sketch{RelativeAccuracy: relativeAccuracy}
+	if err := s.validateAccuracy(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Sketch) validateAccuracy() error {
+	if !(s.RelativeAccuracy > 0 && s.RelativeAccuracy < 1) {
+		return fmt.Errorf("invalid RelativeAccuracy=%v, must be in (0, 1)", s.RelativeAccuracy)
+	}
+	return nil
+}
+
+func (s *Sketch) Validate() error {
+	if err := s.validateAccuracy(); err != nil {
+		return err
+	}
+
+	count := s.ZeroCount
+	for _, bins := range []Bins{s.Positive, s.Negative} {
+		if len(bins.Counts) > MaxBins {
+			return fmt.Errorf("invalid number of bins: %d, at most %d", len(bins.Counts), MaxBins)
+		}
+		if bins.Offset < -maxOffset || bins.Offset > maxOffset {
+			return fmt.Errorf("invalid bins offset: %d", bins.Offset)
+		}
+		for _, c := range bins.Counts {
+			count += c
+		}
+	}
+	if count != s.Count {
+		return fmt.Errorf("invalid sketch count: %d, bins sum up to %d", s.Count, count)
+	}
+
+	for _, v := range []float64{s.Sum, s.Min, s.Max} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("invalid sketch statistic: %v", v)
+		}
+	}
+	if s.Count > 0 && s.Min > s.Max {
+		return fmt.Errorf("invalid sketch range: min %v is greater than max %v", s.Min, s.Max)
+	}
+
+	return nil
+}
+
+func (s *Sketch) gamma() float64 {
+	return (1 + s.RelativeAccuracy) / (1 - s.RelativeAccuracy)
+}
+
+func (s *Sketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+// value is the estimate of the values in the bin, within RelativeAccuracy
+// of any of them.
+func (s *Sketch) value(index int) float64 {
+	gamma := s.gamma()
+	return 2 * math.Pow(gamma, float64(index)) / (gamma + 1)
+}
+
+// Add counts a finite value.
+func (s *Sketch) Add(v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("invalid value: %v", v)
+	}
+
+	switch {
+	case v > 0:
+		s.Positive.add(s.index(v), 1)
+	case v < 0:
+		s.Negative.add(s.index(-v), 1)
+	default:
+		s.ZeroCount++
+	}
+
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+
+	return nil
+}
+
+// Merge adds the values of another sketch with the same accuracy.
+func (s *Sketch) Merge(other Sketch) error {
+	if s.RelativeAccuracy != other.RelativeAccuracy {
+		return ErrAccuracyMismatch
+	}
+
+	if other.Count == 0 {
+		return nil
+	}
+
+	s.Positive.merge(other.Positive)
+	s.Negative.merge(other.Negative)
+	s.ZeroCount += other.ZeroCount
+
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Count += other.Count
+	s.Sum += other.Sum
+
+	return nil
+}
+
+// Quantile estimates the value at the rank q*(Count-1), q in [0, 1].
+func (s *Sketch) Quantile(q float64) (float64, error) {
+	if !(q >= 0 && q <= 1) {
+		return 0, fmt.Errorf("invalid quantile: %v, must be in [0, 1]", q)
+	}
+
+	if s.Count == 0 {
+		return 0, ErrEmpty
+	}
+
+	rank := uint64(q * float64(s.Count-1))
+	v := s.valueAt(rank)
+
+	// The extremes are known exactly and bound the estimates.
+	return math.Max(s.Min, math.Min(s.Max, v)), nil
+}
+
+// valueAt walks the bins from the lowest value: the negative bins from the
+// largest magnitude, the zeros, then the positive bins.
+func (s *Sketch) valueAt(rank uint64) float64 {
+	n := uint64(0)
+
+	for i := len(s.Negative.Counts) - 1; i >= 0; i-- {
+		n += s.Negative.Counts[i]
+		if n > rank {
+			return -s.value(s.Negative.Offset + i)
+		}
+	}
+
+	n += s.ZeroCount
+	if n > rank {
+		return 0
+	}
+
+	for i, c := range s.Positive.Counts {
+		n += c
+		if n > rank {
+			return s.value(s.Positive.Offset + i)
+		}
+	}
+
+	return s.Max
+}
+
+// Clone returns a sketch that doesn't share the bins with s.
+func (s Sketch) Clone() Sketch {
+	s.Positive.Counts = append([]uint64(nil), s.Positive.Counts...)
+	s.Negative.Counts = append([]uint64(nil), s.Negative.Counts...)
+	return s
+}
+
+// add counts values into a bin, growing the bins as needed. The bins below
+// the MaxBins highest ones are collapsed into the lowest kept one.
+func (b *Bins) add(index int, count uint64) {
+	if count == 0 {
+		return
+	}
+
+	if len(b.Counts) == 0 {
+		b.Offset = index
+		b.Counts = []uint64{count}
+		return
+	}
+
+	last := b.Offset + len(b.Counts) - 1
+
+	switch {
+	case index > last:
+		low := b.Offset
+		if index-MaxBins+1 > low {
+			low = index - MaxBins + 1
+		}
+		b.resize(low, index)
+	case index < b.Offset:
+		low := index
+		if last-MaxBins+1 > low {
+			low = last - MaxBins + 1
+		}
+		b.resize(low, last)
+		if index < low {
+			index = low
+		}
+	}
+
+	b.Counts[index-b.Offset] += count
+}
+
+func (b *Bins) merge(other Bins) {
+	n := len(other.Counts)
+	if n == 0 {
+		return
+	}
+
+	// The highest bin goes first, so that the bins are resized at most twice.
+	b.add(other.Offset+n-1, other.Counts[n-1])
+	for i := 0; i < n-1; i++ {
+		b.add(other.Offset+i, other.Counts[i])
+	}
+}
+
+// resize lays the bins out over [low, high], collapsing the bins below low
+// into it.
+func (b *Bins) resize(low, high int) {
+	counts := make([]uint64, high-low+1)
+	for i, c := range b.Counts {
+		j := b.Offset + i - low
+		if j < 0 {
+			j = 0
+		}
+		counts[j] += c
+	}
+
+	b.Offset = low
+	b.Counts = counts
+}
@@ -0,0 +1,116 @@
+package ddsketch
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSketch(t *testing.T, values ...float64) *Sketch {
+	s, err := NewSketch(DefaultRelativeAccuracy)
+	require.NoError(t, err)
+
+	for _, v := range values {
+		require.NoError(t, s.Add(v))
+	}
+	require.NoError(t, s.Validate())
+
+	return s
+}
+
+// exactQuantile returns the value at the same rank as Sketch.Quantile.
+func exactQuantile(sorted []float64, q float64) float64 {
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+func TestSketch_Quantile(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	values := make([]float64, 0, 10000)
+	for i := 0; i < cap(values); i++ {
+		// Latencies spanning several orders of magnitude, some negative.
+		values = append(values, math.Exp(rnd.NormFloat64()*3)*float64(1-2*rnd.Intn(2)))
+	}
+	values = append(values, 0, 0)
+
+	s := newTestSketch(t, values...)
+	sort.Float64s(values)
+
+	for _, q := range []float64{0, 0.01, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999, 1} {
+		got, err := s.Quantile(q)
+		require.NoError(t, err)
+
+		want := exactQuantile(values, q)
+		assert.InDelta(t, want, got, math.Abs(want)*DefaultRelativeAccuracy+1e-12, "q=%v", q)
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a := newTestSketch(t, 1, 2, 3)
+	b := newTestSketch(t, 100, 200, -5)
+
+	merged := a.Clone()
+	require.NoError(t, merged.Merge(*b))
+	require.NoError(t, merged.Validate())
+
+	want := newTestSketch(t, 1, 2, 3, 100, 200, -5)
+	assert.Equal(t, want.Count, merged.Count)
+	assert.Equal(t, want.Min, merged.Min)
+	assert.Equal(t, want.Max, merged.Max)
+	assert.Equal(t, want.Sum, merged.Sum)
+
+	for _, q := range []float64{0, 0.5, 1} {
+		got, err := merged.Quantile(q)
+		require.NoError(t, err)
+		expected, err := want.Quantile(q)
+		require.NoError(t, err)
+		assert.Equal(t, expected, got)
+	}
+
+	// The merged sketch doesn't share bins with a.
+	assert.Equal(t, uint64(3), a.Count)
+	assert.Len(t, a.Negative.Counts, 0)
+
+	other, err := NewSketch(0.05)
+	require.NoError(t, err)
+	assert.ErrorIs(t, merged.Merge(*other), ErrAccuracyMismatch)
+}
+
+func TestSketch_Collapse(t *testing.T) {
+	s := newTestSketch(t, 1e-300, 1e3, 1e5)
+	assert.Len(t, s.Positive.Counts, MaxBins)
+
+	// Only the lowest magnitudes lose accuracy.
+	q, err := s.Quantile(0.5)
+	require.NoError(t, err)
+	assert.InDelta(t, 1e3, q, 1e3*DefaultRelativeAccuracy)
+
+	q, err = s.Quantile(1)
+	require.NoError(t, err)
+	assert.InDelta(t, 1e5, q, 1e5*DefaultRelativeAccuracy)
+}
+
+func TestSketch_Errors(t *testing.T) {
+	_, err := NewSketch(0)
+	assert.Error(t, err)
+
+	_, err = NewSketch(1)
+	assert.Error(t, err)
+
+	s := newTestSketch(t)
+	_, err = s.Quantile(0.5)
+	assert.ErrorIs(t, err, ErrEmpty)
+
+	assert.Error(t, s.Add(math.NaN()))
+
+	s = newTestSketch(t, 1)
+	_, err = s.Quantile(1.5)
+	assert.Error(t, err)
+
+	s.Count = 2
+	assert.Error(t, s.Validate())
+}
@@ -0,0 +1,278 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 1 * time.Second
+	DefaultIdleTimeout   = 1 * time.Minute
+
+	maxLineSize = 64 * 1024
+)
+
+type Config struct {
+	// Address is the TCP address to listen on. The listener is disabled
+	// when it is empty.
+	Address         string        `env:"GRAPHITE_ADDRESS"`
+	CounterPatterns []string      `env:"GRAPHITE_COUNTER_PATTERNS" envSeparator:","`
+	BatchSize       int           `env:"GRAPHITE_BATCH_SIZE"`
+	FlushInterval   time.Duration `env:"GRAPHITE_FLUSH_INTERVAL"`
+	IdleTimeout     time.Duration `env:"GRAPHITE_IDLE_TIMEOUT"`
+}
+
+func (c Config) Validate() error {
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("invalid non-positive BatchSize=%v", c.BatchSize)
+	}
+	if c.FlushInterval <= 0 {
+		return fmt.Errorf("invalid non-positive FlushInterval=%v", c.FlushInterval)
+	}
+	if c.IdleTimeout <= 0 {
+		return fmt.Errorf("invalid non-positive IdleTimeout=%v", c.IdleTimeout)
+	}
+	return nil
+}
+
+// MetricPusher stores the metrics of the listener. AcceptMetric returns the
+// metric as it is to be pushed, or an error if it would fail the whole push,
+// e.g. because of its name.
+type MetricPusher interface {
+	AcceptMetric(metric model.Metric) (model.Metric, error)
+	PushMetricList(ctx context.Context, metrics []model.Metric) error
+}
+
+type Stats struct {
+	Received    uint64
+	ParseErrors uint64
+	Dropped     uint64
+}
+
+// Listener accepts Graphite plaintext connections. Every connection batches
+// its metrics, pushing a batch when it is full, every FlushInterval and when
+// the connection is closed. Connections idle for IdleTimeout are closed.
+type Listener struct {
+	config Config
+	parser *Parser
+	pusher MetricPusher
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+
+	received    uint64
+	parseErrors uint64
+	dropped     uint64
+}
+
+func NewListener(config Config, pusher MetricPusher) (*Listener, error) {
+	if pusher == nil {
+		return nil, errors.New("invalid pusher value: nil")
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	parser, err := NewParser(config.CounterPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Listener{
+		config: config,
+		parser: parser,
+		pusher: pusher,
+		conns:  make(map[net.Conn]struct{}),
+	}, nil
+}
+
+func (l *Listener) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", l.config.Address)
+	if err != nil {
+		return err
+	}
+
+	return l.Serve(ctx, ln)
+}
+
+// Serve accepts connections until ctx is done. Then it closes all the
+// connections and returns once their last batches are pushed.
+func (l *Listener) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+		l.closeConns()
+	}()
+
+	defer l.wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if !l.trackConn(conn) {
+			conn.Close()
+			return nil
+		}
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			defer l.untrackConn(conn)
+			l.handleConn(ctx, conn)
+		}()
+	}
+}
+
+func (l *Listener) Stats() Stats {
+	return Stats{
+		Received:    atomic.LoadUint64(&l.received),
+		ParseErrors: atomic.LoadUint64(&l.parseErrors),
+		Dropped:     atomic.LoadUint64(&l.dropped),
+	}
+}
+
+// trackConn returns false once the listener is closed.
+func (l *Listener) trackConn(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conns == nil {
+		return false
+	}
+	l.conns[conn] = struct{}{}
+
+	return true
+}
+
+func (l *Listener) untrackConn(conn net.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conns != nil {
+		delete(l.conns, conn)
+	}
+	conn.Close()
+}
+
+func (l *Listener) closeConns() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.conns = nil
+}
+
+// idleReader closes idle connections: every read must complete within the
+// idle timeout.
+type idleReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r idleReader) Read(p []byte) (int, error) {
+	if err := r.conn.SetReadDeadline(time.Now().Add(r.timeout)); err != nil {
+		return 0, err
+	}
+	return r.conn.Read(p)
+}
+
+type connBatch struct {
+	sync.Mutex
+	metrics []model.Metric
+}
+
+func (l *Listener) handleConn(ctx context.Context, conn net.Conn) {
+	batch := &connBatch{}
+
+	done := make(chan struct{})
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+
+		ticker := time.NewTicker(l.config.FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				l.flush(ctx, batch)
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(idleReader{conn: conn, timeout: l.config.IdleTimeout})
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		atomic.AddUint64(&l.received, 1)
+
+		// Metrics rejected by the pusher count as parse errors, so that they
+		// don't fail the rest of the batch.
+		metric, err := l.parser.ParseLine(line)
+		if err == nil {
+			metric, err = l.pusher.AcceptMetric(metric)
+		}
+		if err != nil {
+			atomic.AddUint64(&l.parseErrors, 1)
+			continue
+		}
+
+		batch.Lock()
+		batch.metrics = append(batch.metrics, metric)
+		full := len(batch.metrics) >= l.config.BatchSize
+		batch.Unlock()
+
+		if full {
+			l.flush(ctx, batch)
+		}
+	}
+
+	close(done)
+	<-flushed
+
+	// The connection is closed, possibly because of a shutdown, so the last
+	// batch is pushed regardless of ctx.
+	l.flush(context.Background(), batch)
+}
+
+func (l *Listener) flush(ctx context.Context, batch *connBatch) {
+	batch.Lock()
+	metrics := batch.metrics
+	batch.metrics = nil
+	batch.Unlock()
+
+	if len(metrics) == 0 {
+		return
+	}
+
+	if err := l.pusher.PushMetricList(ctx, metrics); err != nil {
+		log.Printf("Failed to push Graphite metrics: %v", err)
+		atomic.AddUint64(&l.dropped, uint64(len(metrics)))
+	}
+}
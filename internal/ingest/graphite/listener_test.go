@@ -0,0 +1,155 @@
+package graphite
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+type testPusher struct {
+	sync.Mutex
+	batches [][]model.Metric
+}
+
+// AcceptMetric rejects the metrics named "rejected".
+func (p *testPusher) AcceptMetric(metric model.Metric) (model.Metric, error) {
+	if metric.ID == "rejected" {
+		return model.Metric{}, &model.NameError{ID: metric.ID, Reason: "rejected"}
+	}
+	return metric, nil
+}
+
+func (p *testPusher) PushMetricList(ctx context.Context, metrics []model.Metric) error {
+	p.Lock()
+	defer p.Unlock()
+
+	p.batches = append(p.batches, metrics)
+	return nil
+}
+
+func (p *testPusher) metrics() []model.Metric {
+	p.Lock()
+	defer p.Unlock()
+
+	var metrics []model.Metric
+	for _, batch := range p.batches {
+		metrics = append(metrics, batch...)
+	}
+	return metrics
+}
+
+func serve(t *testing.T, config Config, pusher MetricPusher) (*Listener, string, context.CancelFunc, chan error) {
+	l, err := NewListener(config, pusher)
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.Serve(ctx, ln)
+	}()
+
+	return l, ln.Addr().String(), cancel, done
+}
+
+func TestListener(t *testing.T) {
+	pusher := &testPusher{}
+	l, addr, cancel, done := serve(t, Config{
+		CounterPatterns: []string{"*.requests"},
+		BatchSize:       2,
+		FlushInterval:   1 * time.Hour,
+		IdleTimeout:     1 * time.Hour,
+	}, pusher)
+
+	client, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Write([]byte("a.requests 1 1650000000\na.cpu 0.5 1650000000\nrejected 1 1650000000\ninvalid\na.requests 2 1650000000\n"))
+	require.NoError(t, err)
+
+	// The first batch is pushed as soon as it is full.
+	require.Eventually(t, func() bool {
+		return len(pusher.metrics()) == 2
+	}, 1*time.Second, 10*time.Millisecond)
+
+	// The rest is pushed when the connection is closed on shutdown.
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Equal(t, []model.Metric{
+		withTimestamp(model.MetricFromCounter("a.requests", model.Counter(1)), 1650000000000),
+		withTimestamp(model.MetricFromGauge("a.cpu", model.Gauge(0.5)), 1650000000000),
+		withTimestamp(model.MetricFromCounter("a.requests", model.Counter(2)), 1650000000000),
+	}, pusher.metrics())
+	assert.Equal(t, Stats{Received: 5, ParseErrors: 2}, l.Stats())
+}
+
+func TestListenerFlushInterval(t *testing.T) {
+	pusher := &testPusher{}
+	_, addr, cancel, done := serve(t, Config{
+		BatchSize:     100,
+		FlushInterval: 10 * time.Millisecond,
+		IdleTimeout:   1 * time.Hour,
+	}, pusher)
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	client, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Write([]byte("a.cpu 0.5\n"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(pusher.metrics()) == 1
+	}, 1*time.Second, 10*time.Millisecond)
+}
+
+func TestListenerIdleTimeout(t *testing.T) {
+	pusher := &testPusher{}
+	_, addr, cancel, done := serve(t, Config{
+		BatchSize:     100,
+		FlushInterval: 1 * time.Hour,
+		IdleTimeout:   50 * time.Millisecond,
+	}, pusher)
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	client, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Write([]byte("a.cpu 0.5\n"))
+	require.NoError(t, err)
+
+	// The idle connection is closed by the listener, pushing its batch.
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(1*time.Second)))
+	_, err = client.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	require.Eventually(t, func() bool {
+		return len(pusher.metrics()) == 1
+	}, 1*time.Second, 10*time.Millisecond)
+}
+
+func TestNewListenerInvalidConfig(t *testing.T) {
+	_, err := NewListener(Config{FlushInterval: time.Second, IdleTimeout: time.Second}, &testPusher{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,124 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+// Parser converts Graphite plaintext lines, "path value [timestamp]", into
+// metrics. Paths matching one of the counter patterns become counters and
+// all other paths become gauges. Graphite tags, "path;tag=value", become
+// labels. The timestamp, in seconds, becomes the metric timestamp; a
+// non-positive one, e.g. the -1 some clients send for "now", is left out.
+type Parser struct {
+	counterPatterns []string
+}
+
+// NewParser validates the counter patterns. A pattern is a glob matched
+// against whole path segments, e.g. "servers.*.requests" matches
+// "servers.a.requests" but not "servers.a.b.requests".
+func NewParser(counterPatterns []string) (*Parser, error) {
+	patterns := make([]string, 0, len(counterPatterns))
+	for _, pattern := range counterPatterns {
+		pattern = segmentsToSlashes(pattern)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid counter pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return &Parser{counterPatterns: patterns}, nil
+}
+
+func segmentsToSlashes(s string) string {
+	return strings.ReplaceAll(s, ".", "/")
+}
+
+func (p *Parser) isCounter(name string) bool {
+	name = segmentsToSlashes(name)
+	for _, pattern := range p.counterPatterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Parser) ParseLine(line string) (model.Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return model.Metric{}, fmt.Errorf("invalid line %q: expected path, value and timestamp", line)
+	}
+
+	var timestamp int64
+	if len(fields) == 3 {
+		seconds, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return model.Metric{}, fmt.Errorf("invalid timestamp %q", fields[2])
+		}
+		if seconds > 0 {
+			timestamp = int64(math.Round(seconds * 1000))
+		}
+	}
+
+	name, labels, err := parsePath(fields[0])
+	if err != nil {
+		return model.Metric{}, err
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("invalid value %q", fields[1])
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return model.Metric{}, fmt.Errorf("invalid value %q", fields[1])
+	}
+
+	var metric model.Metric
+	if p.isCounter(name) {
+		metric = model.MetricFromCounter(name, model.Counter(math.Round(value)))
+	} else {
+		metric = model.MetricFromGauge(name, model.Gauge(value))
+	}
+	metric.Labels = labels
+	metric.Timestamp = timestamp
+
+	if err := metric.Validate(); err != nil {
+		return model.Metric{}, err
+	}
+
+	return metric, nil
+}
+
+func parsePath(s string) (string, model.Labels, error) {
+	parts := strings.Split(s, ";")
+	if parts[0] == "" {
+		return "", nil, errors.New("missing metric path")
+	}
+
+	if len(parts) == 1 {
+		return parts[0], nil, nil
+	}
+
+	labels := make(model.Labels, len(parts)-1)
+	for _, tag := range parts[1:] {
+		i := strings.IndexByte(tag, '=')
+		if i < 0 {
+			return "", nil, fmt.Errorf("invalid tag %q: missing '='", tag)
+		}
+
+		name, value := tag[:i], tag[i+1:]
+		if _, ok := labels[name]; ok {
+			return "", nil, fmt.Errorf("duplicate tag name: %s", name)
+		}
+		labels[name] = value
+	}
+
+	return parts[0], labels, nil
+}
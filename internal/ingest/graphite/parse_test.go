@@ -0,0 +1,125 @@
+package graphite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func withTimestamp(metric model.Metric, timestamp int64) model.Metric {
+	metric.Timestamp = timestamp
+	return metric
+}
+
+func TestParseLine(t *testing.T) {
+	tagged := model.MetricFromGauge("servers.a.cpu", model.Gauge(0.5))
+	tagged.Labels = model.Labels{"dc": "east", "rack": "1"}
+	tagged.Timestamp = 1650000000000
+
+	tests := []struct {
+		name    string
+		line    string
+		want    model.Metric
+		wantErr bool
+	}{
+		{
+			name: "Gauge",
+			line: "servers.a.cpu 0.5 1650000000",
+			want: withTimestamp(model.MetricFromGauge("servers.a.cpu", model.Gauge(0.5)), 1650000000000),
+		},
+		{
+			name: "Fractional timestamp",
+			line: "servers.a.cpu 0.5 1650000000.25",
+			want: withTimestamp(model.MetricFromGauge("servers.a.cpu", model.Gauge(0.5)), 1650000000250),
+		},
+		{
+			name: "Timestamp meaning now",
+			line: "servers.a.cpu 0.5 -1",
+			want: model.MetricFromGauge("servers.a.cpu", model.Gauge(0.5)),
+		},
+		{
+			name: "Missing timestamp",
+			line: "servers.a.cpu 0.5",
+			want: model.MetricFromGauge("servers.a.cpu", model.Gauge(0.5)),
+		},
+		{
+			name: "Counter",
+			line: "servers.a.requests 10 1650000000",
+			want: withTimestamp(model.MetricFromCounter("servers.a.requests", model.Counter(10)), 1650000000000),
+		},
+		{
+			name: "Rounded counter",
+			line: "servers.a.requests 9.7 1650000000",
+			want: withTimestamp(model.MetricFromCounter("servers.a.requests", model.Counter(10)), 1650000000000),
+		},
+		{
+			name: "Pattern doesn't cross segments",
+			line: "servers.a.b.requests 10",
+			want: model.MetricFromGauge("servers.a.b.requests", model.Gauge(10)),
+		},
+		{
+			name: "Tags",
+			line: "servers.a.cpu;dc=east;rack=1 0.5 1650000000",
+			want: tagged,
+		},
+		{
+			name:    "Missing value",
+			line:    "servers.a.cpu",
+			wantErr: true,
+		},
+		{
+			name:    "Extra fields",
+			line:    "servers.a.cpu 0.5 1650000000 1",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid value",
+			line:    "servers.a.cpu abc",
+			wantErr: true,
+		},
+		{
+			name:    "NaN value",
+			line:    "servers.a.cpu NaN",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid timestamp",
+			line:    "servers.a.cpu 0.5 abc",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid tag",
+			line:    "servers.a.cpu;dc 0.5",
+			wantErr: true,
+		},
+		{
+			name:    "Missing path",
+			line:    ";dc=east 0.5",
+			wantErr: true,
+		},
+	}
+
+	p, err := NewParser([]string{"servers.*.requests"})
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.ParseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewParserInvalidPattern(t *testing.T) {
+	_, err := NewParser([]string{"servers.[a"})
+	assert.Error(t, err)
+}
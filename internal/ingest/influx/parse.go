@@ -0,0 +1,416 @@
+package influx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+// LineError reports a line of a batch that couldn't be parsed. Lines are
+// numbered from 1.
+type LineError struct {
+	Line int    `json:"line"`
+	Err  string `json:"error"`
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// ParsePrecision returns the unit of line timestamps given by the precision
+// parameter of a write request. Empty precision means nanoseconds; "n" and
+// "u" are the InfluxDB 1.x forms of "ns" and "us".
+func ParsePrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	}
+	return 0, fmt.Errorf("invalid precision: %q", precision)
+}
+
+// toMillis converts a timestamp in units of precision to milliseconds.
+func toMillis(timestamp int64, precision time.Duration) int64 {
+	if precision >= time.Millisecond {
+		return timestamp * int64(precision/time.Millisecond)
+	}
+	return timestamp / int64(time.Millisecond/precision)
+}
+
+// DefaultSeriesTTL is how long the baseline of an integer counter series is
+// kept after its last point.
+const DefaultSeriesTTL = time.Hour
+
+// series is the previous point of an integer counter series.
+type series struct {
+	value model.Counter
+	seen  time.Time
+}
+
+// Parser converts InfluxDB line protocol into metrics: every numeric or
+// boolean field becomes a metric named <measurement>_<field> with the tags
+// as labels. Floats and booleans are gauges; integers are counters if the
+// metric name matches one of the integer counter patterns and gauges
+// otherwise. String fields are skipped.
+//
+// Integer counters are cumulative, as Telegraf reports them, and Convert
+// turns them into the increase since the previous point of their series;
+// the first point only sets the baseline. A decrease means the counter was
+// reset, so the whole value is the increase. Series without points for the
+// TTL are forgotten.
+//
+// The line timestamp, in the precision of the batch, becomes the metric
+// timestamp.
+type Parser struct {
+	sync.Mutex
+
+	integerCounters []string
+	accept          func(metric model.Metric) (model.Metric, error)
+	ttl             time.Duration
+	now             func() time.Time
+	series          map[string]series
+	prunedAt        time.Time
+}
+
+// NewParser returns a parser that forgets counter series after ttl and
+// passes every metric through accept, e.g. to apply the name policy of the
+// server, so that a rejected metric fails only its line. Zero ttl falls back
+// to DefaultSeriesTTL; a nil accept accepts every metric as is.
+func NewParser(
+	integerCounters []string,
+	ttl time.Duration,
+	accept func(metric model.Metric) (model.Metric, error),
+) (*Parser, error) {
+	for _, pattern := range integerCounters {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid integer counter pattern %q: %w", pattern, err)
+		}
+	}
+
+	if ttl == 0 {
+		ttl = DefaultSeriesTTL
+	}
+
+	return &Parser{
+		integerCounters: integerCounters,
+		accept:          accept,
+		ttl:             ttl,
+		now:             time.Now,
+		series:          make(map[string]series),
+	}, nil
+}
+
+// Parse parses a batch of lines with timestamps in units of precision. It
+// returns the metrics of all valid lines, with the integer counters still
+// cumulative, along with an error for every invalid one.
+func (p *Parser) Parse(r io.Reader, precision time.Duration) ([]model.Metric, []LineError, error) {
+	var metrics []model.Metric
+	var lineErrors []LineError
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for n := 1; scanner.Scan(); n++ {
+		lineMetrics, err := p.ParseLine(scanner.Text(), precision)
+		if err != nil {
+			lineErrors = append(lineErrors, LineError{Line: n, Err: err.Error()})
+			continue
+		}
+		metrics = append(metrics, lineMetrics...)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return metrics, lineErrors, nil
+}
+
+// ParseLine parses a single line with the timestamp in units of precision,
+// leaving the integer counters cumulative. Blank lines and comments yield no
+// metrics.
+func (p *Parser) ParseLine(line string, precision time.Duration) ([]model.Metric, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	sections := splitUnescaped(line, ' ')
+	if len(sections) < 2 {
+		return nil, errors.New("missing fields")
+	}
+	if len(sections) > 3 {
+		return nil, errors.New("unexpected data after timestamp")
+	}
+
+	var timestamp int64
+	if len(sections) == 3 {
+		t, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+		timestamp = toMillis(t, precision)
+	}
+
+	keys := splitUnescaped(sections[0], ',')
+	measurement := unescape(keys[0])
+	if measurement == "" {
+		return nil, errors.New("missing measurement")
+	}
+
+	labels, err := parseTags(keys[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []model.Metric
+
+	for _, field := range splitUnescaped(sections[1], ',') {
+		key, value, err := splitPair(field)
+		if err != nil {
+			return nil, err
+		}
+
+		metric, ok, err := p.parseField(measurement+"_"+key, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field %q: %w", key, err)
+		}
+		if !ok {
+			continue
+		}
+
+		metric.Labels = labels
+		metric.Timestamp = timestamp
+		if err := metric.Validate(); err != nil {
+			return nil, err
+		}
+		if p.accept != nil {
+			if metric, err = p.accept(metric); err != nil {
+				return nil, err
+			}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
+
+// Convert replaces the cumulative counters of parsed metrics with their
+// increase since the previous point of the series, dropping the counters
+// without one, and stores the metrics with push. The baselines are moved
+// only once push succeeds, so that a retried batch is converted from the
+// same baselines; batches are therefore converted one at a time.
+func (p *Parser) Convert(metrics []model.Metric, push func(metrics []model.Metric) error) error {
+	p.Lock()
+	defer p.Unlock()
+
+	now := p.now()
+	moved := make(map[string]series)
+
+	result := make([]model.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		if metric.MType != model.MetricTypeCounter {
+			result = append(result, metric)
+			continue
+		}
+
+		key := metric.Key()
+		value := *metric.Delta
+
+		prev, ok := moved[key]
+		if !ok {
+			prev, ok = p.series[key]
+		}
+		moved[key] = series{value: value, seen: now}
+		if !ok {
+			continue
+		}
+
+		delta := value - prev.value
+		if value < prev.value {
+			delta = value
+		}
+		metric.Delta = &delta
+		result = append(result, metric)
+	}
+
+	if len(result) > 0 {
+		if err := push(result); err != nil {
+			return err
+		}
+	}
+
+	p.commit(now, moved)
+
+	return nil
+}
+
+// commit stores the moved baselines and forgets the stale ones, at most
+// once per TTL.
+func (p *Parser) commit(now time.Time, moved map[string]series) {
+	for key, s := range moved {
+		p.series[key] = s
+	}
+
+	if now.Sub(p.prunedAt) < p.ttl {
+		return
+	}
+
+	for key, s := range p.series {
+		if now.Sub(s.seen) > p.ttl {
+			delete(p.series, key)
+		}
+	}
+	p.prunedAt = now
+}
+
+func (p *Parser) isIntegerCounter(name string) bool {
+	for _, pattern := range p.integerCounters {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseField returns false for a field that can't be represented by a
+// metric, i.e. a string.
+func (p *Parser) parseField(name, value string) (model.Metric, bool, error) {
+	switch {
+	case value == "":
+		return model.Metric{}, false, errors.New("missing value")
+
+	case strings.HasPrefix(value, `"`):
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+			return model.Metric{}, false, errors.New("unterminated string")
+		}
+		return model.Metric{}, false, nil
+
+	case strings.HasSuffix(value, "i"), strings.HasSuffix(value, "u"):
+		v, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		if err != nil {
+			return model.Metric{}, false, err
+		}
+		if strings.HasSuffix(value, "u") && v < 0 {
+			return model.Metric{}, false, errors.New("negative unsigned integer")
+		}
+		if p.isIntegerCounter(name) {
+			return model.MetricFromCounter(name, model.Counter(v)), true, nil
+		}
+		return model.MetricFromGauge(name, model.Gauge(v)), true, nil
+	}
+
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		return model.MetricFromGauge(name, model.Gauge(1)), true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return model.MetricFromGauge(name, model.Gauge(0)), true, nil
+	}
+
+	v, err := model.GaugeFromString(value)
+	if err != nil {
+		return model.Metric{}, false, err
+	}
+
+	return model.MetricFromGauge(name, v), true, nil
+}
+
+func parseTags(tags []string) (model.Labels, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	labels := make(model.Labels, len(tags))
+	for _, tag := range tags {
+		name, value, err := splitPair(tag)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("duplicate tag: %s", name)
+		}
+		labels[name] = unescape(value)
+	}
+
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// splitPair splits key=value at the first unescaped '=' and unescapes the key.
+func splitPair(s string) (string, string, error) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '=':
+			key := unescape(s[:i])
+			if key == "" {
+				return "", "", fmt.Errorf("missing key in %q", s)
+			}
+			return key, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("missing '=' in %q", s)
+}
+
+// splitUnescaped splits s at every sep that is neither escaped with a
+// backslash nor inside a double-quoted string. Runs of spaces count as one
+// separator.
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			if sep != ' ' || i > start {
+				parts = append(parts, s[start:i])
+			}
+			start = i + 1
+		}
+	}
+
+	if sep != ' ' || start < len(s) {
+		parts = append(parts, s[start:])
+	}
+
+	return parts
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`, ="\`, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
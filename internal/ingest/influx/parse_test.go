@@ -0,0 +1,256 @@
+package influx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func withLabels(metric model.Metric, labels model.Labels) model.Metric {
+	metric.Labels = labels
+	return metric
+}
+
+func withTimestamp(metric model.Metric, timestamp int64) model.Metric {
+	metric.Timestamp = timestamp
+	return metric
+}
+
+func TestParser_ParseLine(t *testing.T) {
+	p, err := NewParser([]string{"*_requests"}, 0, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		line    string
+		want    []model.Metric
+		wantErr bool
+	}{
+		{
+			name: "Float field with tags and timestamp",
+			line: "cpu,host=a,region=eu usage_user=12.5 1660000000000000000",
+			want: []model.Metric{
+				withTimestamp(withLabels(model.MetricFromGauge("cpu_usage_user", model.Gauge(12.5)), model.Labels{"host": "a", "region": "eu"}), 1660000000000),
+			},
+		},
+		{
+			name: "Integer counter and gauge fields",
+			line: "http requests=10i,connections=3i",
+			want: []model.Metric{
+				model.MetricFromCounter("http_requests", model.Counter(10)),
+				model.MetricFromGauge("http_connections", model.Gauge(3)),
+			},
+		},
+		{
+			name: "Unsigned, boolean and string fields",
+			line: `system uptime=100u,healthy=true,version="1.0, beta"`,
+			want: []model.Metric{
+				model.MetricFromGauge("system_uptime", model.Gauge(100)),
+				model.MetricFromGauge("system_healthy", model.Gauge(1)),
+			},
+		},
+		{
+			name: "Escaped tag value",
+			line: `disk,path=/mnt/my\ disk,kind=a\,b free=1`,
+			want: []model.Metric{
+				withLabels(model.MetricFromGauge("disk_free", model.Gauge(1)), model.Labels{"path": "/mnt/my disk", "kind": "a,b"}),
+			},
+		},
+		{
+			name: "Comment",
+			line: "# a comment",
+		},
+		{
+			name:    "Missing fields",
+			line:    "cpu,host=a",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid field value",
+			line:    "cpu usage=abc",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid tag name",
+			line:    "cpu,host-name=a usage=1",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid timestamp",
+			line:    "cpu usage=1 now",
+			wantErr: true,
+		},
+		{
+			name:    "Unterminated string",
+			line:    `cpu version="1.0`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := p.ParseLine(tt.line, time.Nanosecond)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, metrics)
+		})
+	}
+}
+
+// convert parses the batch and returns the metrics pushed by Convert.
+func convert(t *testing.T, p *Parser, batch string) []model.Metric {
+	metrics, _, err := p.Parse(strings.NewReader(batch), time.Nanosecond)
+	require.NoError(t, err)
+
+	var pushed []model.Metric
+	require.NoError(t, p.Convert(metrics, func(metrics []model.Metric) error {
+		pushed = metrics
+		return nil
+	}))
+
+	return pushed
+}
+
+func TestParser_Convert(t *testing.T) {
+	p, err := NewParser([]string{"*_requests"}, 0, nil)
+	require.NoError(t, err)
+
+	requests := func(delta int64) []model.Metric {
+		return []model.Metric{
+			withLabels(model.MetricFromCounter("http_requests", model.Counter(delta)), model.Labels{"host": "a"}),
+		}
+	}
+
+	// The first point only sets the baseline.
+	assert.Empty(t, convert(t, p, "http,host=a requests=100i\nhttp,host=b requests=7i\n"))
+	assert.Equal(t, requests(50), convert(t, p, "http,host=a requests=150i"))
+
+	// An invalid line doesn't move the baseline.
+	assert.Empty(t, convert(t, p, "http,host=a requests=500i,size=abc"))
+
+	// The counter was reset.
+	assert.Equal(t, requests(20), convert(t, p, "http,host=a requests=20i"))
+	assert.Equal(t, requests(10), convert(t, p, "http,host=a requests=30i"))
+
+	// Points of one series in a batch follow each other.
+	assert.Equal(t, append(requests(5), requests(5)...), convert(t, p, "http,host=a requests=35i\nhttp,host=a requests=40i\n"))
+}
+
+func TestParser_ConvertPushError(t *testing.T) {
+	p, err := NewParser([]string{"*_requests"}, 0, nil)
+	require.NoError(t, err)
+
+	assert.Empty(t, convert(t, p, "http requests=100i"))
+
+	metrics, _, err := p.Parse(strings.NewReader("http requests=150i"), time.Nanosecond)
+	require.NoError(t, err)
+	err = p.Convert(metrics, func([]model.Metric) error {
+		return errors.New("storage is down")
+	})
+	assert.Error(t, err)
+
+	// The retried batch is converted from the same baseline.
+	assert.Equal(t, []model.Metric{model.MetricFromCounter("http_requests", model.Counter(50))}, convert(t, p, "http requests=150i"))
+}
+
+func TestParser_ConvertTTL(t *testing.T) {
+	now := time.Now()
+	p, err := NewParser([]string{"*_requests"}, time.Minute, nil)
+	require.NoError(t, err)
+	p.now = func() time.Time { return now }
+
+	assert.Empty(t, convert(t, p, "http requests=100i"))
+
+	now = now.Add(2 * time.Minute)
+	assert.Empty(t, convert(t, p, "rpc requests=10i"))
+
+	// The stale series starts over from a new baseline.
+	assert.Len(t, p.series, 1)
+	assert.Empty(t, convert(t, p, "http requests=150i"))
+	assert.Len(t, convert(t, p, "rpc requests=20i"), 1)
+}
+
+func TestParser_Parse(t *testing.T) {
+	p, err := NewParser(nil, 0, nil)
+	require.NoError(t, err)
+
+	metrics, lineErrors, err := p.Parse(strings.NewReader("cpu usage=1\n\ncpu usage=\nmem used=2i\n"), time.Nanosecond)
+	require.NoError(t, err)
+
+	assert.Equal(t, []model.Metric{
+		model.MetricFromGauge("cpu_usage", model.Gauge(1)),
+		model.MetricFromGauge("mem_used", model.Gauge(2)),
+	}, metrics)
+
+	require.Len(t, lineErrors, 1)
+	assert.Equal(t, 3, lineErrors[0].Line)
+}
+
+func TestParser_ParseAccept(t *testing.T) {
+	p, err := NewParser(nil, 0, func(metric model.Metric) (model.Metric, error) {
+		if metric.ID == "disk io_read" {
+			return model.Metric{}, &model.NameError{ID: metric.ID, Reason: "rejected"}
+		}
+		return metric, nil
+	})
+	require.NoError(t, err)
+
+	metrics, lineErrors, err := p.Parse(strings.NewReader("cpu usage=1\ndisk\\ io read=1\n"), time.Nanosecond)
+	require.NoError(t, err)
+
+	// Only the line of the rejected metric fails.
+	assert.Equal(t, []model.Metric{model.MetricFromGauge("cpu_usage", model.Gauge(1))}, metrics)
+	require.Len(t, lineErrors, 1)
+	assert.Equal(t, 2, lineErrors[0].Line)
+	assert.Contains(t, lineErrors[0].Err, "disk io_read")
+}
+
+func TestParser_ParseLinePrecision(t *testing.T) {
+	p, err := NewParser(nil, 0, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		precision string
+		line      string
+	}{
+		{precision: "", line: "cpu usage=1 1700000000123000000"},
+		{precision: "n", line: "cpu usage=1 1700000000123000000"},
+		{precision: "us", line: "cpu usage=1 1700000000123000"},
+		{precision: "ms", line: "cpu usage=1 1700000000123"},
+		{precision: "s", line: "cpu usage=1 1700000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.precision, func(t *testing.T) {
+			precision, err := ParsePrecision(tt.precision)
+			require.NoError(t, err)
+
+			metrics, err := p.ParseLine(tt.line, precision)
+			require.NoError(t, err)
+			require.Len(t, metrics, 1)
+
+			want := int64(1700000000123)
+			if tt.precision == "s" {
+				want = 1700000000000
+			}
+			assert.Equal(t, want, metrics[0].Timestamp)
+		})
+	}
+
+	_, err = ParsePrecision("abrakadabra")
+	assert.Error(t, err)
+}
+
+func TestNewParser(t *testing.T) {
+	_, err := NewParser([]string{"["}, 0, nil)
+	assert.Error(t, err)
+}
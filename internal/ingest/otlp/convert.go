@@ -0,0 +1,368 @@
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// DefaultSeriesTTL is how long the state of a Sum series is kept after its
+// last point.
+const DefaultSeriesTTL = time.Hour
+
+// series is the state of a monotonic Sum series between requests.
+type series struct {
+	// start and value are the previous point of a cumulative series.
+	start uint64
+	value float64
+	// remainder is the part of the increase that hasn't been stored yet, as
+	// counters are integers.
+	remainder float64
+	seen      time.Time
+}
+
+// Converter maps OTLP metrics onto metrics of the storage:
+//   - Gauge points become gauges;
+//   - monotonic Sum points become counters: delta points as they are and
+//     cumulative points as the difference from the previous point of the
+//     series, the first point only sets the baseline;
+//   - non-monotonic Sum points, which are current levels, become gauges.
+//
+// Counters are rounded, and the rounding remainder is carried to the next
+// point of the series. Series without points for the TTL are forgotten.
+//
+// Resource and point attributes become labels, with the names sanitised to
+// the label syntax; point attributes take precedence. Histograms and
+// summaries are not supported and are rejected.
+type Converter struct {
+	sync.Mutex
+
+	accept   func(metric model.Metric) (model.Metric, error)
+	ttl      time.Duration
+	now      func() time.Time
+	series   map[string]series
+	prunedAt time.Time
+}
+
+// NewConverter returns a converter that forgets series after ttl and passes
+// every metric through accept, e.g. to apply the name policy of the server,
+// so that a rejected metric is reported as a rejected data point. Zero ttl
+// falls back to DefaultSeriesTTL; a nil accept accepts every metric as is.
+func NewConverter(ttl time.Duration, accept func(metric model.Metric) (model.Metric, error)) *Converter {
+	if ttl == 0 {
+		ttl = DefaultSeriesTTL
+	}
+
+	return &Converter{
+		accept: accept,
+		ttl:    ttl,
+		now:    time.Now,
+		series: make(map[string]series),
+	}
+}
+
+// conversion holds the series moved by a request until its metrics are
+// stored.
+type conversion struct {
+	c      *Converter
+	now    time.Time
+	series map[string]series
+}
+
+func (v *conversion) get(key string) (series, bool) {
+	if s, ok := v.series[key]; ok {
+		return s, true
+	}
+	s, ok := v.c.series[key]
+	return s, ok
+}
+
+// Convert converts the request and stores its metrics with push. The series
+// are moved only once push succeeds, so that a retried request is converted
+// from the same baselines; requests are therefore converted one at a time.
+// The data points that were rejected are reported as a partial success, with
+// the reason of the last rejection.
+func (c *Converter) Convert(
+	req *colmetricspb.ExportMetricsServiceRequest,
+	push func(metrics []model.Metric) error,
+) (*colmetricspb.ExportMetricsPartialSuccess, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	v := &conversion{c: c, now: c.now(), series: make(map[string]series)}
+
+	var metrics []model.Metric
+	var rejected int64
+	var lastErr error
+
+	for _, rm := range req.GetResourceMetrics() {
+		resourceLabels := labelsFromAttributes(nil, rm.GetResource().GetAttributes())
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				converted, n, err := v.convertMetric(m, resourceLabels)
+				metrics = append(metrics, converted...)
+				if err != nil {
+					rejected += n
+					lastErr = err
+				}
+			}
+		}
+	}
+
+	if len(metrics) > 0 {
+		if err := push(metrics); err != nil {
+			return nil, err
+		}
+	}
+
+	c.commit(v)
+
+	if rejected == 0 {
+		return nil, nil
+	}
+
+	return &colmetricspb.ExportMetricsPartialSuccess{
+		RejectedDataPoints: rejected,
+		ErrorMessage:       lastErr.Error(),
+	}, nil
+}
+
+// commit stores the series moved by the conversion and forgets the stale
+// ones, at most once per TTL.
+func (c *Converter) commit(v *conversion) {
+	for key, s := range v.series {
+		c.series[key] = s
+	}
+
+	if v.now.Sub(c.prunedAt) < c.ttl {
+		return
+	}
+
+	for key, s := range c.series {
+		if v.now.Sub(s.seen) > c.ttl {
+			delete(c.series, key)
+		}
+	}
+	c.prunedAt = v.now
+}
+
+func (v *conversion) convertMetric(m *metricspb.Metric, resourceLabels model.Labels) ([]model.Metric, int64, error) {
+	var metrics []model.Metric
+	var rejected int64
+	var lastErr error
+
+	add := func(p *metricspb.NumberDataPoint, convert func(metric model.Metric, value float64) (model.Metric, bool)) {
+		if p.GetFlags()&uint32(metricspb.DataPointFlags_FLAG_NO_RECORDED_VALUE) != 0 {
+			return
+		}
+
+		value := numberValue(p)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			rejected++
+			lastErr = fmt.Errorf("metric %s: invalid value %v", m.GetName(), value)
+			return
+		}
+
+		metric := model.Metric{
+			ID:     model.MetricName(m.GetName()),
+			Labels: labelsFromAttributes(resourceLabels, p.GetAttributes()),
+		}
+
+		// The metric is accepted before it is converted, so that a series is
+		// tracked under its normalised name.
+		if v.c.accept != nil {
+			var err error
+			if metric, err = v.c.accept(metric); err != nil {
+				rejected++
+				lastErr = err
+				return
+			}
+		}
+
+		metric, ok := convert(metric, value)
+		if !ok {
+			return
+		}
+
+		if err := metric.Validate(); err != nil {
+			rejected++
+			lastErr = fmt.Errorf("metric %s: %w", m.GetName(), err)
+			return
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, p := range data.Gauge.GetDataPoints() {
+			add(p, gauge)
+		}
+
+	case *metricspb.Metric_Sum:
+		sum := data.Sum
+		for _, p := range sum.GetDataPoints() {
+			switch {
+			case !sum.GetIsMonotonic():
+				add(p, gauge)
+			case sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+				add(p, v.deltaToCounter)
+			case sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE:
+				start := p.GetStartTimeUnixNano()
+				add(p, func(metric model.Metric, value float64) (model.Metric, bool) {
+					return v.cumulativeToCounter(metric, start, value)
+				})
+			default:
+				rejected++
+				lastErr = fmt.Errorf("metric %s: unspecified aggregation temporality", m.GetName())
+			}
+		}
+
+	default:
+		n := dataPointCount(m)
+		return nil, n, fmt.Errorf("metric %s: unsupported data type %T", m.GetName(), m.GetData())
+	}
+
+	return metrics, rejected, lastErr
+}
+
+func gauge(metric model.Metric, value float64) (model.Metric, bool) {
+	v := model.Gauge(value)
+	metric.MType = model.MetricTypeGauge
+	metric.Value = &v
+	return metric, true
+}
+
+// counter rounds the value to a counter and returns the remainder.
+func counter(metric model.Metric, value float64) (model.Metric, float64) {
+	rounded := math.Round(value)
+	d := model.Counter(rounded)
+	metric.MType = model.MetricTypeCounter
+	metric.Delta = &d
+	return metric, value - rounded
+}
+
+// deltaToCounter returns the increase of a delta point along with the
+// remainder carried from the previous point.
+func (v *conversion) deltaToCounter(metric model.Metric, value float64) (model.Metric, bool) {
+	key := metric.Key()
+	s, _ := v.get(key)
+	s.seen = v.now
+
+	metric, s.remainder = counter(metric, value+s.remainder)
+	v.series[key] = s
+
+	return metric, true
+}
+
+// cumulativeToCounter returns the increase of a cumulative sum since the
+// previous point. A new start time or a decrease means the sum was reset, so
+// the whole value is the increase.
+func (v *conversion) cumulativeToCounter(metric model.Metric, start uint64, value float64) (model.Metric, bool) {
+	key := metric.Key()
+	prev, ok := v.get(key)
+
+	s := series{start: start, value: value, seen: v.now}
+	if !ok {
+		v.series[key] = s
+		return model.Metric{}, false
+	}
+
+	delta := value - prev.value
+	if start != prev.start || value < prev.value {
+		delta = value
+	}
+
+	metric, s.remainder = counter(metric, delta+prev.remainder)
+	v.series[key] = s
+
+	return metric, true
+}
+
+func numberValue(p *metricspb.NumberDataPoint) float64 {
+	switch v := p.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt)
+	case *metricspb.NumberDataPoint_AsDouble:
+		return v.AsDouble
+	default:
+		return 0
+	}
+}
+
+func dataPointCount(m *metricspb.Metric) int64 {
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Histogram:
+		return int64(len(data.Histogram.GetDataPoints()))
+	case *metricspb.Metric_ExponentialHistogram:
+		return int64(len(data.ExponentialHistogram.GetDataPoints()))
+	case *metricspb.Metric_Summary:
+		return int64(len(data.Summary.GetDataPoints()))
+	default:
+		return 0
+	}
+}
+
+// labelsFromAttributes adds scalar attributes to a copy of base. Attributes
+// with empty or non-scalar values are skipped.
+func labelsFromAttributes(base model.Labels, attributes []*commonpb.KeyValue) model.Labels {
+	if len(base) == 0 && len(attributes) == 0 {
+		return nil
+	}
+
+	labels := make(model.Labels, len(base)+len(attributes))
+	for name, value := range base {
+		labels[name] = value
+	}
+
+	for _, kv := range attributes {
+		value, ok := attributeValue(kv.GetValue())
+		if !ok || value == "" {
+			continue
+		}
+		labels[labelName(kv.GetKey())] = value
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+
+	return labels
+}
+
+func attributeValue(v *commonpb.AnyValue) (string, bool) {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue, true
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue), true
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10), true
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// labelName sanitises an attribute key, e.g. service.name becomes
+// service_name.
+func labelName(key string) string {
+	name := invalidLabelChars.ReplaceAllString(key, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,242 @@
+package otlp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func intPoint(start uint64, value int64, attributes ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        attributes,
+		StartTimeUnixNano: start,
+		Value:             &metricspb.NumberDataPoint_AsInt{AsInt: value},
+	}
+}
+
+func newTestRequest(metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{
+			{
+				Resource: &resourcepb.Resource{
+					Attributes: []*commonpb.KeyValue{stringAttribute("service.name", "api")},
+				},
+				ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+			},
+		},
+	}
+}
+
+func sumMetric(name string, temporality metricspb.AggregationTemporality, monotonic bool, points ...*metricspb.NumberDataPoint) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name: name,
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			DataPoints:             points,
+			AggregationTemporality: temporality,
+			IsMonotonic:            monotonic,
+		}},
+	}
+}
+
+func withLabels(metric model.Metric, labels model.Labels) model.Metric {
+	metric.Labels = labels
+	return metric
+}
+
+func doublePoint(start uint64, value float64) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		StartTimeUnixNano: start,
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+// convert converts the request and returns the pushed metrics.
+func convert(t *testing.T, c *Converter, req *colmetricspb.ExportMetricsServiceRequest) []model.Metric {
+	var pushed []model.Metric
+	partialSuccess, err := c.Convert(req, func(metrics []model.Metric) error {
+		pushed = metrics
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Nil(t, partialSuccess)
+	return pushed
+}
+
+func TestConverter_Convert(t *testing.T) {
+	labels := model.Labels{"service_name": "api"}
+
+	c := NewConverter(0, nil)
+	metrics := convert(t, c, newTestRequest(
+		&metricspb.Metric{
+			Name: "temperature",
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+				{
+					Attributes: []*commonpb.KeyValue{stringAttribute("room", "kitchen")},
+					Value:      &metricspb.NumberDataPoint_AsDouble{AsDouble: 21.5},
+				},
+			}}},
+		},
+		sumMetric("requests", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, intPoint(1, 5)),
+		sumMetric("queue", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, false, intPoint(1, 7)),
+		sumMetric("bytes", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, true, intPoint(1, 100)),
+	))
+	assert.Equal(t, []model.Metric{
+		withLabels(model.MetricFromGauge("temperature", model.Gauge(21.5)), model.Labels{"service_name": "api", "room": "kitchen"}),
+		withLabels(model.MetricFromCounter("requests", model.Counter(5)), labels),
+		withLabels(model.MetricFromGauge("queue", model.Gauge(7)), labels),
+	}, metrics)
+
+	cumulative := func(start uint64, value int64) []model.Metric {
+		return convert(t, c, newTestRequest(
+			sumMetric("bytes", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, true, intPoint(start, value)),
+		))
+	}
+
+	assert.Equal(t, []model.Metric{withLabels(model.MetricFromCounter("bytes", model.Counter(50)), labels)}, cumulative(1, 150))
+	// The sum was reset.
+	assert.Equal(t, []model.Metric{withLabels(model.MetricFromCounter("bytes", model.Counter(20)), labels)}, cumulative(2, 20))
+	assert.Equal(t, []model.Metric{withLabels(model.MetricFromCounter("bytes", model.Counter(10)), labels)}, cumulative(2, 30))
+}
+
+func TestConverter_ConvertPushError(t *testing.T) {
+	labels := model.Labels{"service_name": "api"}
+	c := NewConverter(0, nil)
+
+	request := func(value int64) *colmetricspb.ExportMetricsServiceRequest {
+		return newTestRequest(
+			sumMetric("bytes", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, true, intPoint(1, value)),
+		)
+	}
+
+	assert.Empty(t, convert(t, c, request(100)))
+
+	_, err := c.Convert(request(150), func([]model.Metric) error {
+		return errors.New("storage is down")
+	})
+	assert.Error(t, err)
+
+	// The retried request is converted from the same baseline.
+	assert.Equal(t, []model.Metric{withLabels(model.MetricFromCounter("bytes", model.Counter(50)), labels)}, convert(t, c, request(150)))
+}
+
+func TestConverter_ConvertRemainder(t *testing.T) {
+	labels := model.Labels{"service_name": "api"}
+	c := NewConverter(0, nil)
+
+	request := func(temporality metricspb.AggregationTemporality, value float64) *colmetricspb.ExportMetricsServiceRequest {
+		return newTestRequest(sumMetric("seconds", temporality, true, doublePoint(1, value)))
+	}
+	delta := func(value float64) []model.Metric {
+		return convert(t, c, request(metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, value))
+	}
+	cumulative := func(value float64) []model.Metric {
+		return convert(t, c, request(metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, value))
+	}
+	seconds := func(delta int64) []model.Metric {
+		return []model.Metric{withLabels(model.MetricFromCounter("seconds", model.Counter(delta)), labels)}
+	}
+
+	// Three increases of 0.4 add up to 1, rather than to 0.
+	assert.Equal(t, seconds(0), delta(0.4))
+	assert.Equal(t, seconds(1), delta(0.4))
+	assert.Equal(t, seconds(0), delta(0.4))
+
+	c = NewConverter(0, nil)
+	assert.Empty(t, cumulative(0))
+	assert.Equal(t, seconds(0), cumulative(0.4))
+	assert.Equal(t, seconds(1), cumulative(0.8))
+	assert.Equal(t, seconds(0), cumulative(1.2))
+}
+
+func TestConverter_ConvertTTL(t *testing.T) {
+	now := time.Now()
+	c := NewConverter(time.Minute, nil)
+	c.now = func() time.Time { return now }
+
+	request := func(name string, value int64) *colmetricspb.ExportMetricsServiceRequest {
+		return newTestRequest(
+			sumMetric(name, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, true, intPoint(1, value)),
+		)
+	}
+
+	assert.Empty(t, convert(t, c, request("bytes", 100)))
+
+	now = now.Add(2 * time.Minute)
+	assert.Empty(t, convert(t, c, request("packets", 10)))
+
+	// The stale series starts over from a new baseline.
+	assert.Len(t, c.series, 1)
+	assert.Empty(t, convert(t, c, request("bytes", 150)))
+	assert.Len(t, convert(t, c, request("packets", 20)), 1)
+}
+
+func TestConverter_ConvertAccept(t *testing.T) {
+	c := NewConverter(0, func(metric model.Metric) (model.Metric, error) {
+		if metric.ID == "disk used" {
+			return model.Metric{}, &model.NameError{ID: metric.ID, Reason: "rejected"}
+		}
+		return metric, nil
+	})
+
+	var metrics []model.Metric
+	partialSuccess, err := c.Convert(newTestRequest(
+		sumMetric("requests", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, intPoint(1, 5)),
+		sumMetric("disk used", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, intPoint(1, 1), intPoint(1, 2)),
+	), func(pushed []model.Metric) error {
+		metrics = pushed
+		return nil
+	})
+	require.NoError(t, err)
+
+	// The rejected points are reported, the rest is pushed.
+	require.NotNil(t, partialSuccess)
+	assert.Equal(t, int64(2), partialSuccess.RejectedDataPoints)
+	assert.Contains(t, partialSuccess.ErrorMessage, "disk used")
+	assert.Equal(t, []model.Metric{
+		withLabels(model.MetricFromCounter("requests", model.Counter(5)), model.Labels{"service_name": "api"}),
+	}, metrics)
+}
+
+func TestConverter_ConvertRejected(t *testing.T) {
+	c := NewConverter(0, nil)
+
+	var metrics []model.Metric
+	partialSuccess, err := c.Convert(newTestRequest(
+		&metricspb.Metric{
+			Name: "latency",
+			Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+				DataPoints: []*metricspb.HistogramDataPoint{{Count: 1}, {Count: 2}},
+			}},
+		},
+		sumMetric("requests", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, intPoint(1, 5)),
+	), func(pushed []model.Metric) error {
+		metrics = pushed
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotNil(t, partialSuccess)
+	assert.Equal(t, int64(2), partialSuccess.RejectedDataPoints)
+	assert.NotEmpty(t, partialSuccess.ErrorMessage)
+	assert.Len(t, metrics, 1)
+}
+
+func TestLabelName(t *testing.T) {
+	assert.Equal(t, "service_name", labelName("service.name"))
+	assert.Equal(t, "_1st", labelName("1st"))
+}
@@ -0,0 +1,276 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 1 * time.Second
+	DefaultQueueSize     = 1000
+
+	ParseErrorsMetricName = "StatsdParseErrors"
+	DroppedMetricName     = "StatsdDropped"
+
+	maxPacketSize = 65535
+)
+
+type Config struct {
+	// Address is the UDP address to listen on. The listener is disabled
+	// when it is empty.
+	Address       string        `env:"STATSD_ADDRESS"`
+	BatchSize     int           `env:"STATSD_BATCH_SIZE"`
+	FlushInterval time.Duration `env:"STATSD_FLUSH_INTERVAL"`
+	QueueSize     int           `env:"STATSD_QUEUE_SIZE"`
+}
+
+func (c Config) Validate() error {
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("invalid non-positive BatchSize=%v", c.BatchSize)
+	}
+	if c.FlushInterval <= 0 {
+		return fmt.Errorf("invalid non-positive FlushInterval=%v", c.FlushInterval)
+	}
+	if c.QueueSize <= 0 {
+		return fmt.Errorf("invalid non-positive QueueSize=%v", c.QueueSize)
+	}
+	return nil
+}
+
+// MetricPusher stores the metrics of the listener. AcceptMetric returns the
+// metric as it is to be pushed, or an error if it would fail the whole push,
+// e.g. because of its name.
+type MetricPusher interface {
+	AcceptMetric(metric model.Metric) (model.Metric, error)
+	PushMetricList(ctx context.Context, metrics []model.Metric) error
+}
+
+type Stats struct {
+	Received    uint64
+	ParseErrors uint64
+	Dropped     uint64
+}
+
+// Listener receives StatsD packets over UDP and pushes the parsed metrics in
+// batches. Within a batch counters are summed and gauges keep the last value.
+// Parse errors and dropped metrics are reported along with every batch as
+// the StatsdParseErrors and StatsdDropped counters.
+type Listener struct {
+	config  Config
+	pusher  MetricPusher
+	metrics chan model.Metric
+
+	received    uint64
+	parseErrors uint64
+	dropped     uint64
+
+	reportedParseErrors uint64
+	reportedDropped     uint64
+}
+
+func NewListener(config Config, pusher MetricPusher) (*Listener, error) {
+	if pusher == nil {
+		return nil, errors.New("invalid pusher value: nil")
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Listener{
+		config:  config,
+		pusher:  pusher,
+		metrics: make(chan model.Metric, config.QueueSize),
+	}, nil
+}
+
+func (l *Listener) Run(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", l.config.Address)
+	if err != nil {
+		return err
+	}
+
+	return l.Serve(ctx, conn)
+}
+
+// Serve reads packets from conn until ctx is done. The pending batch is
+// pushed before Serve returns.
+func (l *Listener) Serve(ctx context.Context, conn net.PacketConn) error {
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		l.batchMetrics(ctx)
+	}()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			close(l.metrics)
+			wg.Wait()
+			return err
+		}
+
+		l.handlePacket(string(buf[:n]))
+	}
+
+	close(l.metrics)
+	wg.Wait()
+
+	return nil
+}
+
+func (l *Listener) Stats() Stats {
+	return Stats{
+		Received:    atomic.LoadUint64(&l.received),
+		ParseErrors: atomic.LoadUint64(&l.parseErrors),
+		Dropped:     atomic.LoadUint64(&l.dropped),
+	}
+}
+
+func (l *Listener) handlePacket(packet string) {
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		atomic.AddUint64(&l.received, 1)
+
+		// Metrics rejected by the pusher count as parse errors, so that they
+		// don't fail the rest of the batch.
+		metric, err := ParseLine(line)
+		if err == nil {
+			metric, err = l.pusher.AcceptMetric(metric)
+		}
+		if err != nil {
+			atomic.AddUint64(&l.parseErrors, 1)
+			continue
+		}
+
+		select {
+		case l.metrics <- metric:
+		default:
+			atomic.AddUint64(&l.dropped, 1)
+		}
+	}
+}
+
+type batchKey struct {
+	mType model.MetricType
+	key   string
+}
+
+type batch struct {
+	metrics []model.Metric
+	index   map[batchKey]int
+}
+
+func newBatch(size int) *batch {
+	return &batch{
+		metrics: make([]model.Metric, 0, size),
+		index:   make(map[batchKey]int, size),
+	}
+}
+
+func (b *batch) add(metric model.Metric) {
+	key := batchKey{mType: metric.MType, key: metric.Key()}
+
+	i, ok := b.index[key]
+	if !ok {
+		b.index[key] = len(b.metrics)
+		b.metrics = append(b.metrics, metric)
+		return
+	}
+
+	if metric.MType == model.MetricTypeCounter {
+		delta := *b.metrics[i].Delta + *metric.Delta
+		b.metrics[i].Delta = &delta
+		return
+	}
+
+	b.metrics[i] = metric
+}
+
+func (l *Listener) batchMetrics(ctx context.Context) {
+	ticker := time.NewTicker(l.config.FlushInterval)
+	defer ticker.Stop()
+
+	b := newBatch(l.config.BatchSize)
+
+	for {
+		select {
+		case metric, ok := <-l.metrics:
+			if !ok {
+				// The listener is shutting down, so ctx is already done.
+				l.flush(context.Background(), b)
+				return
+			}
+
+			b.add(metric)
+			if len(b.metrics) >= l.config.BatchSize {
+				l.flush(ctx, b)
+				b = newBatch(l.config.BatchSize)
+			}
+
+		case <-ticker.C:
+			l.flush(ctx, b)
+			b = newBatch(l.config.BatchSize)
+		}
+	}
+}
+
+func (l *Listener) flush(ctx context.Context, b *batch) {
+	reportedParseErrors, reportedDropped := l.reportedParseErrors, l.reportedDropped
+
+	metrics := append(b.metrics, l.statsMetrics()...)
+	if len(metrics) == 0 {
+		return
+	}
+
+	if err := l.pusher.PushMetricList(ctx, metrics); err != nil {
+		log.Printf("Failed to push StatsD metrics: %v", err)
+		l.reportedParseErrors, l.reportedDropped = reportedParseErrors, reportedDropped
+		atomic.AddUint64(&l.dropped, uint64(len(b.metrics)))
+	}
+}
+
+// statsMetrics returns counters for the parse errors and drops that happened
+// since the previous batch.
+func (l *Listener) statsMetrics() []model.Metric {
+	var metrics []model.Metric
+
+	parseErrors := atomic.LoadUint64(&l.parseErrors)
+	if delta := parseErrors - l.reportedParseErrors; delta > 0 {
+		metrics = append(metrics, model.MetricFromCounter(ParseErrorsMetricName, model.Counter(delta)))
+		l.reportedParseErrors = parseErrors
+	}
+
+	dropped := atomic.LoadUint64(&l.dropped)
+	if delta := dropped - l.reportedDropped; delta > 0 {
+		metrics = append(metrics, model.MetricFromCounter(DroppedMetricName, model.Counter(delta)))
+		l.reportedDropped = dropped
+	}
+
+	return metrics
+}
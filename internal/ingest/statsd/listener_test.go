@@ -0,0 +1,76 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+type testPusher struct {
+	sync.Mutex
+	batches [][]model.Metric
+}
+
+// AcceptMetric rejects the metrics named "rejected".
+func (p *testPusher) AcceptMetric(metric model.Metric) (model.Metric, error) {
+	if metric.ID == "rejected" {
+		return model.Metric{}, &model.NameError{ID: metric.ID, Reason: "rejected"}
+	}
+	return metric, nil
+}
+
+func (p *testPusher) PushMetricList(ctx context.Context, metrics []model.Metric) error {
+	p.Lock()
+	defer p.Unlock()
+
+	p.batches = append(p.batches, metrics)
+	return nil
+}
+
+func TestListener(t *testing.T) {
+	pusher := &testPusher{}
+	l, err := NewListener(Config{
+		BatchSize:     100,
+		FlushInterval: 1 * time.Hour,
+		QueueSize:     100,
+	}, pusher)
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.Serve(ctx, conn)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Write([]byte("requests:1|c\nrequests:2|c|@0.5\ntemperature:1|g\ntemperature:2|g\nrejected:1|c\ninvalid"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return l.Stats().Received == 6
+	}, 1*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	want := []model.Metric{
+		model.MetricFromCounter("requests", model.Counter(5)),
+		model.MetricFromGauge("temperature", model.Gauge(2)),
+		model.MetricFromCounter(ParseErrorsMetricName, model.Counter(2)),
+	}
+	assert.Equal(t, [][]model.Metric{want}, pusher.batches)
+	assert.Equal(t, Stats{Received: 6, ParseErrors: 2}, l.Stats())
+}
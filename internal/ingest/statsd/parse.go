@@ -0,0 +1,115 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+const (
+	typeCounter = "c"
+	typeGauge   = "g"
+)
+
+// ParseLine parses a single StatsD line: <name>:<value>|<type>[|@<rate>][|#<tags>].
+// Counter values are scaled up by the sample rate. DogStatsD tags given as
+// name:value are mapped to labels.
+func ParseLine(line string) (model.Metric, error) {
+	fields := strings.Split(line, "|")
+	if len(fields) < 2 {
+		return model.Metric{}, fmt.Errorf("invalid line %q: missing type", line)
+	}
+
+	i := strings.LastIndexByte(fields[0], ':')
+	if i <= 0 {
+		return model.Metric{}, fmt.Errorf("invalid line %q: missing name", line)
+	}
+
+	name, value, mType := fields[0][:i], fields[0][i+1:], fields[1]
+	rate := 1.0
+	var labels model.Labels
+
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			r, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || r <= 0 || r > 1 {
+				return model.Metric{}, fmt.Errorf("invalid sample rate %q", field)
+			}
+			rate = r
+		case strings.HasPrefix(field, "#"):
+			l, err := parseTags(field[1:])
+			if err != nil {
+				return model.Metric{}, err
+			}
+			labels = l
+		default:
+			return model.Metric{}, fmt.Errorf("invalid line %q: unknown field %q", line, field)
+		}
+	}
+
+	var metric model.Metric
+
+	switch mType {
+	case typeCounter:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return model.Metric{}, fmt.Errorf("invalid counter value %q: %w", value, err)
+		}
+		delta := math.Round(v / rate)
+		if math.IsInf(delta, 0) || math.IsNaN(delta) {
+			return model.Metric{}, fmt.Errorf("invalid counter value %q", value)
+		}
+		metric = model.MetricFromCounter(name, model.Counter(delta))
+
+	case typeGauge:
+		if strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-") {
+			return model.Metric{}, errors.New("relative gauge updates are not supported")
+		}
+		v, err := model.GaugeFromString(value)
+		if err != nil {
+			return model.Metric{}, fmt.Errorf("invalid gauge value %q: %w", value, err)
+		}
+		metric = model.MetricFromGauge(name, v)
+
+	default:
+		return model.Metric{}, fmt.Errorf("unsupported metric type %q", mType)
+	}
+
+	metric.Labels = labels
+	if err := metric.Validate(); err != nil {
+		return model.Metric{}, err
+	}
+
+	return metric, nil
+}
+
+func parseTags(s string) (model.Labels, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	labels := make(model.Labels)
+	for _, tag := range strings.Split(s, ",") {
+		i := strings.IndexByte(tag, ':')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid tag %q: missing value", tag)
+		}
+
+		name, value := tag[:i], tag[i+1:]
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("duplicate tag name: %s", name)
+		}
+		labels[name] = value
+	}
+
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
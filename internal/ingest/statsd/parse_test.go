@@ -0,0 +1,95 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func TestParseLine(t *testing.T) {
+	labelled := model.MetricFromCounter("requests", model.Counter(1))
+	labelled.Labels = model.Labels{"host": "a", "service": "b"}
+
+	tests := []struct {
+		name    string
+		line    string
+		want    model.Metric
+		wantErr bool
+	}{
+		{
+			name: "Counter",
+			line: "requests:1|c",
+			want: model.MetricFromCounter("requests", model.Counter(1)),
+		},
+		{
+			name: "Sampled counter",
+			line: "requests:2|c|@0.1",
+			want: model.MetricFromCounter("requests", model.Counter(20)),
+		},
+		{
+			name: "Gauge",
+			line: "temperature:3.2|g",
+			want: model.MetricFromGauge("temperature", model.Gauge(3.2)),
+		},
+		{
+			name: "Sampled gauge",
+			line: "temperature:3.2|g|@0.5",
+			want: model.MetricFromGauge("temperature", model.Gauge(3.2)),
+		},
+		{
+			name: "Tags",
+			line: "requests:1|c|#host:a,service:b",
+			want: labelled,
+		},
+		{
+			name:    "Missing type",
+			line:    "requests:1",
+			wantErr: true,
+		},
+		{
+			name:    "Missing name",
+			line:    ":1|c",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid value",
+			line:    "requests:abc|c",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid sample rate",
+			line:    "requests:1|c|@2",
+			wantErr: true,
+		},
+		{
+			name:    "Relative gauge",
+			line:    "temperature:-1|g",
+			wantErr: true,
+		},
+		{
+			name:    "Unsupported type",
+			line:    "latency:320|ms",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid tag",
+			line:    "requests:1|c|#host",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, metric)
+		})
+	}
+}
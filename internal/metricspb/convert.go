@@ -0,0 +1,139 @@
+package metricspb
+
+import (
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ddsketch"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func MetricFromModel(metric model.Metric) *Metric {
+	m := &Metric{
+		Id:        string(metric.ID),
+		Type:      string(metric.MType),
+		Hash:      metric.Hash,
+		Labels:    metric.Labels,
+		Timestamp: metric.Timestamp,
+	}
+
+	if metric.Delta != nil {
+		m.Delta = int64(*metric.Delta)
+	}
+
+	if metric.Value != nil {
+		m.Value = float64(*metric.Value)
+	}
+
+	if metric.Histogram != nil {
+		m.Histogram = &Histogram{
+			Bounds: metric.Histogram.Bounds,
+			Counts: metric.Histogram.Counts,
+			Count:  metric.Histogram.Count,
+			Sum:    metric.Histogram.Sum,
+		}
+	}
+
+	if s := metric.Summary; s != nil {
+		m.Summary = &Summary{
+			RelativeAccuracy: s.RelativeAccuracy,
+			Positive:         &SummaryBins{Offset: int32(s.Positive.Offset), Counts: s.Positive.Counts},
+			Negative:         &SummaryBins{Offset: int32(s.Negative.Offset), Counts: s.Negative.Counts},
+			ZeroCount:        s.ZeroCount,
+			Count:            s.Count,
+			Sum:              s.Sum,
+			Min:              s.Min,
+			Max:              s.Max,
+		}
+	}
+
+	return m
+}
+
+func MetricListFromModel(metrics []model.Metric) []*Metric {
+	list := make([]*Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		list = append(list, MetricFromModel(metric))
+	}
+	return list
+}
+
+// ToModel converts the message into a model.Metric. Only the value matching
+// the metric type is set, so a metric of an unknown type fails validation.
+func (m *Metric) ToModel() model.Metric {
+	metric := model.Metric{
+		ID:        model.MetricName(m.GetId()),
+		MType:     model.MetricType(m.GetType()),
+		Hash:      m.GetHash(),
+		Timestamp: m.GetTimestamp(),
+	}
+
+	if len(m.GetLabels()) > 0 {
+		metric.Labels = m.GetLabels()
+	}
+
+	switch metric.MType {
+	case model.MetricTypeGauge:
+		value := model.Gauge(m.GetValue())
+		metric.Value = &value
+	case model.MetricTypeCounter:
+		delta := model.Counter(m.GetDelta())
+		metric.Delta = &delta
+	case model.MetricTypeHistogram:
+		if h := m.GetHistogram(); h != nil {
+			metric.Histogram = &model.Histogram{
+				Bounds: h.GetBounds(),
+				Counts: h.GetCounts(),
+				Count:  h.GetCount(),
+				Sum:    h.GetSum(),
+			}
+		}
+	case model.MetricTypeSummary:
+		if s := m.GetSummary(); s != nil {
+			metric.Summary = &ddsketch.Sketch{
+				RelativeAccuracy: s.GetRelativeAccuracy(),
+				Positive:         binsToModel(s.GetPositive()),
+				Negative:         binsToModel(s.GetNegative()),
+				ZeroCount:        s.GetZeroCount(),
+				Count:            s.GetCount(),
+				Sum:              s.GetSum(),
+				Min:              s.GetMin(),
+				Max:              s.GetMax(),
+			}
+		}
+	}
+
+	return metric
+}
+
+func binsToModel(b *SummaryBins) ddsketch.Bins {
+	return ddsketch.Bins{
+		Offset: int(b.GetOffset()),
+		Counts: b.GetCounts(),
+	}
+}
+
+func MetadataFromModel(metadata model.Metadata) *Metadata {
+	return &Metadata{
+		Id:          string(metadata.ID),
+		Unit:        metadata.Unit,
+		Description: metadata.Description,
+		Owner:       metadata.Owner,
+		Type:        string(metadata.Type),
+	}
+}
+
+func MetadataListFromModel(list []model.Metadata) []*Metadata {
+	result := make([]*Metadata, 0, len(list))
+	for _, metadata := range list {
+		result = append(result, MetadataFromModel(metadata))
+	}
+	return result
+}
+
+func (m *Metadata) ToModel() model.Metadata {
+	return model.Metadata{
+		ID:          model.MetricName(m.GetId()),
+		Unit:        m.GetUnit(),
+		Description: m.GetDescription(),
+		Owner:       m.GetOwner(),
+		Type:        model.MetricType(m.GetType()),
+	}
+}
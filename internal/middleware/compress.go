@@ -43,7 +43,9 @@ func GzipEncoderWithConfig(config GzipConfig) MiddlewareFunc {
 
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			if !strings.Contains(r.Header.Get("Accept-Encoding"), gzipScheme) {
+			// Upgraded connections, e.g. WebSocket, are hijacked from the
+			// response writer and can't be compressed.
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), gzipScheme) || r.Header.Get("Upgrade") != "" {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -70,6 +72,17 @@ func (w gzipWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
+// Flush sends the data compressed so far, so that streaming responses work
+// through the encoder.
+func (w gzipWriter) Flush() {
+	if f, ok := w.Writer.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func gzipCompressPool(config GzipConfig) sync.Pool {
 	return sync.Pool{
 		New: func() interface{} {
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrHistogramBoundsMismatch = errors.New("histogram bucket bounds mismatch")
+)
+
+// Histogram counts observations into buckets. Counts[i] is the number of
+// observations in (Bounds[i-1], Bounds[i]], and the last count is for the
+// observations above the last bound, so len(Counts) == len(Bounds)+1.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+// NewHistogram returns an empty histogram with the given bucket bounds.
+func NewHistogram(bounds []float64) Histogram {
+	return Histogram{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func MetricFromHistogram(id string, h Histogram) Metric {
+	return Metric{
+		ID:        MetricName(id),
+		MType:     MetricTypeHistogram,
+		Histogram: &h,
+	}
+}
+
+func (h Histogram) Validate() error {
+	for i, bound := range h.Bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("invalid histogram bound: %v", bound)
+		}
+		if i > 0 && bound <= h.Bounds[i-1] {
+			return fmt.Errorf("invalid histogram bounds: %v is not greater than %v", bound, h.Bounds[i-1])
+		}
+	}
+
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf(
+			"invalid number of histogram counts: %d, expected %d",
+			len(h.Counts),
+			len(h.Bounds)+1,
+		)
+	}
+
+	count := uint64(0)
+	for _, c := range h.Counts {
+		count += c
+	}
+	if count != h.Count {
+		return fmt.Errorf("invalid histogram count: %d, buckets sum up to %d", h.Count, count)
+	}
+
+	if math.IsNaN(h.Sum) || math.IsInf(h.Sum, 0) {
+		return fmt.Errorf("invalid histogram sum: %v", h.Sum)
+	}
+
+	return nil
+}
+
+// Observe adds a value to its bucket.
+func (h *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(h.Bounds, value)
+	h.Counts[i]++
+	h.Count++
+	h.Sum += value
+}
+
+// Merge adds the observations of another histogram with the same bounds.
+func (h *Histogram) Merge(other Histogram) error {
+	if len(h.Bounds) != len(other.Bounds) {
+		return ErrHistogramBoundsMismatch
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return ErrHistogramBoundsMismatch
+		}
+	}
+
+	for i := range h.Counts {
+		h.Counts[i] += other.Counts[i]
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+
+	return nil
+}
+
+// Clone returns a histogram that doesn't share the buckets with h.
+func (h Histogram) Clone() Histogram {
+	h.Bounds = append([]float64(nil), h.Bounds...)
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// String lists the count, the sum and the buckets by their upper bounds,
+// e.g. "count=3 sum=1.5 {0.1:1 1:2 +Inf:0}".
+func (h Histogram) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "count=%d sum=%s {", h.Count, Gauge(h.Sum))
+	for i, c := range h.Counts {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(histogramBoundString(h.Bounds, i))
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatUint(c, 10))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// hashData lists the bounds, the counts and the sum in the format used for
+// gauges in hashes.
+func (h Histogram) hashData() string {
+	var b strings.Builder
+
+	for _, bound := range h.Bounds {
+		fmt.Fprintf(&b, "%f,", bound)
+	}
+	b.WriteByte(':')
+	for _, c := range h.Counts {
+		fmt.Fprintf(&b, "%d,", c)
+	}
+	fmt.Fprintf(&b, ":%d:%f", h.Count, h.Sum)
+
+	return b.String()
+}
+
+// histogramBoundString returns the upper bound of the i-th bucket.
+func histogramBoundString(bounds []float64, i int) string {
+	if i == len(bounds) {
+		return "+Inf"
+	}
+	return Gauge(bounds[i]).String()
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		histogram Histogram
+		wantErr   bool
+	}{
+		{
+			name:      "Valid",
+			histogram: Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Count: 3, Sum: 7},
+		},
+		{
+			name:      "No bounds",
+			histogram: Histogram{Counts: []uint64{2}, Count: 2, Sum: 1},
+		},
+		{
+			name:      "Unsorted bounds",
+			histogram: Histogram{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}},
+			wantErr:   true,
+		},
+		{
+			name:      "Infinite bound",
+			histogram: Histogram{Bounds: []float64{math.Inf(1)}, Counts: []uint64{0, 0}},
+			wantErr:   true,
+		},
+		{
+			name:      "Missing overflow bucket",
+			histogram: Histogram{Bounds: []float64{1}, Counts: []uint64{0}},
+			wantErr:   true,
+		},
+		{
+			name:      "Invalid count",
+			histogram: Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 1},
+			wantErr:   true,
+		},
+		{
+			name:      "NaN sum",
+			histogram: Histogram{Counts: []uint64{0}, Sum: math.NaN()},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.histogram.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestHistogram_ObserveMerge(t *testing.T) {
+	h := NewHistogram([]float64{1, 2})
+	h.Observe(0.5)
+	h.Observe(1)
+	h.Observe(5)
+	require.NoError(t, h.Validate())
+
+	assert.Equal(t, []uint64{2, 0, 1}, h.Counts)
+	assert.Equal(t, "count=3 sum=6.5 {1:2 2:0 +Inf:1}", h.String())
+
+	merged := h.Clone()
+	require.NoError(t, merged.Merge(h))
+	assert.Equal(t, Histogram{Bounds: []float64{1, 2}, Counts: []uint64{4, 0, 2}, Count: 6, Sum: 13}, merged)
+	assert.Equal(t, []uint64{2, 0, 1}, h.Counts)
+
+	other := NewHistogram([]float64{1, 3})
+	assert.ErrorIs(t, merged.Merge(other), ErrHistogramBoundsMismatch)
+}
+
+func TestMetric_HistogramHash(t *testing.T) {
+	metric := MetricFromHistogram("latency", NewHistogram([]float64{1}))
+	require.NoError(t, metric.Validate())
+	require.NoError(t, metric.UpdateHash("key"))
+
+	valid, err := metric.ValidateHash("key")
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	metric.Histogram.Observe(0.5)
+	valid, err = metric.ValidateHash("key")
+	require.NoError(t, err)
+	assert.False(t, valid)
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Labels are optional name/value pairs that, together with the ID, identify
+// a metric, e.g. {host="a", service="b"}.
+type Labels map[string]string
+
+// LabelsFromStrings parses labels given as "name=value" pairs.
+func LabelsFromStrings(pairs []string) (Labels, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	labels := make(Labels, len(pairs))
+	for _, pair := range pairs {
+		i := strings.IndexByte(pair, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid label %q: missing '='", pair)
+		}
+
+		name, value := pair[:i], pair[i+1:]
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("duplicate label name: %s", name)
+		}
+		labels[name] = value
+	}
+
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+func (l Labels) Validate() error {
+	for name, value := range l {
+		if !isValidLabelName(name) {
+			return fmt.Errorf("invalid label name: %q", name)
+		}
+		if value == "" {
+			return fmt.Errorf("invalid empty value for label: %s", name)
+		}
+	}
+	return nil
+}
+
+// Clone returns labels that don't share the map with l.
+func (l Labels) Clone() Labels {
+	if l == nil {
+		return nil
+	}
+
+	labels := make(Labels, len(l))
+	for name, value := range l {
+		labels[name] = value
+	}
+	return labels
+}
+
+func (l Labels) Names() []string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String returns the canonical form of the labels: pairs sorted by name,
+// e.g. {host="a",service="b"}. Empty labels give an empty string.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range l.Names() {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l[name]))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+func isValidLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
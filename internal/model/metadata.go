@@ -0,0 +1,65 @@
+package model
+
+import (
+	"fmt"
+)
+
+// MaxMetadataFieldLength limits every metadata text field.
+const MaxMetadataFieldLength = 1024
+
+// Metadata describes a metric. It applies to the metric ID, whatever the
+// labels.
+type Metadata struct {
+	ID          MetricName `json:"id"`
+	Unit        string     `json:"unit,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Owner       string     `json:"owner,omitempty"`
+	// Type hints the MetricType the metric is reported with.
+	Type MetricType `json:"type,omitempty"`
+}
+
+func (m Metadata) Validate() error {
+	if err := m.ID.Validate(); err != nil {
+		return err
+	}
+
+	if m.Type != "" {
+		if err := m.Type.Validate(); err != nil {
+			return err
+		}
+	}
+
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"Unit", m.Unit},
+		{"Description", m.Description},
+		{"Owner", m.Owner},
+	}
+	for _, f := range fields {
+		if len(f.value) > MaxMetadataFieldLength {
+			return fmt.Errorf("invalid %s length=%d, at most %d", f.name, len(f.value), MaxMetadataFieldLength)
+		}
+	}
+
+	return nil
+}
+
+// Merge returns the metadata with the non-empty fields of update applied,
+// so that partial updates keep the other fields.
+func (m Metadata) Merge(update Metadata) Metadata {
+	if update.Unit != "" {
+		m.Unit = update.Unit
+	}
+	if update.Description != "" {
+		m.Description = update.Description
+	}
+	if update.Owner != "" {
+		m.Owner = update.Owner
+	}
+	if update.Type != "" {
+		m.Type = update.Type
+	}
+	return m
+}
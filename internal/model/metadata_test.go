@@ -0,0 +1,64 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadata_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata Metadata
+		wantErr  bool
+	}{
+		{
+			name:     "Valid",
+			metadata: Metadata{ID: "Alloc", Unit: "bytes", Description: "Allocated heap objects.", Type: MetricTypeGauge},
+		},
+		{
+			name:     "Without type",
+			metadata: Metadata{ID: "Alloc", Owner: "runtime"},
+		},
+		{
+			name:     "Empty ID",
+			metadata: Metadata{Unit: "bytes"},
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid type",
+			metadata: Metadata{ID: "Alloc", Type: "abrakadabra"},
+			wantErr:  true,
+		},
+		{
+			name:     "Too long description",
+			metadata: Metadata{ID: "Alloc", Description: strings.Repeat("a", MaxMetadataFieldLength+1)},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.metadata.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestMetadata_Merge(t *testing.T) {
+	stored := Metadata{ID: "Alloc", Unit: "bytes", Description: "Allocated heap objects.", Owner: "runtime"}
+
+	merged := stored.Merge(Metadata{ID: "Alloc", Owner: "platform", Type: MetricTypeGauge})
+	assert.Equal(t, Metadata{
+		ID:          "Alloc",
+		Unit:        "bytes",
+		Description: "Allocated heap objects.",
+		Owner:       "platform",
+		Type:        MetricTypeGauge,
+	}, merged)
+}
@@ -3,18 +3,27 @@ package model
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"time"
 
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/common"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ddsketch"
 )
 
 type (
 	Metric struct {
-		ID    MetricName `json:"id"`
-		MType MetricType `json:"type"`
-		Delta *Counter   `json:"delta,omitempty"`
-		Value *Gauge     `json:"value,omitempty"`
-		Hash  string     `json:"hash,omitempty"`
+		ID        MetricName       `json:"id"`
+		MType     MetricType       `json:"type"`
+		Delta     *Counter         `json:"delta,omitempty"`
+		Value     *Gauge           `json:"value,omitempty"`
+		Histogram *Histogram       `json:"histogram,omitempty"`
+		Summary   *ddsketch.Sketch `json:"summary,omitempty"`
+		Hash      string           `json:"hash,omitempty"`
+		Labels    Labels           `json:"labels,omitempty"`
+		// Timestamp is the time the value was sampled at, in unix
+		// milliseconds. Zero means unknown.
+		Timestamp int64 `json:"timestamp,omitempty"`
 	}
 
 	MetricName string
@@ -56,6 +65,12 @@ func MetricFromString(metricName string, metricType MetricType, value string) (M
 		}
 		metric = MetricFromCounter(metricName, counterValue)
 
+	case MetricTypeHistogram:
+		return Metric{}, errors.New("a histogram can't be parsed from a single value")
+
+	case MetricTypeSummary:
+		return Metric{}, errors.New("a summary can't be parsed from a single value")
+
 	default:
 		return Metric{}, fmt.Errorf("unknown MetricType: %s", metricType)
 	}
@@ -76,15 +91,36 @@ func (m Metric) Validate() error {
 		return err
 	}
 
+	if err := m.Labels.Validate(); err != nil {
+		return err
+	}
+
+	if m.Timestamp < 0 {
+		return fmt.Errorf("invalid negative Timestamp=%d", m.Timestamp)
+	}
+
 	switch m.MType {
 	case MetricTypeGauge:
 		if m.Value == nil {
 			return fmt.Errorf("invalid Value == nil for MType: %s", m.MType)
 		}
+		if !m.Value.IsFinite() {
+			return fmt.Errorf("invalid non-finite Value=%v", *m.Value)
+		}
 	case MetricTypeCounter:
 		if m.Delta == nil {
 			return fmt.Errorf("invalid Delta == nil for MType: %s", m.MType)
 		}
+	case MetricTypeHistogram:
+		if m.Histogram == nil {
+			return fmt.Errorf("invalid Histogram == nil for MType: %s", m.MType)
+		}
+		return m.Histogram.Validate()
+	case MetricTypeSummary:
+		if m.Summary == nil {
+			return fmt.Errorf("invalid Summary == nil for MType: %s", m.MType)
+		}
+		return m.Summary.Validate()
 	default:
 		return fmt.Errorf("unknown MetricType: %s", m.MType)
 	}
@@ -106,23 +142,85 @@ func (m Metric) String() string {
 		return (*m.Value).String()
 	case MetricTypeCounter:
 		return (*m.Delta).String()
+	case MetricTypeHistogram:
+		return m.Histogram.String()
+	case MetricTypeSummary:
+		return summaryString(*m.Summary)
 	default:
 		return ""
 	}
 }
 
+// Supersedes reports whether the metric is sampled no earlier than the
+// stored one, so that its value may replace the stored one. Metrics without
+// timestamps, e.g. from older clients, always do.
+func (m Metric) Supersedes(stored Metric) bool {
+	return m.Timestamp == 0 || stored.Timestamp == 0 || m.Timestamp >= stored.Timestamp
+}
+
+// TimestampError is returned for a metric sampled further ahead of the
+// server time than MaxSkew, which would make later writes look out of order.
+type TimestampError struct {
+	ID        MetricName
+	Timestamp int64
+	MaxSkew   time.Duration
+}
+
+func (e *TimestampError) Error() string {
+	return fmt.Sprintf("timestamp %d of %q is more than %s ahead of server time", e.Timestamp, e.ID, e.MaxSkew)
+}
+
+// Clone returns a metric that doesn't share its values or labels with m.
+func (m Metric) Clone() Metric {
+	if m.Delta != nil {
+		delta := *m.Delta
+		m.Delta = &delta
+	}
+	if m.Value != nil {
+		value := *m.Value
+		m.Value = &value
+	}
+	if m.Histogram != nil {
+		h := m.Histogram.Clone()
+		m.Histogram = &h
+	}
+	if m.Summary != nil {
+		s := m.Summary.Clone()
+		m.Summary = &s
+	}
+	m.Labels = m.Labels.Clone()
+	return m
+}
+
+// Key returns the identity of the metric within its MetricType: the ID
+// followed by the labels in canonical form.
+func (m Metric) Key() string {
+	return string(m.ID) + m.Labels.String()
+}
+
 func (m Metric) ProcessHash(key string) (string, error) {
 	var data string
 
+	// Labels are appended to the ID only when present, so hashes of
+	// unlabelled metrics stay compatible with older clients.
 	switch m.MType {
 	case MetricTypeGauge:
-		data = fmt.Sprintf("%s:%s:%f", m.ID, m.MType, float64(*m.Value))
+		data = fmt.Sprintf("%s:%s:%f", m.Key(), m.MType, float64(*m.Value))
 	case MetricTypeCounter:
-		data = fmt.Sprintf("%s:%s:%d", m.ID, m.MType, int64(*m.Delta))
+		data = fmt.Sprintf("%s:%s:%d", m.Key(), m.MType, int64(*m.Delta))
+	case MetricTypeHistogram:
+		data = fmt.Sprintf("%s:%s:%s", m.Key(), m.MType, m.Histogram.hashData())
+	case MetricTypeSummary:
+		data = fmt.Sprintf("%s:%s:%s", m.Key(), m.MType, summaryHashData(*m.Summary))
 	default:
 		return "", fmt.Errorf("unkown MetricType: %s", m.MType)
 	}
 
+	// Likewise, the timestamp is appended only when present.
+	if m.Timestamp != 0 {
+		data = fmt.Sprintf("%s:%d", data, m.Timestamp)
+	}
+
 	hash, err := common.Hash([]byte(data), []byte(key))
 	if err != nil {
 		return "", err
@@ -154,13 +252,15 @@ func (t MetricName) Validate() error {
 }
 
 const (
-	MetricTypeGauge   MetricType = "gauge"
-	MetricTypeCounter MetricType = "counter"
+	MetricTypeGauge     MetricType = "gauge"
+	MetricTypeCounter   MetricType = "counter"
+	MetricTypeHistogram MetricType = "histogram"
+	MetricTypeSummary   MetricType = "summary"
 )
 
 func (t MetricType) Validate() error {
 	switch t {
-	case MetricTypeGauge, MetricTypeCounter:
+	case MetricTypeGauge, MetricTypeCounter, MetricTypeHistogram, MetricTypeSummary:
 		return nil
 	default:
 		return fmt.Errorf("unknown MetricType: %s", t)
@@ -175,9 +275,23 @@ func (g Gauge) String() string {
 	return strconv.FormatFloat(float64(g), 'f', -1, 64)
 }
 
+// IsFinite reports whether the gauge is neither NaN nor an infinity, which
+// can't be encoded in JSON.
+func (g Gauge) IsFinite() bool {
+	return !math.IsNaN(float64(g)) && !math.IsInf(float64(g), 0)
+}
+
 func GaugeFromString(value string) (Gauge, error) {
 	g, err := strconv.ParseFloat(value, 64)
-	return Gauge(g), err
+	if err != nil {
+		return 0, err
+	}
+
+	if !Gauge(g).IsFinite() {
+		return 0, fmt.Errorf("invalid non-finite Gauge value: %s", value)
+	}
+
+	return Gauge(g), nil
 }
 
 func (c Counter) String() string {
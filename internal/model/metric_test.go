@@ -1,10 +1,13 @@
 package model
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/common"
 )
 
 func TestMetric_MetricFromGauge(t *testing.T) {
@@ -171,6 +174,20 @@ func TestMetric_MetricFromString(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:              "gauge NaN",
+			metricName:        "metric5",
+			metricType:        MetricTypeGauge,
+			metricStringValue: "NaN",
+			wantErr:           true,
+		},
+		{
+			name:              "gauge +Inf",
+			metricName:        "metric6",
+			metricType:        MetricTypeGauge,
+			metricStringValue: "+Inf",
+			wantErr:           true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -196,6 +213,12 @@ func TestMetric_MetricFromString(t *testing.T) {
 	}
 }
 
+func TestMetric_ValidateNonFinite(t *testing.T) {
+	assert.NoError(t, MetricFromGauge("metric1", Gauge(1.5)).Validate())
+	assert.Error(t, MetricFromGauge("metric1", Gauge(math.NaN())).Validate())
+	assert.Error(t, MetricFromGauge("metric1", Gauge(math.Inf(-1))).Validate())
+}
+
 func TestMetricTypeValidate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -298,3 +321,156 @@ func TestCounter_String(t *testing.T) {
 
 func TestCounter_CounterFromString(t *testing.T) {
 }
+
+func TestMetric_ProcessHash(t *testing.T) {
+	key := "secret"
+
+	metric := MetricFromGauge("metric1", Gauge(1.5))
+	hash, err := metric.ProcessHash(key)
+	require.NoError(t, err)
+
+	want, err := common.Hash([]byte("metric1:gauge:1.500000"), []byte(key))
+	require.NoError(t, err)
+	assert.Equal(t, want, hash)
+
+	labelled := MetricFromGauge("metric1", Gauge(1.5))
+	labelled.Labels = Labels{"host": "a"}
+	labelledHash, err := labelled.ProcessHash(key)
+	require.NoError(t, err)
+
+	want, err = common.Hash([]byte(`metric1{host="a"}:gauge:1.500000`), []byte(key))
+	require.NoError(t, err)
+	assert.Equal(t, want, labelledHash)
+
+	stamped := MetricFromGauge("metric1", Gauge(1.5))
+	stamped.Timestamp = 1700000000000
+	stampedHash, err := stamped.ProcessHash(key)
+	require.NoError(t, err)
+
+	want, err = common.Hash([]byte("metric1:gauge:1.500000:1700000000000"), []byte(key))
+	require.NoError(t, err)
+	assert.Equal(t, want, stampedHash)
+}
+
+func TestMetric_Supersedes(t *testing.T) {
+	stamped := func(ts int64) Metric {
+		m := MetricFromGauge("metric1", Gauge(1))
+		m.Timestamp = ts
+		return m
+	}
+
+	tests := []struct {
+		name   string
+		metric Metric
+		stored Metric
+		want   bool
+	}{
+		{name: "Newer", metric: stamped(2), stored: stamped(1), want: true},
+		{name: "Same time", metric: stamped(1), stored: stamped(1), want: true},
+		{name: "Older", metric: stamped(1), stored: stamped(2), want: false},
+		{name: "Without timestamp", metric: stamped(0), stored: stamped(2), want: true},
+		{name: "Stored without timestamp", metric: stamped(1), stored: stamped(0), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.metric.Supersedes(tt.stored))
+		})
+	}
+}
+
+func TestMetric_Clone(t *testing.T) {
+	metric := MetricFromCounter("metric", Counter(1))
+	metric.Labels = Labels{"host": "a"}
+
+	clone := metric.Clone()
+	*clone.Delta = 2
+	clone.Labels["host"] = "b"
+
+	assert.Equal(t, Counter(1), *metric.Delta)
+	assert.Equal(t, Labels{"host": "a"}, metric.Labels)
+}
+
+func TestLabels_String(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels Labels
+		want   string
+	}{
+		{
+			name:   "nil labels",
+			labels: nil,
+			want:   "",
+		},
+		{
+			name:   "sorted labels",
+			labels: Labels{"service": "api", "host": "a"},
+			want:   `{host="a",service="api"}`,
+		},
+		{
+			name:   "quoted value",
+			labels: Labels{"path": `a "b"`},
+			want:   `{path="a \"b\""}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.labels.String())
+		})
+	}
+}
+
+func TestLabelsFromStrings(t *testing.T) {
+	tests := []struct {
+		name    string
+		pairs   []string
+		want    Labels
+		wantErr bool
+	}{
+		{
+			name:    "no labels",
+			pairs:   nil,
+			want:    nil,
+			wantErr: false,
+		},
+		{
+			name:    "valid labels",
+			pairs:   []string{"host=a", "addr=127.0.0.1:80"},
+			want:    Labels{"host": "a", "addr": "127.0.0.1:80"},
+			wantErr: false,
+		},
+		{
+			name:    "missing separator",
+			pairs:   []string{"host"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid name",
+			pairs:   []string{"0host=a"},
+			wantErr: true,
+		},
+		{
+			name:    "empty value",
+			pairs:   []string{"host="},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate name",
+			pairs:   []string{"host=a", "host=b"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, err := LabelsFromStrings(tt.pairs)
+			if !tt.wantErr {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, labels)
+				return
+			}
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	DefaultNamePattern   = `^[A-Za-z0-9_.:-]+$`
+	DefaultNameMaxLength = 255
+
+	// nameSeparators are replaced with NamePolicy.Separator.
+	nameSeparators = " ./-_"
+)
+
+type NameCase string
+
+const (
+	NameCasePreserve NameCase = "preserve"
+	NameCaseLower    NameCase = "lower"
+	NameCaseUpper    NameCase = "upper"
+)
+
+func (c NameCase) Validate() error {
+	switch c {
+	case NameCasePreserve, NameCaseLower, NameCaseUpper:
+		return nil
+	default:
+		return fmt.Errorf("unknown NameCase: %s", c)
+	}
+}
+
+// NameError is returned for a metric name rejected by a NamePolicy.
+type NameError struct {
+	ID     MetricName
+	Reason string
+}
+
+func (e *NameError) Error() string {
+	return fmt.Sprintf("invalid metric name %q: %s", e.ID, e.Reason)
+}
+
+// NamePolicy normalises metric names and restricts them before they are
+// stored. The zero value accepts any non-empty name as is.
+type NamePolicy struct {
+	// Pattern must match the whole normalised name. A nil Pattern matches
+	// any name.
+	Pattern *regexp.Regexp
+	// MaxLength limits the length of the normalised name in bytes. Zero
+	// means no limit.
+	MaxLength int
+	// ReservedPrefix can't start the normalised name, e.g. "__".
+	ReservedPrefix string
+	Case           NameCase
+	// Separator replaces spaces, dots, slashes, dashes and underscores. An
+	// empty Separator keeps them as is.
+	Separator string
+}
+
+// Normalise converts the name to the policy case and separator.
+func (p NamePolicy) Normalise(id MetricName) MetricName {
+	name := string(id)
+
+	switch p.Case {
+	case NameCaseLower:
+		name = strings.ToLower(name)
+	case NameCaseUpper:
+		name = strings.ToUpper(name)
+	}
+
+	if p.Separator != "" {
+		var b strings.Builder
+		for _, r := range name {
+			if strings.ContainsRune(nameSeparators, r) {
+				b.WriteString(p.Separator)
+				continue
+			}
+			b.WriteRune(r)
+		}
+		name = b.String()
+	}
+
+	return MetricName(name)
+}
+
+// Apply returns the normalised name, or a *NameError if the policy doesn't
+// allow it.
+func (p NamePolicy) Apply(id MetricName) (MetricName, error) {
+	normalised := p.Normalise(id)
+
+	if err := normalised.Validate(); err != nil {
+		return "", &NameError{ID: id, Reason: "empty name"}
+	}
+
+	if p.MaxLength > 0 && len(normalised) > p.MaxLength {
+		return "", &NameError{ID: id, Reason: fmt.Sprintf("longer than %d bytes", p.MaxLength)}
+	}
+
+	if p.ReservedPrefix != "" && strings.HasPrefix(string(normalised), p.ReservedPrefix) {
+		return "", &NameError{ID: id, Reason: fmt.Sprintf("reserved prefix %q", p.ReservedPrefix)}
+	}
+
+	if p.Pattern != nil && !p.Pattern.MatchString(string(normalised)) {
+		return "", &NameError{ID: id, Reason: fmt.Sprintf("doesn't match %s", p.Pattern)}
+	}
+
+	return normalised, nil
+}
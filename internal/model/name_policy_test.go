@@ -0,0 +1,105 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamePolicy_Apply(t *testing.T) {
+	strict := NamePolicy{
+		Pattern:        regexp.MustCompile(DefaultNamePattern),
+		MaxLength:      16,
+		ReservedPrefix: "__",
+	}
+	normalising := NamePolicy{
+		Pattern:   regexp.MustCompile(`^[a-z0-9_]+$`),
+		Case:      NameCaseLower,
+		Separator: "_",
+	}
+
+	tests := []struct {
+		name    string
+		policy  NamePolicy
+		id      MetricName
+		want    MetricName
+		wantErr bool
+	}{
+		{
+			name:   "Zero policy",
+			policy: NamePolicy{},
+			id:     "any name/at all",
+			want:   "any name/at all",
+		},
+		{
+			name:   "Allowed",
+			policy: strict,
+			id:     "http.requests:1",
+			want:   "http.requests:1",
+		},
+		{
+			name:    "Empty",
+			policy:  NamePolicy{},
+			id:      "",
+			wantErr: true,
+		},
+		{
+			name:    "Slash",
+			policy:  strict,
+			id:      "disk/used",
+			wantErr: true,
+		},
+		{
+			name:    "Space",
+			policy:  strict,
+			id:      "disk used",
+			wantErr: true,
+		},
+		{
+			name:    "Too long",
+			policy:  strict,
+			id:      MetricName(strings.Repeat("a", 17)),
+			wantErr: true,
+		},
+		{
+			name:    "Reserved prefix",
+			policy:  strict,
+			id:      "__internal",
+			wantErr: true,
+		},
+		{
+			name:   "Normalised",
+			policy: normalising,
+			id:     "HTTP.Server-Latency/p99",
+			want:   "http_server_latency_p99",
+		},
+		{
+			name:    "Not allowed after normalisation",
+			policy:  normalising,
+			id:      "disk%",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Apply(tt.id)
+			if tt.wantErr {
+				var nameErr *NameError
+				require.ErrorAs(t, err, &nameErr)
+				assert.Equal(t, tt.id, nameErr.ID)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNameCase_Validate(t *testing.T) {
+	assert.NoError(t, NameCaseLower.Validate())
+	assert.Error(t, NameCase("abrakadabra").Validate())
+}
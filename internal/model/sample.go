@@ -0,0 +1,13 @@
+package model
+
+import (
+	"time"
+)
+
+// Sample is a value of a metric at some point in time. For counters Delta
+// holds the accumulated value rather than an increment.
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Delta     *Counter  `json:"delta,omitempty"`
+	Value     *Gauge    `json:"value,omitempty"`
+}
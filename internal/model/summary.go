@@ -0,0 +1,58 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ddsketch"
+)
+
+// SummaryQuantiles are the quantiles a summary is presented with.
+var SummaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+func MetricFromSummary(id string, s ddsketch.Sketch) Metric {
+	return Metric{
+		ID:      MetricName(id),
+		MType:   MetricTypeSummary,
+		Summary: &s,
+	}
+}
+
+// summaryString lists the count, the sum and the SummaryQuantiles,
+// e.g. "count=3 sum=1.5 {0.5:0.5 0.9:0.7 0.99:0.7}".
+func summaryString(s ddsketch.Sketch) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "count=%d sum=%s {", s.Count, Gauge(s.Sum))
+	for i, q := range SummaryQuantiles {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		v, err := s.Quantile(q)
+		if err != nil {
+			v = 0
+		}
+		fmt.Fprintf(&b, "%s:%s", Gauge(q), Gauge(v))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// summaryHashData lists the sketch fields in the format used for gauges
+// in hashes.
+func summaryHashData(s ddsketch.Sketch) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%f:", s.RelativeAccuracy)
+	for _, bins := range []ddsketch.Bins{s.Positive, s.Negative} {
+		fmt.Fprintf(&b, "%d:", bins.Offset)
+		for _, c := range bins.Counts {
+			fmt.Fprintf(&b, "%d,", c)
+		}
+		b.WriteByte(':')
+	}
+	fmt.Fprintf(&b, "%d:%d:%f:%f:%f", s.ZeroCount, s.Count, s.Sum, s.Min, s.Max)
+
+	return b.String()
+}
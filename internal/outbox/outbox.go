@@ -0,0 +1,311 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+type DropPolicy string
+
+const (
+	// DropOldest evicts the least recently updated metric to make room.
+	DropOldest DropPolicy = "oldest"
+	// DropNewest rejects incoming metrics while the outbox is full.
+	DropNewest DropPolicy = "newest"
+)
+
+func (p DropPolicy) Validate() error {
+	switch p {
+	case DropOldest, DropNewest:
+		return nil
+	default:
+		return fmt.Errorf("unknown DropPolicy: %s", p)
+	}
+}
+
+type Config struct {
+	// File keeps the outbox across restarts. An empty File keeps it in
+	// memory only.
+	File       string
+	MaxSize    int
+	DropPolicy DropPolicy
+}
+
+func (c Config) Validate() error {
+	if c.MaxSize <= 0 {
+		return fmt.Errorf("invalid non-positive MaxSize=%v", c.MaxSize)
+	}
+	return c.DropPolicy.Validate()
+}
+
+type entryKey struct {
+	mType model.MetricType
+	key   string
+}
+
+type entry struct {
+	Seq    uint64       `json:"seq"`
+	Metric model.Metric `json:"metric"`
+}
+
+type state struct {
+	Seq     uint64  `json:"seq"`
+	Entries []entry `json:"entries"`
+}
+
+// Outbox holds metrics that couldn't be delivered. It keeps one entry per
+// metric: counter deltas are summed, histograms and summaries are merged
+// and gauges keep the latest value, so the outbox size is bounded by the
+// number of distinct metrics.
+type Outbox struct {
+	sync.Mutex
+
+	config  Config
+	seq     uint64
+	entries map[entryKey]*entry
+	dropped uint64
+}
+
+func NewOutbox(config Config) (*Outbox, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	o := &Outbox{
+		config:  config,
+		entries: make(map[entryKey]*entry),
+	}
+
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// Put adds metrics to the outbox.
+func (o *Outbox) Put(metrics []model.Metric) error {
+	o.Lock()
+	defer o.Unlock()
+
+	for _, metric := range metrics {
+		o.put(metric, false)
+	}
+
+	return o.save()
+}
+
+// Requeue returns metrics taken by Take after a failed delivery. Gauges that
+// were updated in the meantime keep their newer values.
+func (o *Outbox) Requeue(metrics []model.Metric) error {
+	o.Lock()
+	defer o.Unlock()
+
+	for _, metric := range metrics {
+		o.put(metric, true)
+	}
+
+	return o.save()
+}
+
+// Take removes and returns all metrics in the order they were updated.
+func (o *Outbox) Take() ([]model.Metric, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	if len(o.entries) == 0 {
+		return nil, nil
+	}
+
+	entries := o.sortedEntries()
+	metrics := make([]model.Metric, 0, len(entries))
+	for _, e := range entries {
+		metrics = append(metrics, e.Metric)
+	}
+
+	o.entries = make(map[entryKey]*entry)
+
+	return metrics, o.save()
+}
+
+func (o *Outbox) Len() int {
+	o.Lock()
+	defer o.Unlock()
+
+	return len(o.entries)
+}
+
+// Dropped returns the number of metrics dropped because of the size cap.
+func (o *Outbox) Dropped() uint64 {
+	o.Lock()
+	defer o.Unlock()
+
+	return o.dropped
+}
+
+func (o *Outbox) put(metric model.Metric, requeue bool) {
+	key := entryKey{mType: metric.MType, key: metric.Key()}
+
+	if e, ok := o.entries[key]; ok {
+		switch metric.MType {
+		case model.MetricTypeCounter:
+			delta := *e.Metric.Delta + *metric.Delta
+			e.Metric.Delta = &delta
+		case model.MetricTypeHistogram:
+			// Histograms whose bounds have changed start over.
+			if err := e.Metric.Histogram.Merge(*metric.Histogram); err != nil {
+				e.Metric = cloneMetric(metric)
+			}
+		case model.MetricTypeSummary:
+			// Summaries whose accuracy has changed start over.
+			if err := e.Metric.Summary.Merge(*metric.Summary); err != nil {
+				e.Metric = cloneMetric(metric)
+			}
+		default:
+			if requeue {
+				return
+			}
+			e.Metric = cloneMetric(metric)
+		}
+		if metric.Timestamp > e.Metric.Timestamp {
+			e.Metric.Timestamp = metric.Timestamp
+		}
+		o.seq++
+		e.Seq = o.seq
+		return
+	}
+
+	if len(o.entries) >= o.config.MaxSize {
+		o.dropped++
+		if o.config.DropPolicy == DropNewest {
+			return
+		}
+		o.dropOldest()
+	}
+
+	o.seq++
+	o.entries[key] = &entry{Seq: o.seq, Metric: cloneMetric(metric)}
+}
+
+// cloneMetric copies the metric, so that the outbox doesn't share its values
+// with the caller. The hash is dropped, as it is recalculated on delivery.
+func cloneMetric(metric model.Metric) model.Metric {
+	metric = metric.Clone()
+	metric.Hash = ""
+	return metric
+}
+
+func (o *Outbox) dropOldest() {
+	var oldestKey entryKey
+	var oldest *entry
+
+	for key, e := range o.entries {
+		if oldest == nil || e.Seq < oldest.Seq {
+			oldestKey, oldest = key, e
+		}
+	}
+
+	delete(o.entries, oldestKey)
+}
+
+func (o *Outbox) sortedEntries() []entry {
+	entries := make([]entry, 0, len(o.entries))
+	for _, e := range o.entries {
+		entries = append(entries, *e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Seq < entries[j].Seq
+	})
+
+	return entries
+}
+
+func (o *Outbox) load() error {
+	if o.config.File == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(o.config.File)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("failed to load outbox %s: %w", o.config.File, err)
+	}
+
+	o.seq = st.Seq
+	for i := range st.Entries {
+		e := st.Entries[i]
+		if err := e.Metric.Validate(); err != nil {
+			return fmt.Errorf("failed to load outbox %s: %w", o.config.File, err)
+		}
+		o.entries[entryKey{mType: e.Metric.MType, key: e.Metric.Key()}] = &e
+	}
+
+	return nil
+}
+
+// save atomically replaces the outbox file with the current entries. Callers
+// batch their metrics, as every save rewrites and fsyncs the whole file.
+func (o *Outbox) save() (err error) {
+	if o.config.File == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(state{Seq: o.seq, Entries: o.sortedEntries()})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(o.config.File), filepath.Base(o.config.File)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), o.config.File); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(o.config.File))
+}
+
+// syncDir makes the rename of the outbox file durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,161 @@
+package outbox
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func TestOutbox_Merge(t *testing.T) {
+	o, err := NewOutbox(Config{MaxSize: 10, DropPolicy: DropOldest})
+	require.NoError(t, err)
+
+	require.NoError(t, o.Put([]model.Metric{
+		model.MetricFromCounter("metric1", model.Counter(1)),
+		model.MetricFromGauge("metric2", model.Gauge(1)),
+		model.MetricFromCounter("metric1", model.Counter(2)),
+		model.MetricFromGauge("metric2", model.Gauge(2)),
+	}))
+	assert.Equal(t, 2, o.Len())
+
+	metrics, err := o.Take()
+	require.NoError(t, err)
+	assert.Equal(t, []model.Metric{
+		model.MetricFromCounter("metric1", model.Counter(3)),
+		model.MetricFromGauge("metric2", model.Gauge(2)),
+	}, metrics)
+	assert.Zero(t, o.Len())
+}
+
+func TestOutbox_MergeHistogram(t *testing.T) {
+	o, err := NewOutbox(Config{MaxSize: 10, DropPolicy: DropOldest})
+	require.NoError(t, err)
+
+	h := model.NewHistogram([]float64{1})
+	h.Observe(0.5)
+
+	require.NoError(t, o.Put([]model.Metric{
+		model.MetricFromHistogram("metric1", h),
+		model.MetricFromHistogram("metric1", h),
+	}))
+
+	metrics, err := o.Take()
+	require.NoError(t, err)
+	assert.Equal(t, []model.Metric{
+		model.MetricFromHistogram("metric1", model.Histogram{
+			Bounds: []float64{1},
+			Counts: []uint64{2, 0},
+			Count:  2,
+			Sum:    1,
+		}),
+	}, metrics)
+	assert.Equal(t, []uint64{1, 0}, h.Counts)
+}
+
+func TestOutbox_Requeue(t *testing.T) {
+	o, err := NewOutbox(Config{MaxSize: 10, DropPolicy: DropOldest})
+	require.NoError(t, err)
+
+	require.NoError(t, o.Put([]model.Metric{
+		model.MetricFromCounter("metric1", model.Counter(1)),
+		model.MetricFromGauge("metric2", model.Gauge(1)),
+	}))
+
+	taken, err := o.Take()
+	require.NoError(t, err)
+
+	require.NoError(t, o.Put([]model.Metric{
+		model.MetricFromCounter("metric1", model.Counter(2)),
+		model.MetricFromGauge("metric2", model.Gauge(2)),
+	}))
+	require.NoError(t, o.Requeue(taken))
+
+	metrics, err := o.Take()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []model.Metric{
+		model.MetricFromCounter("metric1", model.Counter(3)),
+		model.MetricFromGauge("metric2", model.Gauge(2)),
+	}, metrics)
+}
+
+func TestOutbox_DropPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		dropPolicy DropPolicy
+		want       []model.Metric
+	}{
+		{
+			name:       "drop oldest",
+			dropPolicy: DropOldest,
+			want: []model.Metric{
+				model.MetricFromGauge("metric2", model.Gauge(2)),
+				model.MetricFromGauge("metric3", model.Gauge(3)),
+			},
+		},
+		{
+			name:       "drop newest",
+			dropPolicy: DropNewest,
+			want: []model.Metric{
+				model.MetricFromGauge("metric1", model.Gauge(1)),
+				model.MetricFromGauge("metric2", model.Gauge(2)),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := NewOutbox(Config{MaxSize: 2, DropPolicy: tt.dropPolicy})
+			require.NoError(t, err)
+
+			require.NoError(t, o.Put([]model.Metric{
+				model.MetricFromGauge("metric1", model.Gauge(1)),
+				model.MetricFromGauge("metric2", model.Gauge(2)),
+				model.MetricFromGauge("metric3", model.Gauge(3)),
+			}))
+			assert.Equal(t, uint64(1), o.Dropped())
+
+			metrics, err := o.Take()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, metrics)
+		})
+	}
+}
+
+func TestOutbox_Persistence(t *testing.T) {
+	cfg := Config{
+		File:       filepath.Join(t.TempDir(), "outbox.json"),
+		MaxSize:    10,
+		DropPolicy: DropOldest,
+	}
+
+	o, err := NewOutbox(cfg)
+	require.NoError(t, err)
+	require.NoError(t, o.Put([]model.Metric{
+		model.MetricFromCounter("metric1", model.Counter(1)),
+		model.MetricFromGauge("metric2", model.Gauge(2)),
+	}))
+
+	o, err = NewOutbox(cfg)
+	require.NoError(t, err)
+	require.NoError(t, o.Put([]model.Metric{
+		model.MetricFromCounter("metric1", model.Counter(4)),
+	}))
+
+	o, err = NewOutbox(cfg)
+	require.NoError(t, err)
+
+	metrics, err := o.Take()
+	require.NoError(t, err)
+	assert.Equal(t, []model.Metric{
+		model.MetricFromGauge("metric2", model.Gauge(2)),
+		model.MetricFromCounter("metric1", model.Counter(5)),
+	}, metrics)
+
+	o, err = NewOutbox(cfg)
+	require.NoError(t, err)
+	assert.Zero(t, o.Len())
+}
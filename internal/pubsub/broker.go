@@ -0,0 +1,236 @@
+package pubsub
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+const (
+	DefaultBufferSize = 100
+	DefaultDropPolicy = DropOldest
+)
+
+type DropPolicy string
+
+const (
+	// DropOldest evicts the oldest buffered update to make room.
+	DropOldest DropPolicy = "oldest"
+	// DropNewest rejects incoming updates while the buffer is full.
+	DropNewest DropPolicy = "newest"
+)
+
+func (p DropPolicy) Validate() error {
+	switch p {
+	case DropOldest, DropNewest:
+		return nil
+	default:
+		return fmt.Errorf("unknown DropPolicy: %s", p)
+	}
+}
+
+// MetricKey identifies a metric, labels included, across the metric types.
+type MetricKey struct {
+	MType model.MetricType
+	Key   string
+}
+
+func KeyOf(metric model.Metric) MetricKey {
+	return MetricKey{MType: metric.MType, Key: metric.Key()}
+}
+
+// Filter selects the updates delivered to a subscriber. Empty fields match
+// every update, except for Keys: a non-nil Keys matches only the metrics it
+// contains.
+type Filter struct {
+	Types  []model.MetricType
+	Prefix string
+	Keys   map[MetricKey]struct{}
+}
+
+func (f Filter) Match(metric model.Metric) bool {
+	if !strings.HasPrefix(string(metric.ID), f.Prefix) {
+		return false
+	}
+
+	if f.Keys != nil {
+		if _, ok := f.Keys[KeyOf(metric)]; !ok {
+			return false
+		}
+	}
+
+	if len(f.Types) == 0 {
+		return true
+	}
+
+	for _, mType := range f.Types {
+		if mType == metric.MType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Subscription buffers up to BufferSize updates. A subscriber that doesn't
+// keep up loses updates according to the DropPolicy, so publishing never
+// blocks.
+type Subscription struct {
+	C <-chan model.Metric
+
+	c       chan model.Metric
+	filter  Filter
+	policy  DropPolicy
+	dropped uint64
+}
+
+// Dropped returns the number of updates lost by the subscriber.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Broker fans out metric updates to subscribers.
+type Broker struct {
+	sync.Mutex
+
+	bufferSize int
+	policy     DropPolicy
+	subs       map[*Subscription]struct{}
+	closed     bool
+}
+
+func NewBroker(bufferSize int, policy DropPolicy) (*Broker, error) {
+	if bufferSize <= 0 {
+		return nil, fmt.Errorf("invalid non-positive bufferSize=%v", bufferSize)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Broker{
+		bufferSize: bufferSize,
+		policy:     policy,
+		subs:       make(map[*Subscription]struct{}),
+	}, nil
+}
+
+// Subscribe returns a subscription whose channel is closed by Unsubscribe or
+// Close.
+func (b *Broker) Subscribe(filter Filter) *Subscription {
+	c := make(chan model.Metric, b.bufferSize)
+	s := &Subscription{
+		C:      c,
+		c:      c,
+		filter: filter,
+		policy: b.policy,
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		close(c)
+		return s
+	}
+	b.subs[s] = struct{}{}
+
+	return s
+}
+
+// SetFilter replaces the filter of an active subscription. The filter must
+// not be modified afterwards.
+func (b *Broker) SetFilter(s *Subscription, filter Filter) {
+	b.Lock()
+	defer b.Unlock()
+
+	s.filter = filter
+}
+
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.c)
+	}
+}
+
+// Close unsubscribes all the subscribers.
+func (b *Broker) Close() {
+	b.Lock()
+	defer b.Unlock()
+
+	for s := range b.subs {
+		close(s.c)
+	}
+	b.subs = make(map[*Subscription]struct{})
+	b.closed = true
+}
+
+// SubscriberCount returns the number of active subscribers.
+func (b *Broker) SubscriberCount() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return len(b.subs)
+}
+
+// Publish delivers metrics to the matching subscribers without blocking.
+func (b *Broker) Publish(metrics []model.Metric) {
+	b.Lock()
+	defer b.Unlock()
+
+	if len(b.subs) == 0 {
+		return
+	}
+
+	for _, metric := range metrics {
+		metric = cloneMetric(metric)
+		for s := range b.subs {
+			if s.filter.Match(metric) {
+				s.send(metric)
+			}
+		}
+	}
+}
+
+// send is called with the broker locked, so the subscription has a single
+// sender.
+func (s *Subscription) send(metric model.Metric) {
+	select {
+	case s.c <- metric:
+		return
+	default:
+	}
+
+	if s.policy == DropNewest {
+		atomic.AddUint64(&s.dropped, 1)
+		return
+	}
+
+	// The subscriber may have taken the oldest update in the meantime, so it
+	// is dropped only if it is still buffered. Either way, there is room now.
+	select {
+	case <-s.c:
+		atomic.AddUint64(&s.dropped, 1)
+	default:
+	}
+
+	select {
+	case s.c <- metric:
+	default:
+	}
+}
+
+// cloneMetric copies the metric, so that subscribers don't share its values
+// with the publisher. The hash is dropped, as it signs the original request.
+func cloneMetric(metric model.Metric) model.Metric {
+	metric = metric.Clone()
+	metric.Hash = ""
+	return metric
+}
@@ -0,0 +1,179 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func receive(s *Subscription) []model.Metric {
+	var metrics []model.Metric
+	for {
+		select {
+		case metric, ok := <-s.C:
+			if !ok {
+				return metrics
+			}
+			metrics = append(metrics, metric)
+		default:
+			return metrics
+		}
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	gauge := model.MetricFromGauge("CPUutilization1", model.Gauge(1))
+	counter := model.MetricFromCounter("PollCount", model.Counter(1))
+
+	tests := []struct {
+		name   string
+		filter Filter
+		metric model.Metric
+		want   bool
+	}{
+		{
+			name:   "Empty filter",
+			metric: gauge,
+			want:   true,
+		},
+		{
+			name:   "Type",
+			filter: Filter{Types: []model.MetricType{model.MetricTypeCounter}},
+			metric: counter,
+			want:   true,
+		},
+		{
+			name:   "Other type",
+			filter: Filter{Types: []model.MetricType{model.MetricTypeCounter}},
+			metric: gauge,
+			want:   false,
+		},
+		{
+			name:   "Prefix",
+			filter: Filter{Prefix: "CPU"},
+			metric: gauge,
+			want:   true,
+		},
+		{
+			name: "Key",
+			filter: Filter{Keys: map[MetricKey]struct{}{
+				KeyOf(counter): {},
+			}},
+			metric: counter,
+			want:   true,
+		},
+		{
+			name:   "No keys",
+			filter: Filter{Keys: map[MetricKey]struct{}{}},
+			metric: counter,
+			want:   false,
+		},
+		{
+			name:   "Other prefix",
+			filter: Filter{Prefix: "CPU"},
+			metric: counter,
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(tt.metric))
+		})
+	}
+}
+
+func TestBroker_Publish(t *testing.T) {
+	b, err := NewBroker(10, DropOldest)
+	require.NoError(t, err)
+
+	all := b.Subscribe(Filter{})
+	counters := b.Subscribe(Filter{Types: []model.MetricType{model.MetricTypeCounter}})
+
+	metric := model.MetricFromGauge("Alloc", model.Gauge(1))
+	metric.Hash = "hash"
+	b.Publish([]model.Metric{
+		metric,
+		model.MetricFromCounter("PollCount", model.Counter(1)),
+	})
+
+	assert.Equal(t, []model.Metric{
+		model.MetricFromGauge("Alloc", model.Gauge(1)),
+		model.MetricFromCounter("PollCount", model.Counter(1)),
+	}, receive(all))
+	assert.Equal(t, []model.Metric{
+		model.MetricFromCounter("PollCount", model.Counter(1)),
+	}, receive(counters))
+
+	b.SetFilter(all, Filter{Prefix: "Poll"})
+	b.Publish([]model.Metric{
+		model.MetricFromGauge("Alloc", model.Gauge(2)),
+		model.MetricFromCounter("PollCount", model.Counter(2)),
+	})
+	assert.Equal(t, []model.Metric{
+		model.MetricFromCounter("PollCount", model.Counter(2)),
+	}, receive(all))
+	assert.Len(t, receive(counters), 1)
+
+	b.Unsubscribe(all)
+	_, ok := <-all.C
+	assert.False(t, ok)
+	assert.Equal(t, 1, b.SubscriberCount())
+
+	b.Close()
+	_, ok = <-counters.C
+	assert.False(t, ok)
+	assert.Equal(t, 0, b.SubscriberCount())
+
+	_, ok = <-b.Subscribe(Filter{}).C
+	assert.False(t, ok)
+}
+
+func TestBroker_DropPolicy(t *testing.T) {
+	metrics := []model.Metric{
+		model.MetricFromCounter("PollCount", model.Counter(1)),
+		model.MetricFromCounter("PollCount", model.Counter(2)),
+		model.MetricFromCounter("PollCount", model.Counter(3)),
+	}
+
+	tests := []struct {
+		name   string
+		policy DropPolicy
+		want   []model.Metric
+	}{
+		{
+			name:   "Oldest",
+			policy: DropOldest,
+			want:   metrics[1:],
+		},
+		{
+			name:   "Newest",
+			policy: DropNewest,
+			want:   metrics[:2],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBroker(2, tt.policy)
+			require.NoError(t, err)
+
+			s := b.Subscribe(Filter{})
+			b.Publish(metrics)
+
+			assert.Equal(t, tt.want, receive(s))
+			assert.Equal(t, uint64(1), s.Dropped())
+		})
+	}
+}
+
+func TestNewBrokerInvalidConfig(t *testing.T) {
+	_, err := NewBroker(0, DropOldest)
+	assert.Error(t, err)
+
+	_, err = NewBroker(1, DropPolicy("all"))
+	assert.Error(t, err)
+}
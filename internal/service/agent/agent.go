@@ -2,20 +2,14 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
-	"net/http"
-	"runtime"
 	"sync"
-	"sync/atomic"
 	"time"
 
-	"github.com/go-resty/resty/v2"
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/mem"
-
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/outbox"
 )
 
 const (
@@ -27,9 +21,72 @@ const (
 	DefaultPollInterval        = 02 * time.Second
 	DefaultReportInterval      = 10 * time.Second
 	DefaultPollMetricsBuffSize = 100
+	DefaultWindowMaxSize       = 10000
 	DefaultPostWorkersPoolSize = 15
+	DefaultReportMode          = ReportModeSingle
+	DefaultTransport           = TransportHTTP
+	DefaultOutboxMaxSize       = 10000
+	DefaultOutboxDropPolicy    = outbox.DropOldest
+)
+
+var (
+	DefaultCollectors = CollectorList{
+		CollectorMemStats,
+		CollectorRandom,
+		CollectorPollCount,
+		CollectorGopsutil,
+	}
+	DefaultNetExclude = PatternList{"lo"}
+)
+
+type ReportMode string
+
+const (
+	// ReportModeSingle posts every metric in its own request to /update/.
+	ReportModeSingle ReportMode = "single"
+	// ReportModeBatch posts all metrics of a report in one request to
+	// /updates/. It is opt-in, as older servers don't serve /updates/.
+	ReportModeBatch ReportMode = "batch"
 )
 
+func (m ReportMode) Validate() error {
+	switch m {
+	case ReportModeSingle, ReportModeBatch:
+		return nil
+	default:
+		return fmt.Errorf("unknown ReportMode: %s", m)
+	}
+}
+
+type TransportType string
+
+const (
+	TransportHTTP TransportType = "http"
+	TransportGRPC TransportType = "grpc"
+)
+
+func (t TransportType) Validate() error {
+	switch t {
+	case TransportHTTP, TransportGRPC:
+		return nil
+	default:
+		return fmt.Errorf("unknown TransportType: %s", t)
+	}
+}
+
+// ErrMetadataNotSupported is returned by PostMetadataList if the server
+// doesn't keep metadata, so that the agent stops posting it.
+var ErrMetadataNotSupported = errors.New("metadata is not supported by the server")
+
+// Transport delivers metrics to the server. PostMetadataList seeds the
+// metadata: the server stores it only for the metrics that have none.
+type Transport interface {
+	PostMetric(ctx context.Context, metric model.Metric) error
+	PostMetricList(ctx context.Context, metrics []model.Metric) error
+	PostMetadataList(ctx context.Context, list []model.Metadata) error
+	Close() error
+}
+
 type Config struct {
 	PollInterval        time.Duration `env:"POLL_INTERVAL"`
 	ReportInterval      time.Duration `env:"REPORT_INTERVAL"`
@@ -39,8 +96,33 @@ type Config struct {
 	RetryWaitTime       time.Duration
 	RetryMaxWaitTime    time.Duration
 	Key                 string `env:"KEY"`
+	// SendTimestamps stamps metrics with their poll time, so that the server
+	// ignores late retries. Servers that predate timestamps reject the
+	// hashes of stamped metrics, so it is off by default.
+	SendTimestamps bool `env:"SEND_TIMESTAMPS"`
+	// PollMetricsBuffSize is the number of distinct metrics the report window
+	// is allocated for.
 	PollMetricsBuffSize int
+	// WindowMaxSize limits the number of distinct metrics aggregated between
+	// reports. Metrics beyond it are spilled into the outbox.
+	WindowMaxSize       int `env:"WINDOW_MAX_SIZE"`
 	PostWorkersPoolSize int
+	ReportMode          ReportMode        `env:"REPORT_MODE"`
+	Transport           TransportType     `env:"TRANSPORT"`
+	OutboxFile          string            `env:"OUTBOX_FILE"`
+	OutboxMaxSize       int               `env:"OUTBOX_MAX_SIZE"`
+	OutboxDropPolicy    outbox.DropPolicy `env:"OUTBOX_DROP_POLICY"`
+	// Collectors lists the registered collectors to poll.
+	Collectors         CollectorList      `env:"COLLECTORS"`
+	CollectorIntervals CollectorIntervals `env:"COLLECTOR_INTERVALS"`
+	DiskInclude        PatternList        `env:"DISK_INCLUDE"`
+	DiskExclude        PatternList        `env:"DISK_EXCLUDE"`
+	NetInclude         PatternList        `env:"NET_INCLUDE"`
+	NetExclude         PatternList        `env:"NET_EXCLUDE"`
+	CgroupRoot         string             `env:"CGROUP_ROOT"`
+	// GaugeAggregations are reported for every gauge in addition to its last
+	// value, as gauges labelled with AggregationLabel.
+	GaugeAggregations GaugeAggregationList `env:"GAUGE_AGGREGATIONS"`
 }
 
 func (c Config) Validate() error {
@@ -53,45 +135,69 @@ func (c Config) Validate() error {
 	if c.PollMetricsBuffSize < 0 {
 		return fmt.Errorf("invalid negative PollMetricsBuffSize=%v", c.PollMetricsBuffSize)
 	}
+	if c.WindowMaxSize <= 0 {
+		return fmt.Errorf("invalid non-positive WindowMaxSize=%v", c.WindowMaxSize)
+	}
 	if c.PostWorkersPoolSize <= 0 {
 		return fmt.Errorf("invalid non-positive PostWorkersPoolSize=%v", c.PostWorkersPoolSize)
 	}
+	if err := c.ReportMode.Validate(); err != nil {
+		return err
+	}
+	if err := c.Transport.Validate(); err != nil {
+		return err
+	}
+	if err := c.CollectorIntervals.Validate(); err != nil {
+		return err
+	}
+	if err := c.GaugeAggregations.Validate(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 type Agent struct {
-	config    Config
-	client    *resty.Client
-	updateURL string
-	metrics   chan model.Metric
-	pollCount int64
+	config     Config
+	transport  Transport
+	collectors []Collector
+	window     *window
+	outbox     *outbox.Outbox
+	metadata   *metadataSeeder
+	now        func() time.Time
 }
 
-func NewAgent(config Config, updateURL string) (*Agent, error) {
+func NewAgent(config Config, transport Transport) (*Agent, error) {
+	if transport == nil {
+		return nil, errors.New("invalid transport value: nil")
+	}
+
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
 
-	t := &http.Transport{}
-	t.MaxIdleConns = config.MaxIdleConns
-	t.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
-
-	httpClient := &http.Client{
-		Transport: t,
+	collectors, err := newCollectors(config)
+	if err != nil {
+		return nil, err
 	}
 
-	client := resty.NewWithClient(httpClient)
-	client.
-		SetRetryCount(config.RetryCount).
-		SetRetryWaitTime(config.RetryWaitTime).
-		SetRetryMaxWaitTime(config.RetryMaxWaitTime)
+	ob, err := outbox.NewOutbox(outbox.Config{
+		File:       config.OutboxFile,
+		MaxSize:    config.OutboxMaxSize,
+		DropPolicy: config.OutboxDropPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	a := &Agent{
-		config:    config,
-		client:    client,
-		updateURL: updateURL,
-		metrics:   make(chan model.Metric, config.PollMetricsBuffSize),
+		config:     config,
+		transport:  transport,
+		collectors: collectors,
+		window:     newWindow(config.WindowMaxSize, config.PollMetricsBuffSize, config.GaugeAggregations),
+		outbox:     ob,
+		metadata:   newMetadataSeeder(),
+		now:        time.Now,
 	}
 
 	return a, nil
@@ -100,191 +206,223 @@ func NewAgent(config Config, updateURL string) (*Agent, error) {
 func (a *Agent) Run(ctx context.Context) error {
 	wg := &sync.WaitGroup{}
 	wg.Add(2)
-	defer wg.Wait()
 
 	go a.pollMetrics(ctx, wg)
 	go a.postMetrics(ctx, wg)
 
-	return nil
+	wg.Wait()
+
+	// Keep metrics that haven't been reported for the next run.
+	return a.outbox.Put(a.window.drain())
 }
 
+// pollMetrics runs every collector in its own goroutine, so that each one
+// is polled at its own interval.
 func (a *Agent) pollMetrics(ctx context.Context, wg *sync.WaitGroup) {
-	ticker := time.NewTicker(a.config.PollInterval)
-	defer ticker.Stop()
 	defer wg.Done()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			a.pollMemStatsMetrics(ctx)
-			a.pollRandomValueMetric(ctx)
-			a.pollCountMetric(ctx)
-			a.pollGopsutilMetrics(ctx)
-		}
+	collectorsWG := &sync.WaitGroup{}
+	defer collectorsWG.Wait()
+
+	for _, c := range a.collectors {
+		collectorsWG.Add(1)
+		go func(c Collector) {
+			defer collectorsWG.Done()
+			a.runCollector(ctx, c)
+		}(c)
 	}
 }
 
-func (a *Agent) queueMetric(ctx context.Context, metric model.Metric) {
-	select {
-	case <-ctx.Done():
-		return
-	case a.metrics <- metric:
+// queueMetrics aggregates the metrics into the current report window. When
+// the window is full, the metrics are spilled into the outbox in one write.
+// With SendTimestamps the metrics are stamped with the poll time, so that
+// the server ignores late retries.
+func (a *Agent) queueMetrics(metrics ...model.Metric) {
+	now := a.now().UnixMilli()
+
+	var spilled []model.Metric
+	for _, metric := range metrics {
+		if a.config.SendTimestamps && metric.Timestamp == 0 {
+			metric.Timestamp = now
+		}
+
+		a.metadata.observe(metric.ID)
+
+		if !a.window.add(metric) {
+			spilled = append(spilled, metric)
+		}
+	}
+
+	if len(spilled) == 0 {
 		return
 	}
-}
 
-func (a *Agent) pollMemStatsMetrics(ctx context.Context) {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	a.queueMetric(ctx, model.MetricFromGauge("Alloc", model.Gauge(m.Alloc)))
-	a.queueMetric(ctx, model.MetricFromGauge("TotalAlloc", model.Gauge(m.TotalAlloc)))
-	a.queueMetric(ctx, model.MetricFromGauge("BuckHashSys", model.Gauge(m.BuckHashSys)))
-	a.queueMetric(ctx, model.MetricFromGauge("Frees", model.Gauge(m.Frees)))
-	a.queueMetric(ctx, model.MetricFromGauge("GCCPUFraction", model.Gauge(m.GCCPUFraction)))
-	a.queueMetric(ctx, model.MetricFromGauge("GCSys", model.Gauge(m.GCSys)))
-	a.queueMetric(ctx, model.MetricFromGauge("HeapAlloc", model.Gauge(m.HeapAlloc)))
-	a.queueMetric(ctx, model.MetricFromGauge("HeapIdle", model.Gauge(m.HeapIdle)))
-	a.queueMetric(ctx, model.MetricFromGauge("HeapInuse", model.Gauge(m.HeapInuse)))
-	a.queueMetric(ctx, model.MetricFromGauge("HeapObjects", model.Gauge(m.HeapObjects)))
-	a.queueMetric(ctx, model.MetricFromGauge("HeapReleased", model.Gauge(m.HeapReleased)))
-	a.queueMetric(ctx, model.MetricFromGauge("HeapSys", model.Gauge(m.HeapSys)))
-	a.queueMetric(ctx, model.MetricFromGauge("LastGC", model.Gauge(m.LastGC)))
-	a.queueMetric(ctx, model.MetricFromGauge("Lookups", model.Gauge(m.Lookups)))
-	a.queueMetric(ctx, model.MetricFromGauge("MCacheInuse", model.Gauge(m.MCacheInuse)))
-	a.queueMetric(ctx, model.MetricFromGauge("MCacheSys", model.Gauge(m.MCacheSys)))
-	a.queueMetric(ctx, model.MetricFromGauge("MSpanInuse", model.Gauge(m.MSpanInuse)))
-	a.queueMetric(ctx, model.MetricFromGauge("MSpanSys", model.Gauge(m.MSpanSys)))
-	a.queueMetric(ctx, model.MetricFromGauge("Mallocs", model.Gauge(m.Mallocs)))
-	a.queueMetric(ctx, model.MetricFromGauge("NextGC", model.Gauge(m.NextGC)))
-	a.queueMetric(ctx, model.MetricFromGauge("NumForcedGC", model.Gauge(m.NumForcedGC)))
-	a.queueMetric(ctx, model.MetricFromGauge("NumGC", model.Gauge(m.NumGC)))
-	a.queueMetric(ctx, model.MetricFromGauge("OtherSys", model.Gauge(m.OtherSys)))
-	a.queueMetric(ctx, model.MetricFromGauge("PauseTotalNs", model.Gauge(m.PauseTotalNs)))
-	a.queueMetric(ctx, model.MetricFromGauge("StackInuse", model.Gauge(m.StackInuse)))
-	a.queueMetric(ctx, model.MetricFromGauge("StackSys", model.Gauge(m.StackSys)))
-	a.queueMetric(ctx, model.MetricFromGauge("Sys", model.Gauge(m.Sys)))
+	if err := a.outbox.Put(spilled); err != nil {
+		log.Printf("failed to put %d metrics into outbox: %v", len(spilled), err)
+	}
 }
 
-func (a *Agent) pollRandomValueMetric(ctx context.Context) {
-	randomValue := rand.Float64()
-	a.queueMetric(ctx, model.MetricFromGauge("RandomValue", model.Gauge(randomValue)))
-}
+func (a *Agent) postMetrics(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
 
-func (a *Agent) pollCountMetric(ctx context.Context) {
-	pollCount := atomic.AddInt64(&a.pollCount, 1)
-	a.queueMetric(ctx, model.MetricFromCounter("PollCount", model.Counter(pollCount)))
+	switch a.config.ReportMode {
+	case ReportModeBatch:
+		a.postMetricBatches(ctx)
+	default:
+		a.postMetricsOneByOne(ctx)
+	}
 }
 
-func (a *Agent) pollGopsutilMetrics(ctx context.Context) {
-	if err := a.pollGopsutilMemoryMetrics(ctx); err != nil {
-		log.Printf("failed to poll gopsutil memory metrics: %v", err)
-	}
+// requeueMetrics returns undelivered metrics to the outbox.
+func (a *Agent) requeueMetrics(metrics []model.Metric, err error) {
+	log.Printf("failed to post %d metrics: %v", len(metrics), err)
 
-	if err := a.pollGopsutilCPUMetrics(ctx); err != nil {
-		log.Printf("failed to poll gopsutil cpu metrics: %v", err)
+	if err := a.outbox.Requeue(metrics); err != nil {
+		log.Printf("failed to requeue metrics into outbox: %v", err)
 	}
 }
 
-func (a *Agent) pollGopsutilMemoryMetrics(ctx context.Context) error {
-	v, err := mem.VirtualMemoryWithContext(ctx)
-	if err != nil {
-		return err
-	}
+func (a *Agent) postMetricBatches(ctx context.Context) {
+	ticker := time.NewTicker(a.config.ReportInterval)
+	defer ticker.Stop()
 
-	a.queueMetric(ctx, model.MetricFromGauge("TotalMemory", model.Gauge(v.Total)))
-	a.queueMetric(ctx, model.MetricFromGauge("FreeMemory", model.Gauge(v.Free)))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.postMetadata(ctx)
 
-	return nil
-}
+			metrics, err := a.outbox.Take()
+			if err != nil {
+				log.Printf("failed to take metrics from outbox: %v", err)
+			}
 
-func (a *Agent) pollGopsutilCPUMetrics(ctx context.Context) error {
-	times, err := cpu.TimesWithContext(ctx, true)
-	if err != nil {
-		return err
-	}
+			metrics = append(metrics, a.window.drain()...)
+			if len(metrics) == 0 {
+				continue
+			}
 
-	for i, timesStat := range times {
-		a.queueMetric(
-			ctx,
-			model.MetricFromGauge(
-				fmt.Sprintf("CPUutilization%d", i),
-				model.Gauge(timesStat.User+timesStat.System),
-			))
+			if err := a.postMetricList(ctx, metrics); err != nil {
+				a.requeueMetrics(metrics, err)
+			}
+		}
 	}
-
-	return nil
 }
 
-func (a *Agent) postMetrics(ctx context.Context, wg *sync.WaitGroup) {
+func (a *Agent) postMetricsOneByOne(ctx context.Context) {
 	ticker := time.NewTicker(a.config.ReportInterval)
 	defer ticker.Stop()
-	defer wg.Done()
 
-	done := false
-	signal := sync.NewCond(&sync.Mutex{})
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.postMetadata(ctx)
+			a.postOutbox(ctx)
+			a.postMetricsConcurrently(ctx, a.window.drain())
+		}
+	}
+}
 
-	for i := 0; i < a.config.PostWorkersPoolSize; i++ {
+// postMetricsConcurrently posts metrics one by one with a pool of
+// PostWorkersPoolSize workers. Undelivered metrics are requeued together once
+// the workers are done.
+func (a *Agent) postMetricsConcurrently(ctx context.Context, metrics []model.Metric) {
+	jobs := make(chan model.Metric)
+
+	var failedMu sync.Mutex
+	var failed []model.Metric
+	var failedErr error
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < a.config.PostWorkersPoolSize && i < len(metrics); i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 
-			for {
-				signal.L.Lock()
-				if !done {
-					signal.Wait()
-					signal.L.Unlock()
-
-				postLoop:
-					for {
-						select {
-						case <-ctx.Done():
-							return
-						case metric := <-a.metrics:
-							if err := a.postOneMetric(ctx, metric); err != nil {
-								log.Printf("failed to post %v: %v", metric, err)
-							}
-						default:
-							break postLoop
-						}
-					}
-
-					continue
+			for metric := range jobs {
+				if err := a.postOneMetric(ctx, metric); err != nil {
+					failedMu.Lock()
+					failed = append(failed, metric)
+					failedErr = err
+					failedMu.Unlock()
 				}
-
-				signal.L.Unlock()
-				return
 			}
 		}()
 	}
 
-	for {
+	for i, metric := range metrics {
 		select {
 		case <-ctx.Done():
-			signal.L.Lock()
-			done = true
-			signal.Broadcast()
-			signal.L.Unlock()
+			close(jobs)
+			wg.Wait()
+			a.requeueMetrics(append(failed, metrics[i:]...), ctx.Err())
+			return
+		case jobs <- metric:
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		a.requeueMetrics(failed, failedErr)
+	}
+}
+
+// postOutbox retries delivery of the metrics from the outbox one by one,
+// stopping at the first failure.
+func (a *Agent) postOutbox(ctx context.Context) {
+	metrics, err := a.outbox.Take()
+	if err != nil {
+		log.Printf("failed to take metrics from outbox: %v", err)
+	}
+
+	for i, metric := range metrics {
+		if err := a.postOneMetric(ctx, metric); err != nil {
+			a.requeueMetrics(metrics[i:], err)
 			return
-		case <-ticker.C:
-			signal.L.Lock()
-			signal.Broadcast()
-			signal.L.Unlock()
 		}
 	}
 }
 
+// postMetadata posts the metadata of newly seen built-in metrics. Metadata
+// that couldn't be delivered is retried on the next report, unless the
+// server doesn't keep metadata at all.
+func (a *Agent) postMetadata(ctx context.Context) {
+	list := a.metadata.take()
+	if len(list) == 0 {
+		return
+	}
+
+	err := a.transport.PostMetadataList(ctx, list)
+	if errors.Is(err, ErrMetadataNotSupported) {
+		log.Printf("stopped posting metadata: %v", err)
+		a.metadata.disable()
+		return
+	}
+	if err != nil {
+		log.Printf("failed to post metadata of %d metrics: %v", len(list), err)
+		a.metadata.requeue(list)
+	}
+}
+
 func (a *Agent) postOneMetric(ctx context.Context, metric model.Metric) error {
 	if err := metric.UpdateHash(a.config.Key); err != nil {
 		return err
 	}
 
-	_, err := a.client.R().
-		SetContext(ctx).
-		SetBody(metric).
-		Post(a.updateURL)
+	return a.transport.PostMetric(ctx, metric)
+}
+
+func (a *Agent) postMetricList(ctx context.Context, metrics []model.Metric) error {
+	for i := range metrics {
+		if err := metrics[i].UpdateHash(a.config.Key); err != nil {
+			return err
+		}
+	}
 
-	return err
+	return a.transport.PostMetricList(ctx, metrics)
 }
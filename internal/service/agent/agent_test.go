@@ -2,19 +2,41 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/common"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/outbox"
 )
 
+const testTimestamp = 1700000000000
+
+// stampTestMetrics makes the agent send timestamps, fixes its poll time and
+// returns a function stamping the expected metrics with it.
+func stampTestMetrics(a *Agent) func(metric model.Metric) model.Metric {
+	a.config.SendTimestamps = true
+	a.now = func() time.Time { return time.UnixMilli(testTimestamp) }
+
+	return func(metric model.Metric) model.Metric {
+		metric.Timestamp = testTimestamp
+		return metric
+	}
+}
+
 func TestRun(t *testing.T) {
 	tests := []struct {
 		name                string
 		pollInterval        time.Duration
 		reportInterval      time.Duration
 		postWorkersPoolSize int
+		reportMode          ReportMode
 		wantErr             bool
 	}{
 		{
@@ -22,6 +44,15 @@ func TestRun(t *testing.T) {
 			pollInterval:        1 * time.Second,
 			reportInterval:      1,
 			postWorkersPoolSize: 1,
+			reportMode:          ReportModeSingle,
+			wantErr:             false,
+		},
+		{
+			name:                "batch ReportMode",
+			pollInterval:        1 * time.Second,
+			reportInterval:      1,
+			postWorkersPoolSize: 1,
+			reportMode:          ReportModeBatch,
 			wantErr:             false,
 		},
 	}
@@ -32,7 +63,12 @@ func TestRun(t *testing.T) {
 				PollInterval:        tt.pollInterval,
 				ReportInterval:      tt.reportInterval,
 				PostWorkersPoolSize: tt.postWorkersPoolSize,
-			}, "")
+				ReportMode:          tt.reportMode,
+				WindowMaxSize:       10,
+				OutboxMaxSize:       10,
+				OutboxDropPolicy:    outbox.DropOldest,
+				Transport:           TransportHTTP,
+			}, NewHTTPTransport(Config{}, "", "", ""))
 			require.Nil(t, err)
 			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
 			defer cancel()
@@ -45,3 +81,162 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestAggregateMetrics(t *testing.T) {
+	a, err := NewAgent(Config{
+		PollInterval:        1 * time.Second,
+		ReportInterval:      1 * time.Second,
+		PollMetricsBuffSize: 10,
+		WindowMaxSize:       10,
+		PostWorkersPoolSize: 1,
+		ReportMode:          ReportModeBatch,
+		OutboxMaxSize:       10,
+		OutboxDropPolicy:    outbox.DropOldest,
+		Transport:           TransportHTTP,
+		GaugeAggregations:   GaugeAggregationList{GaugeAggregationMin, GaugeAggregationMax, GaugeAggregationAvg},
+	}, NewHTTPTransport(Config{}, "", "", ""))
+	require.NoError(t, err)
+	stamp := stampTestMetrics(a)
+
+	a.queueMetrics(model.MetricFromGauge("metric1", model.Gauge(1)))
+	a.queueMetrics(model.MetricFromCounter("metric1", model.Counter(1)))
+	a.queueMetrics(model.MetricFromGauge("metric1", model.Gauge(5)))
+	a.queueMetrics(model.MetricFromCounter("metric1", model.Counter(2)))
+	a.queueMetrics(model.MetricFromGauge("metric1", model.Gauge(3)))
+
+	aggregated := func(aggregation GaugeAggregation, value model.Gauge) model.Metric {
+		metric := model.MetricFromGauge("metric1", value)
+		metric.Labels = model.Labels{AggregationLabel: string(aggregation)}
+		return stamp(metric)
+	}
+
+	want := []model.Metric{
+		stamp(model.MetricFromGauge("metric1", model.Gauge(3))),
+		aggregated(GaugeAggregationMin, 1),
+		aggregated(GaugeAggregationMax, 5),
+		aggregated(GaugeAggregationAvg, 3),
+		stamp(model.MetricFromCounter("metric1", model.Counter(3))),
+	}
+	assert.Equal(t, want, a.window.drain())
+	assert.Empty(t, a.window.drain())
+}
+
+func TestPollCountDelta(t *testing.T) {
+	a, err := NewAgent(Config{
+		PollInterval:        1 * time.Second,
+		ReportInterval:      1 * time.Second,
+		PollMetricsBuffSize: 10,
+		WindowMaxSize:       10,
+		PostWorkersPoolSize: 1,
+		ReportMode:          ReportModeBatch,
+		OutboxMaxSize:       10,
+		OutboxDropPolicy:    outbox.DropOldest,
+		Transport:           TransportHTTP,
+		Collectors:          CollectorList{CollectorPollCount},
+	}, NewHTTPTransport(Config{}, "", "", ""))
+	require.NoError(t, err)
+	stamp := stampTestMetrics(a)
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		a.collect(ctx, a.collectors[0])
+	}
+
+	assert.Equal(t, []model.Metric{stamp(model.MetricFromCounter("PollCount", model.Counter(5)))}, a.window.drain())
+}
+
+func TestPostMetricList(t *testing.T) {
+	var requests int
+	var metrics []model.Metric
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/updates/", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&metrics))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	key := "secret"
+	a, err := NewAgent(Config{
+		PollInterval:        1 * time.Second,
+		ReportInterval:      1 * time.Second,
+		PostWorkersPoolSize: 1,
+		ReportMode:          ReportModeBatch,
+		Key:                 key,
+		WindowMaxSize:       10,
+		OutboxMaxSize:       10,
+		OutboxDropPolicy:    outbox.DropOldest,
+		Transport:           TransportHTTP,
+	}, NewHTTPTransport(Config{}, server.URL+"/update/", server.URL+"/updates/", server.URL+"/metadata/"))
+	require.NoError(t, err)
+
+	err = a.postMetricList(context.Background(), []model.Metric{
+		model.MetricFromGauge("metric1", model.Gauge(1)),
+		model.MetricFromCounter("metric2", model.Counter(2)),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, requests)
+	require.Len(t, metrics, 2)
+	for _, metric := range metrics {
+		valid, err := metric.ValidateHash(key)
+		require.NoError(t, err)
+		assert.True(t, valid)
+	}
+}
+
+func TestQueueMetricsWithoutTimestamps(t *testing.T) {
+	key := "secret"
+	a, err := NewAgent(Config{
+		PollInterval:        1 * time.Second,
+		ReportInterval:      1 * time.Second,
+		PollMetricsBuffSize: 10,
+		WindowMaxSize:       10,
+		PostWorkersPoolSize: 1,
+		ReportMode:          ReportModeSingle,
+		Key:                 key,
+		OutboxMaxSize:       10,
+		OutboxDropPolicy:    outbox.DropOldest,
+		Transport:           TransportHTTP,
+	}, NewHTTPTransport(Config{}, "", "", ""))
+	require.NoError(t, err)
+
+	a.queueMetrics(model.MetricFromGauge("metric1", model.Gauge(1.5)))
+
+	metrics := a.window.drain()
+	require.Len(t, metrics, 1)
+	assert.Zero(t, metrics[0].Timestamp)
+
+	// A server that predates timestamps validates the hash of the metric.
+	require.NoError(t, metrics[0].UpdateHash(key))
+	want, err := common.Hash([]byte("metric1:gauge:1.500000"), []byte(key))
+	require.NoError(t, err)
+	assert.Equal(t, want, metrics[0].Hash)
+}
+
+func TestQueueMetricSpillsIntoOutbox(t *testing.T) {
+	a, err := NewAgent(Config{
+		PollInterval:        1 * time.Second,
+		ReportInterval:      1 * time.Second,
+		PollMetricsBuffSize: 1,
+		WindowMaxSize:       1,
+		PostWorkersPoolSize: 1,
+		ReportMode:          ReportModeBatch,
+		OutboxMaxSize:       10,
+		OutboxDropPolicy:    outbox.DropOldest,
+		Transport:           TransportHTTP,
+	}, NewHTTPTransport(Config{}, "", "", ""))
+	require.NoError(t, err)
+	stamp := stampTestMetrics(a)
+
+	a.queueMetrics(model.MetricFromGauge("metric1", model.Gauge(1)))
+	a.queueMetrics(model.MetricFromCounter("metric2", model.Counter(2)))
+	a.queueMetrics(model.MetricFromCounter("metric2", model.Counter(3)))
+
+	assert.Len(t, a.window.drain(), 1)
+
+	metrics, err := a.outbox.Take()
+	require.NoError(t, err)
+	assert.Equal(t, []model.Metric{stamp(model.MetricFromCounter("metric2", model.Counter(5)))}, metrics)
+}
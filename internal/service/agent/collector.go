@@ -0,0 +1,211 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+// Collector gathers a group of metrics on every poll.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context) ([]model.Metric, error)
+}
+
+type CollectorFactory func(config Config) (Collector, error)
+
+var (
+	collectorsMu sync.RWMutex
+	collectors   = make(map[string]CollectorFactory)
+)
+
+// RegisterCollector makes a collector available by name for Config.Collectors.
+// It panics if the name is already registered.
+func RegisterCollector(name string, factory CollectorFactory) {
+	collectorsMu.Lock()
+	defer collectorsMu.Unlock()
+
+	if factory == nil {
+		panic("agent: RegisterCollector factory is nil")
+	}
+	if _, ok := collectors[name]; ok {
+		panic("agent: RegisterCollector called twice for collector " + name)
+	}
+	collectors[name] = factory
+}
+
+// RegisteredCollectors returns the sorted names of the registered collectors.
+func RegisteredCollectors() []string {
+	collectorsMu.RLock()
+	defer collectorsMu.RUnlock()
+
+	names := make([]string, 0, len(collectors))
+	for name := range collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func NewCollector(name string, config Config) (Collector, error) {
+	collectorsMu.RLock()
+	factory, ok := collectors[name]
+	collectorsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown collector: %s", name)
+	}
+
+	return factory(config)
+}
+
+// CollectorList is a comma-separated list of collector names.
+type CollectorList []string
+
+func (l *CollectorList) UnmarshalText(text []byte) error {
+	list := CollectorList{}
+	for _, name := range strings.Split(string(text), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	*l = list
+
+	return nil
+}
+
+func (l *CollectorList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *CollectorList) Set(s string) error {
+	return l.UnmarshalText([]byte(s))
+}
+
+// CollectorIntervals overrides PollInterval for some collectors. It is given
+// as comma-separated name=duration pairs, e.g. "random=1m,gopsutil=5s".
+type CollectorIntervals map[string]time.Duration
+
+func (c *CollectorIntervals) UnmarshalText(text []byte) error {
+	intervals := make(CollectorIntervals)
+
+	for _, pair := range strings.Split(string(text), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		i := strings.IndexByte(pair, '=')
+		if i < 0 {
+			return fmt.Errorf("invalid collector interval %q: missing '='", pair)
+		}
+
+		interval, err := time.ParseDuration(pair[i+1:])
+		if err != nil {
+			return fmt.Errorf("invalid collector interval %q: %w", pair, err)
+		}
+		intervals[pair[:i]] = interval
+	}
+
+	*c = intervals
+
+	return nil
+}
+
+func (c *CollectorIntervals) String() string {
+	if c == nil {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(*c))
+	for name, interval := range *c {
+		pairs = append(pairs, name+"="+interval.String())
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func (c *CollectorIntervals) Set(s string) error {
+	return c.UnmarshalText([]byte(s))
+}
+
+func (c CollectorIntervals) Validate() error {
+	for name, interval := range c {
+		if interval <= 0 {
+			return fmt.Errorf("invalid non-positive interval=%v for collector: %s", interval, name)
+		}
+	}
+	return nil
+}
+
+func newCollectors(config Config) ([]Collector, error) {
+	result := make([]Collector, 0, len(config.Collectors))
+	seen := make(map[string]bool, len(config.Collectors))
+
+	for _, name := range config.Collectors {
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate collector: %s", name)
+		}
+		seen[name] = true
+
+		c, err := NewCollector(name, config)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+
+	return result, nil
+}
+
+func (a *Agent) collectorInterval(c Collector) time.Duration {
+	if interval, ok := a.config.CollectorIntervals[c.Name()]; ok {
+		return interval
+	}
+	return a.config.PollInterval
+}
+
+func (a *Agent) runCollector(ctx context.Context, c Collector) {
+	ticker := time.NewTicker(a.collectorInterval(c))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.collect(ctx, c)
+		}
+	}
+}
+
+// collect queues the metrics of a single poll. A failing or panicking
+// collector doesn't affect the other ones.
+func (a *Agent) collect(ctx context.Context, c Collector) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("collector %s panicked: %v", c.Name(), r)
+		}
+	}()
+
+	metrics, err := c.Collect(ctx)
+	if err != nil {
+		log.Printf("collector %s failed: %v", c.Name(), err)
+	}
+
+	a.queueMetrics(metrics...)
+}
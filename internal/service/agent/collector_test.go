@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/outbox"
+)
+
+type testCollector struct {
+	name    string
+	metrics []model.Metric
+	err     error
+	panic   bool
+}
+
+func (c testCollector) Name() string {
+	return c.name
+}
+
+func (c testCollector) Collect(ctx context.Context) ([]model.Metric, error) {
+	if c.panic {
+		panic("test panic")
+	}
+	return c.metrics, c.err
+}
+
+func TestRegisterCollector(t *testing.T) {
+	RegisterCollector("test", func(Config) (Collector, error) {
+		return testCollector{name: "test"}, nil
+	})
+
+	assert.Panics(t, func() {
+		RegisterCollector("test", func(Config) (Collector, error) {
+			return testCollector{name: "test"}, nil
+		})
+	})
+	assert.Contains(t, RegisteredCollectors(), "test")
+
+	c, err := NewCollector("test", Config{})
+	require.NoError(t, err)
+	assert.Equal(t, "test", c.Name())
+
+	_, err = NewCollector("unknown", Config{})
+	assert.Error(t, err)
+}
+
+func TestCollectorList_UnmarshalText(t *testing.T) {
+	var list CollectorList
+	require.NoError(t, list.UnmarshalText([]byte("memstats, gopsutil,,")))
+	assert.Equal(t, CollectorList{"memstats", "gopsutil"}, list)
+	assert.Equal(t, "memstats,gopsutil", list.String())
+}
+
+func TestCollectorIntervals_UnmarshalText(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    CollectorIntervals
+		wantErr bool
+	}{
+		{
+			name: "Valid intervals",
+			text: "random=1m,gopsutil=5s",
+			want: CollectorIntervals{"random": time.Minute, "gopsutil": 5 * time.Second},
+		},
+		{
+			name: "Empty",
+			text: "",
+			want: CollectorIntervals{},
+		},
+		{
+			name:    "Missing '='",
+			text:    "random",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid duration",
+			text:    "random=abc",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var intervals CollectorIntervals
+			err := intervals.UnmarshalText([]byte(tt.text))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, intervals)
+		})
+	}
+}
+
+func TestNewAgentCollectors(t *testing.T) {
+	config := Config{
+		PollInterval:        1 * time.Second,
+		ReportInterval:      1 * time.Second,
+		PostWorkersPoolSize: 1,
+		ReportMode:          ReportModeBatch,
+		WindowMaxSize:       10,
+		OutboxMaxSize:       10,
+		OutboxDropPolicy:    outbox.DropOldest,
+		Transport:           TransportHTTP,
+	}
+
+	config.Collectors = CollectorList{CollectorMemStats, CollectorRandom}
+	a, err := NewAgent(config, NewHTTPTransport(Config{}, "", "", ""))
+	require.NoError(t, err)
+	require.Len(t, a.collectors, 2)
+	assert.Equal(t, CollectorMemStats, a.collectors[0].Name())
+	assert.Equal(t, CollectorRandom, a.collectors[1].Name())
+
+	config.Collectors = CollectorList{"unknown"}
+	_, err = NewAgent(config, NewHTTPTransport(Config{}, "", "", ""))
+	assert.Error(t, err)
+
+	config.Collectors = CollectorList{CollectorRandom, CollectorRandom}
+	_, err = NewAgent(config, NewHTTPTransport(Config{}, "", "", ""))
+	assert.Error(t, err)
+
+	config.Collectors = nil
+	config.CollectorIntervals = CollectorIntervals{CollectorRandom: 0}
+	_, err = NewAgent(config, NewHTTPTransport(Config{}, "", "", ""))
+	assert.Error(t, err)
+}
+
+func TestCollect(t *testing.T) {
+	a, err := NewAgent(Config{
+		PollInterval:        1 * time.Second,
+		ReportInterval:      1 * time.Second,
+		PollMetricsBuffSize: 10,
+		WindowMaxSize:       10,
+		PostWorkersPoolSize: 1,
+		ReportMode:          ReportModeBatch,
+		OutboxMaxSize:       10,
+		OutboxDropPolicy:    outbox.DropOldest,
+		Transport:           TransportHTTP,
+	}, NewHTTPTransport(Config{}, "", "", ""))
+	require.NoError(t, err)
+	stamp := stampTestMetrics(a)
+
+	ctx := context.Background()
+	a.collect(ctx, testCollector{name: "panicking", panic: true})
+	a.collect(ctx, testCollector{
+		name:    "failing",
+		metrics: []model.Metric{model.MetricFromGauge("metric1", model.Gauge(1))},
+		err:     errors.New("partial failure"),
+	})
+	a.collect(ctx, testCollector{
+		name:    "working",
+		metrics: []model.Metric{model.MetricFromGauge("metric2", model.Gauge(2))},
+	})
+
+	want := []model.Metric{
+		stamp(model.MetricFromGauge("metric1", model.Gauge(1))),
+		stamp(model.MetricFromGauge("metric2", model.Gauge(2))),
+	}
+	assert.Equal(t, want, a.window.drain())
+}
+
+func TestBuiltinCollectors(t *testing.T) {
+	for _, name := range []string{CollectorMemStats, CollectorRandom, CollectorPollCount} {
+		t.Run(name, func(t *testing.T) {
+			c, err := NewCollector(name, Config{})
+			require.NoError(t, err)
+
+			metrics, err := c.Collect(context.Background())
+			require.NoError(t, err)
+			require.NotEmpty(t, metrics)
+			for _, metric := range metrics {
+				assert.NoError(t, metric.Validate())
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+const (
+	CollectorMemStats  = "memstats"
+	CollectorRandom    = "random"
+	CollectorPollCount = "pollcount"
+	CollectorGopsutil  = "gopsutil"
+)
+
+func init() {
+	RegisterCollector(CollectorMemStats, func(Config) (Collector, error) {
+		return memStatsCollector{}, nil
+	})
+	RegisterCollector(CollectorRandom, func(Config) (Collector, error) {
+		return randomCollector{}, nil
+	})
+	RegisterCollector(CollectorPollCount, func(Config) (Collector, error) {
+		return pollCountCollector{}, nil
+	})
+	RegisterCollector(CollectorGopsutil, func(Config) (Collector, error) {
+		return &gopsutilCollector{}, nil
+	})
+}
+
+type memStatsCollector struct{}
+
+func (memStatsCollector) Name() string {
+	return CollectorMemStats
+}
+
+func (memStatsCollector) Collect(ctx context.Context) ([]model.Metric, error) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return []model.Metric{
+		model.MetricFromGauge("Alloc", model.Gauge(m.Alloc)),
+		model.MetricFromGauge("TotalAlloc", model.Gauge(m.TotalAlloc)),
+		model.MetricFromGauge("BuckHashSys", model.Gauge(m.BuckHashSys)),
+		model.MetricFromGauge("Frees", model.Gauge(m.Frees)),
+		model.MetricFromGauge("GCCPUFraction", model.Gauge(m.GCCPUFraction)),
+		model.MetricFromGauge("GCSys", model.Gauge(m.GCSys)),
+		model.MetricFromGauge("HeapAlloc", model.Gauge(m.HeapAlloc)),
+		model.MetricFromGauge("HeapIdle", model.Gauge(m.HeapIdle)),
+		model.MetricFromGauge("HeapInuse", model.Gauge(m.HeapInuse)),
+		model.MetricFromGauge("HeapObjects", model.Gauge(m.HeapObjects)),
+		model.MetricFromGauge("HeapReleased", model.Gauge(m.HeapReleased)),
+		model.MetricFromGauge("HeapSys", model.Gauge(m.HeapSys)),
+		model.MetricFromGauge("LastGC", model.Gauge(m.LastGC)),
+		model.MetricFromGauge("Lookups", model.Gauge(m.Lookups)),
+		model.MetricFromGauge("MCacheInuse", model.Gauge(m.MCacheInuse)),
+		model.MetricFromGauge("MCacheSys", model.Gauge(m.MCacheSys)),
+		model.MetricFromGauge("MSpanInuse", model.Gauge(m.MSpanInuse)),
+		model.MetricFromGauge("MSpanSys", model.Gauge(m.MSpanSys)),
+		model.MetricFromGauge("Mallocs", model.Gauge(m.Mallocs)),
+		model.MetricFromGauge("NextGC", model.Gauge(m.NextGC)),
+		model.MetricFromGauge("NumForcedGC", model.Gauge(m.NumForcedGC)),
+		model.MetricFromGauge("NumGC", model.Gauge(m.NumGC)),
+		model.MetricFromGauge("OtherSys", model.Gauge(m.OtherSys)),
+		model.MetricFromGauge("PauseTotalNs", model.Gauge(m.PauseTotalNs)),
+		model.MetricFromGauge("StackInuse", model.Gauge(m.StackInuse)),
+		model.MetricFromGauge("StackSys", model.Gauge(m.StackSys)),
+		model.MetricFromGauge("Sys", model.Gauge(m.Sys)),
+	}, nil
+}
+
+type randomCollector struct{}
+
+func (randomCollector) Name() string {
+	return CollectorRandom
+}
+
+func (randomCollector) Collect(ctx context.Context) ([]model.Metric, error) {
+	randomValue := rand.Float64()
+	return []model.Metric{model.MetricFromGauge("RandomValue", model.Gauge(randomValue))}, nil
+}
+
+// pollCountCollector counts polls: every poll adds one to PollCount.
+type pollCountCollector struct{}
+
+func (pollCountCollector) Name() string {
+	return CollectorPollCount
+}
+
+func (pollCountCollector) Collect(ctx context.Context) ([]model.Metric, error) {
+	return []model.Metric{model.MetricFromCounter("PollCount", model.Counter(1))}, nil
+}
+
+type gopsutilCollector struct {
+	cpu cpuSampler
+}
+
+func (c *gopsutilCollector) Name() string {
+	return CollectorGopsutil
+}
+
+// Collect returns the metrics that could be read, along with an error if
+// some of them failed.
+func (c *gopsutilCollector) Collect(ctx context.Context) ([]model.Metric, error) {
+	var metrics []model.Metric
+
+	v, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory metrics: %w", err)
+	}
+
+	metrics = append(metrics,
+		model.MetricFromGauge("TotalMemory", model.Gauge(v.Total)),
+		model.MetricFromGauge("FreeMemory", model.Gauge(v.Free)),
+	)
+
+	times, err := cpu.TimesWithContext(ctx, true)
+	if err != nil {
+		return metrics, fmt.Errorf("failed to read cpu metrics: %w", err)
+	}
+
+	return append(metrics, c.cpu.metrics(times)...), nil
+}
@@ -0,0 +1,206 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+const (
+	CollectorCgroup = "cgroup"
+
+	DefaultCgroupRoot = "/sys/fs/cgroup"
+
+	// cgroup v1 reports an unlimited memory limit as the largest page-aligned
+	// int64 value.
+	cgroupV1UnlimitedMemory = 1 << 62
+)
+
+func init() {
+	RegisterCollector(CollectorCgroup, func(config Config) (Collector, error) {
+		root := config.CgroupRoot
+		if root == "" {
+			root = DefaultCgroupRoot
+		}
+		return &cgroupCollector{root: root, tracker: newCounterTracker()}, nil
+	})
+}
+
+// cgroupCollector reports the resources of the cgroup mounted at root, which
+// inside a container are the limits of the container rather than of the host.
+// Both the unified (v2) and the legacy (v1) hierarchies are supported.
+type cgroupCollector struct {
+	root    string
+	tracker *counterTracker
+}
+
+func (c *cgroupCollector) Name() string {
+	return CollectorCgroup
+}
+
+func (c *cgroupCollector) Collect(ctx context.Context) ([]model.Metric, error) {
+	if _, err := os.Stat(c.root); err != nil {
+		return nil, fmt.Errorf("failed to read cgroup root: %w", err)
+	}
+
+	r := &cgroupReader{}
+	if _, err := os.Stat(filepath.Join(c.root, "cgroup.controllers")); err == nil {
+		c.collectV2(r)
+	} else {
+		c.collectV1(r)
+	}
+
+	return r.metrics, r.err
+}
+
+func (c *cgroupCollector) collectV2(r *cgroupReader) {
+	if v, ok := r.readUint(filepath.Join(c.root, "memory.current")); ok {
+		r.gauge("CgroupMemoryUsage", v)
+	}
+	if v, ok := r.readLimit(filepath.Join(c.root, "memory.max")); ok {
+		r.gauge("CgroupMemoryLimit", v)
+	}
+
+	stat := r.readStat(filepath.Join(c.root, "cpu.stat"))
+	c.counter(r, stat, "usage_usec", "CgroupCPUUsageUsec", 1)
+	c.counter(r, stat, "nr_periods", "CgroupCPUPeriods", 1)
+	c.counter(r, stat, "nr_throttled", "CgroupCPUThrottledPeriods", 1)
+	c.counter(r, stat, "throttled_usec", "CgroupCPUThrottledUsec", 1)
+
+	if v, ok := r.readUint(filepath.Join(c.root, "pids.current")); ok {
+		r.gauge("CgroupPidsCurrent", v)
+	}
+	if v, ok := r.readLimit(filepath.Join(c.root, "pids.max")); ok {
+		r.gauge("CgroupPidsLimit", v)
+	}
+}
+
+func (c *cgroupCollector) collectV1(r *cgroupReader) {
+	memory := filepath.Join(c.root, "memory")
+	if v, ok := r.readUint(filepath.Join(memory, "memory.usage_in_bytes")); ok {
+		r.gauge("CgroupMemoryUsage", v)
+	}
+	if v, ok := r.readUint(filepath.Join(memory, "memory.limit_in_bytes")); ok && v < cgroupV1UnlimitedMemory {
+		r.gauge("CgroupMemoryLimit", v)
+	}
+
+	// cpuacct reports the usage in nanoseconds.
+	if v, ok := r.readUint(filepath.Join(c.root, "cpuacct", "cpuacct.usage")); ok {
+		c.counter(r, map[string]uint64{"usage": v}, "usage", "CgroupCPUUsageUsec", 1000)
+	}
+
+	stat := r.readStat(filepath.Join(c.root, "cpu", "cpu.stat"))
+	c.counter(r, stat, "nr_periods", "CgroupCPUPeriods", 1)
+	c.counter(r, stat, "nr_throttled", "CgroupCPUThrottledPeriods", 1)
+	c.counter(r, stat, "throttled_time", "CgroupCPUThrottledUsec", 1000)
+
+	pids := filepath.Join(c.root, "pids")
+	if v, ok := r.readUint(filepath.Join(pids, "pids.current")); ok {
+		r.gauge("CgroupPidsCurrent", v)
+	}
+	if v, ok := r.readLimit(filepath.Join(pids, "pids.max")); ok {
+		r.gauge("CgroupPidsLimit", v)
+	}
+}
+
+// counter reports the change of a cumulative cpu.stat field, scaled down by
+// divisor, as a counter delta.
+func (c *cgroupCollector) counter(r *cgroupReader, stat map[string]uint64, key, name string, divisor uint64) {
+	v, ok := stat[key]
+	if !ok {
+		return
+	}
+	r.metrics = c.tracker.appendDelta(r.metrics, name, nil, v/divisor)
+}
+
+// cgroupReader accumulates metrics and the first read error. Missing files
+// are skipped, as the set of enabled controllers varies.
+type cgroupReader struct {
+	metrics []model.Metric
+	err     error
+}
+
+func (r *cgroupReader) gauge(name string, value uint64) {
+	r.metrics = append(r.metrics, model.MetricFromGauge(name, model.Gauge(value)))
+}
+
+func (r *cgroupReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *cgroupReader) readFile(name string) (string, bool) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			r.fail(err)
+		}
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+func (r *cgroupReader) readUint(name string) (uint64, bool) {
+	s, ok := r.readFile(name)
+	if !ok {
+		return 0, false
+	}
+
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		r.fail(fmt.Errorf("failed to parse %s: %w", name, err))
+		return 0, false
+	}
+
+	return v, true
+}
+
+// readLimit reads a limit file, where "max" stands for no limit.
+func (r *cgroupReader) readLimit(name string) (uint64, bool) {
+	s, ok := r.readFile(name)
+	if !ok || s == "max" {
+		return 0, false
+	}
+
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		r.fail(fmt.Errorf("failed to parse %s: %w", name, err))
+		return 0, false
+	}
+
+	return v, true
+}
+
+// readStat reads a flat keyed file of "key value" lines, such as cpu.stat.
+func (r *cgroupReader) readStat(name string) map[string]uint64 {
+	s, ok := r.readFile(name)
+	if !ok {
+		return nil
+	}
+
+	stat := make(map[string]uint64)
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			r.fail(fmt.Errorf("failed to parse %s: %w", name, err))
+			continue
+		}
+		stat[fields[0]] = v
+	}
+
+	return stat
+}
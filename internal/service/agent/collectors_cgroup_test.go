@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func newTestCgroupCollector(t *testing.T, root string) Collector {
+	c, err := NewCollector(CollectorCgroup, Config{CgroupRoot: root})
+	require.NoError(t, err)
+	return c
+}
+
+func TestCgroupCollector(t *testing.T) {
+	tests := []struct {
+		name   string
+		root   string
+		first  []model.Metric
+		second []model.Metric
+	}{
+		{
+			name: "cgroup v2",
+			root: "testdata/cgroup/v2",
+			first: []model.Metric{
+				model.MetricFromGauge("CgroupMemoryUsage", model.Gauge(104857600)),
+				model.MetricFromGauge("CgroupMemoryLimit", model.Gauge(536870912)),
+				model.MetricFromGauge("CgroupPidsCurrent", model.Gauge(12)),
+			},
+			second: []model.Metric{
+				model.MetricFromGauge("CgroupMemoryUsage", model.Gauge(104857600)),
+				model.MetricFromGauge("CgroupMemoryLimit", model.Gauge(536870912)),
+				model.MetricFromCounter("CgroupCPUUsageUsec", model.Counter(0)),
+				model.MetricFromCounter("CgroupCPUPeriods", model.Counter(0)),
+				model.MetricFromCounter("CgroupCPUThrottledPeriods", model.Counter(0)),
+				model.MetricFromCounter("CgroupCPUThrottledUsec", model.Counter(0)),
+				model.MetricFromGauge("CgroupPidsCurrent", model.Gauge(12)),
+			},
+		},
+		{
+			name: "cgroup v1",
+			root: "testdata/cgroup/v1",
+			first: []model.Metric{
+				model.MetricFromGauge("CgroupMemoryUsage", model.Gauge(73400320)),
+				model.MetricFromGauge("CgroupPidsCurrent", model.Gauge(5)),
+				model.MetricFromGauge("CgroupPidsLimit", model.Gauge(100)),
+			},
+			second: []model.Metric{
+				model.MetricFromGauge("CgroupMemoryUsage", model.Gauge(73400320)),
+				model.MetricFromCounter("CgroupCPUUsageUsec", model.Counter(0)),
+				model.MetricFromCounter("CgroupCPUPeriods", model.Counter(0)),
+				model.MetricFromCounter("CgroupCPUThrottledPeriods", model.Counter(0)),
+				model.MetricFromCounter("CgroupCPUThrottledUsec", model.Counter(0)),
+				model.MetricFromGauge("CgroupPidsCurrent", model.Gauge(5)),
+				model.MetricFromGauge("CgroupPidsLimit", model.Gauge(100)),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCgroupCollector(t, tt.root)
+
+			metrics, err := c.Collect(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.first, metrics)
+
+			metrics, err = c.Collect(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.second, metrics)
+		})
+	}
+}
+
+func TestCgroupCollectorCounters(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, data string) {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(data), 0644))
+	}
+
+	write("cgroup.controllers", "cpu\n")
+	write("cpu.stat", "usage_usec 1000\nnr_periods 10\nnr_throttled 1\nthrottled_usec 50\n")
+
+	c := newTestCgroupCollector(t, root)
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	write("cpu.stat", "usage_usec 4000\nnr_periods 20\nnr_throttled 4\nthrottled_usec 250\n")
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []model.Metric{
+		model.MetricFromCounter("CgroupCPUUsageUsec", model.Counter(3000)),
+		model.MetricFromCounter("CgroupCPUPeriods", model.Counter(10)),
+		model.MetricFromCounter("CgroupCPUThrottledPeriods", model.Counter(3)),
+		model.MetricFromCounter("CgroupCPUThrottledUsec", model.Counter(200)),
+	}, metrics)
+
+	write("memory.current", "invalid\n")
+	_, err = c.Collect(context.Background())
+	assert.Error(t, err)
+}
+
+func TestCgroupCollectorMissingRoot(t *testing.T) {
+	c := newTestCgroupCollector(t, filepath.Join(t.TempDir(), "missing"))
+	_, err := c.Collect(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+const (
+	CollectorDisk    = "disk"
+	CollectorNet     = "net"
+	CollectorLoad    = "load"
+	CollectorProcess = "process"
+)
+
+func init() {
+	RegisterCollector(CollectorDisk, func(config Config) (Collector, error) {
+		return &diskCollector{
+			filter:  filter{include: config.DiskInclude, exclude: config.DiskExclude},
+			tracker: newCounterTracker(),
+		}, nil
+	})
+	RegisterCollector(CollectorNet, func(config Config) (Collector, error) {
+		return &netCollector{
+			filter:  filter{include: config.NetInclude, exclude: config.NetExclude},
+			tracker: newCounterTracker(),
+		}, nil
+	})
+	RegisterCollector(CollectorLoad, func(Config) (Collector, error) {
+		return loadCollector{}, nil
+	})
+	RegisterCollector(CollectorProcess, func(Config) (Collector, error) {
+		return processCollector{}, nil
+	})
+}
+
+// counterTracker turns cumulative OS counters into counter deltas. The first
+// value of a series only sets the baseline.
+type counterTracker struct {
+	prev map[string]uint64
+}
+
+func newCounterTracker() *counterTracker {
+	return &counterTracker{prev: make(map[string]uint64)}
+}
+
+func (t *counterTracker) delta(metric model.Metric, value uint64) (model.Metric, bool) {
+	key := metric.Key()
+
+	prev, ok := t.prev[key]
+	t.prev[key] = value
+	if !ok {
+		return model.Metric{}, false
+	}
+
+	delta := value - prev
+	if value < prev {
+		// The counter was reset, e.g. the interface was recreated.
+		delta = value
+	}
+
+	d := model.Counter(delta)
+	metric.MType = model.MetricTypeCounter
+	metric.Delta = &d
+
+	return metric, true
+}
+
+func (t *counterTracker) appendDelta(
+	metrics []model.Metric,
+	name string,
+	labels model.Labels,
+	value uint64,
+) []model.Metric {
+	metric, ok := t.delta(model.Metric{ID: model.MetricName(name), Labels: labels}, value)
+	if !ok {
+		return metrics
+	}
+	return append(metrics, metric)
+}
+
+func labelledGauge(name string, labels model.Labels, value float64) model.Metric {
+	metric := model.MetricFromGauge(name, model.Gauge(value))
+	metric.Labels = labels
+	return metric
+}
+
+// diskCollector reports usage of every mount point and IO of every device.
+// Filters match mount points and device names, both the short form ("sda1")
+// and the device path ("/dev/sda1").
+type diskCollector struct {
+	filter  filter
+	tracker *counterTracker
+}
+
+func (c *diskCollector) allowPartition(p disk.PartitionStat) bool {
+	if p.Device == "" {
+		return c.filter.allow(p.Mountpoint)
+	}
+	return c.filter.allow(p.Mountpoint, filepath.Base(p.Device), p.Device)
+}
+
+func (c *diskCollector) allowDevice(name string) bool {
+	return c.filter.allow(name, "/dev/"+name)
+}
+
+func (c *diskCollector) Name() string {
+	return CollectorDisk
+}
+
+func (c *diskCollector) Collect(ctx context.Context) ([]model.Metric, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partitions: %w", err)
+	}
+
+	var metrics []model.Metric
+
+	for _, p := range partitions {
+		if !c.allowPartition(p) {
+			continue
+		}
+
+		usage, err := disk.UsageWithContext(ctx, p.Mountpoint)
+		if err != nil {
+			continue
+		}
+
+		labels := model.Labels{"mount": p.Mountpoint}
+		if p.Device != "" {
+			labels["device"] = p.Device
+		}
+		metrics = append(metrics,
+			labelledGauge("DiskTotal", labels, float64(usage.Total)),
+			labelledGauge("DiskFree", labels, float64(usage.Free)),
+			labelledGauge("DiskUsed", labels, float64(usage.Used)),
+			labelledGauge("DiskUsedPercent", labels, usage.UsedPercent),
+		)
+	}
+
+	counters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return metrics, fmt.Errorf("failed to read disk IO counters: %w", err)
+	}
+
+	for name, io := range counters {
+		if !c.allowDevice(name) {
+			continue
+		}
+
+		labels := model.Labels{"device": name}
+		metrics = c.tracker.appendDelta(metrics, "DiskReadBytes", labels, io.ReadBytes)
+		metrics = c.tracker.appendDelta(metrics, "DiskWriteBytes", labels, io.WriteBytes)
+		metrics = c.tracker.appendDelta(metrics, "DiskReads", labels, io.ReadCount)
+		metrics = c.tracker.appendDelta(metrics, "DiskWrites", labels, io.WriteCount)
+	}
+
+	return metrics, nil
+}
+
+// netCollector reports traffic of every network interface.
+type netCollector struct {
+	filter  filter
+	tracker *counterTracker
+}
+
+func (c *netCollector) Name() string {
+	return CollectorNet
+}
+
+func (c *netCollector) Collect(ctx context.Context) ([]model.Metric, error) {
+	counters, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read network IO counters: %w", err)
+	}
+
+	var metrics []model.Metric
+
+	for _, io := range counters {
+		if !c.filter.allow(io.Name) {
+			continue
+		}
+
+		labels := model.Labels{"interface": io.Name}
+		metrics = c.tracker.appendDelta(metrics, "NetBytesSent", labels, io.BytesSent)
+		metrics = c.tracker.appendDelta(metrics, "NetBytesRecv", labels, io.BytesRecv)
+		metrics = c.tracker.appendDelta(metrics, "NetPacketsSent", labels, io.PacketsSent)
+		metrics = c.tracker.appendDelta(metrics, "NetPacketsRecv", labels, io.PacketsRecv)
+		metrics = c.tracker.appendDelta(metrics, "NetErrorsIn", labels, io.Errin)
+		metrics = c.tracker.appendDelta(metrics, "NetErrorsOut", labels, io.Errout)
+		metrics = c.tracker.appendDelta(metrics, "NetDropsIn", labels, io.Dropin)
+		metrics = c.tracker.appendDelta(metrics, "NetDropsOut", labels, io.Dropout)
+	}
+
+	return metrics, nil
+}
+
+type loadCollector struct{}
+
+func (loadCollector) Name() string {
+	return CollectorLoad
+}
+
+func (loadCollector) Collect(ctx context.Context) ([]model.Metric, error) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read load averages: %w", err)
+	}
+
+	return []model.Metric{
+		model.MetricFromGauge("LoadAverage1", model.Gauge(avg.Load1)),
+		model.MetricFromGauge("LoadAverage5", model.Gauge(avg.Load5)),
+		model.MetricFromGauge("LoadAverage15", model.Gauge(avg.Load15)),
+	}, nil
+}
+
+type processCollector struct{}
+
+func (processCollector) Name() string {
+	return CollectorProcess
+}
+
+func (processCollector) Collect(ctx context.Context) ([]model.Metric, error) {
+	pids, err := process.PidsWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	metrics := []model.Metric{
+		model.MetricFromGauge("ProcessCount", model.Gauge(len(pids))),
+	}
+
+	misc, err := load.MiscWithContext(ctx)
+	if err != nil {
+		return metrics, fmt.Errorf("failed to read process counts: %w", err)
+	}
+
+	// ProcsTotal counts all scheduling entities, i.e. threads.
+	metrics = append(metrics,
+		model.MetricFromGauge("ThreadCount", model.Gauge(misc.ProcsTotal)),
+		model.MetricFromGauge("ProcessRunning", model.Gauge(misc.ProcsRunning)),
+		model.MetricFromGauge("ProcessBlocked", model.Gauge(misc.ProcsBlocked)),
+	)
+
+	return metrics, nil
+}
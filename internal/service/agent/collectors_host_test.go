@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  filter
+		names   []string
+		allowed bool
+	}{
+		{
+			name:    "Empty filter",
+			filter:  filter{},
+			names:   []string{"eth0"},
+			allowed: true,
+		},
+		{
+			name:    "Included",
+			filter:  filter{include: PatternList{"eth*"}},
+			names:   []string{"eth0"},
+			allowed: true,
+		},
+		{
+			name:    "Not included",
+			filter:  filter{include: PatternList{"eth*"}},
+			names:   []string{"wlan0"},
+			allowed: false,
+		},
+		{
+			name:    "Excluded",
+			filter:  filter{include: PatternList{"eth*"}, exclude: PatternList{"eth1"}},
+			names:   []string{"eth1"},
+			allowed: false,
+		},
+		{
+			name:    "Any of the names excluded",
+			filter:  filter{exclude: PatternList{"/boot"}},
+			names:   []string{"/boot", "/dev/sda1"},
+			allowed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, tt.filter.allow(tt.names...))
+		})
+	}
+}
+
+func TestDiskCollectorFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    filter
+		partition disk.PartitionStat
+		device    string
+		allowed   bool
+	}{
+		{
+			name:      "Included by device name",
+			filter:    filter{include: PatternList{"sda*"}},
+			partition: disk.PartitionStat{Mountpoint: "/", Device: "/dev/sda1"},
+			device:    "sda1",
+			allowed:   true,
+		},
+		{
+			name:      "Excluded by device name",
+			filter:    filter{exclude: PatternList{"loop*"}},
+			partition: disk.PartitionStat{Mountpoint: "/snap/core/1", Device: "/dev/loop0"},
+			device:    "loop0",
+			allowed:   false,
+		},
+		{
+			name:      "Excluded by device path",
+			filter:    filter{exclude: PatternList{"/dev/loop*"}},
+			partition: disk.PartitionStat{Mountpoint: "/snap/core/1", Device: "/dev/loop0"},
+			device:    "loop0",
+			allowed:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &diskCollector{filter: tt.filter}
+			assert.Equal(t, tt.allowed, c.allowPartition(tt.partition))
+			assert.Equal(t, tt.allowed, c.allowDevice(tt.device))
+		})
+	}
+}
+
+func TestPatternList_UnmarshalText(t *testing.T) {
+	var list PatternList
+	require.NoError(t, list.UnmarshalText([]byte("eth*, lo")))
+	assert.Equal(t, PatternList{"eth*", "lo"}, list)
+
+	assert.Error(t, list.UnmarshalText([]byte("eth[")))
+}
+
+func TestCounterTracker(t *testing.T) {
+	tracker := newCounterTracker()
+	labels := model.Labels{"interface": "eth0"}
+
+	metrics := tracker.appendDelta(nil, "NetBytesSent", labels, 100)
+	assert.Empty(t, metrics)
+
+	metrics = tracker.appendDelta(nil, "NetBytesSent", labels, 150)
+	want := model.MetricFromCounter("NetBytesSent", model.Counter(50))
+	want.Labels = labels
+	assert.Equal(t, []model.Metric{want}, metrics)
+
+	metrics = tracker.appendDelta(nil, "NetBytesSent", labels, 20)
+	want = model.MetricFromCounter("NetBytesSent", model.Counter(20))
+	want.Labels = labels
+	assert.Equal(t, []model.Metric{want}, metrics)
+}
+
+func TestHostCollectors(t *testing.T) {
+	for _, name := range []string{CollectorDisk, CollectorNet, CollectorLoad, CollectorProcess} {
+		t.Run(name, func(t *testing.T) {
+			c, err := NewCollector(name, Config{})
+			require.NoError(t, err)
+
+			for i := 0; i < 2; i++ {
+				metrics, err := c.Collect(context.Background())
+				if err != nil {
+					t.Skipf("%s metrics are not available: %v", name, err)
+				}
+				for _, metric := range metrics {
+					assert.NoError(t, metric.Validate())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+// cpuPercent is the share of CPU time, in percent, spent in each state
+// between two samples.
+type cpuPercent struct {
+	utilization float64
+	user        float64
+	system      float64
+	iowait      float64
+	steal       float64
+}
+
+// cpuPercentBetween returns the CPU usage between the samples prev and cur.
+// Utilization counts everything but idle time, as cpu.Percent does. It
+// returns false if no CPU time passed between the samples.
+func cpuPercentBetween(prev, cur cpu.TimesStat) (cpuPercent, bool) {
+	total := cur.Total() - prev.Total()
+	if total <= 0 {
+		return cpuPercent{}, false
+	}
+
+	percent := func(prev, cur float64) float64 {
+		return math.Min(100, math.Max(0, (cur-prev)/total*100))
+	}
+
+	return cpuPercent{
+		utilization: 100 - percent(prev.Idle, cur.Idle),
+		user:        percent(prev.User, cur.User),
+		system:      percent(prev.System, cur.System),
+		iowait:      percent(prev.Iowait, cur.Iowait),
+		steal:       percent(prev.Steal, cur.Steal),
+	}, true
+}
+
+func sumCPUTimes(times []cpu.TimesStat) cpu.TimesStat {
+	sum := cpu.TimesStat{CPU: "cpu-total"}
+	for _, t := range times {
+		sum.User += t.User
+		sum.System += t.System
+		sum.Idle += t.Idle
+		sum.Nice += t.Nice
+		sum.Iowait += t.Iowait
+		sum.Irq += t.Irq
+		sum.Softirq += t.Softirq
+		sum.Steal += t.Steal
+	}
+	return sum
+}
+
+// cpuSampler keeps the previous per-core sample of CPU times.
+type cpuSampler struct {
+	prev []cpu.TimesStat
+}
+
+// metrics returns per-core and total CPU usage since the previous sample:
+// CPUutilization0, CPUuser0, ... for every core and CPUutilization, CPUuser,
+// ... for all of them. The first sample only sets the baseline.
+func (s *cpuSampler) metrics(times []cpu.TimesStat) []model.Metric {
+	prev := s.prev
+	s.prev = times
+
+	// The set of cores changed, so the samples are not comparable.
+	if len(prev) != len(times) {
+		return nil
+	}
+
+	var metrics []model.Metric
+
+	for i := range times {
+		if p, ok := cpuPercentBetween(prev[i], times[i]); ok {
+			metrics = appendCPUPercent(metrics, fmt.Sprint(i), p)
+		}
+	}
+
+	if p, ok := cpuPercentBetween(sumCPUTimes(prev), sumCPUTimes(times)); ok {
+		metrics = appendCPUPercent(metrics, "", p)
+	}
+
+	return metrics
+}
+
+func appendCPUPercent(metrics []model.Metric, suffix string, p cpuPercent) []model.Metric {
+	return append(metrics,
+		model.MetricFromGauge("CPUutilization"+suffix, model.Gauge(p.utilization)),
+		model.MetricFromGauge("CPUuser"+suffix, model.Gauge(p.user)),
+		model.MetricFromGauge("CPUsystem"+suffix, model.Gauge(p.system)),
+		model.MetricFromGauge("CPUiowait"+suffix, model.Gauge(p.iowait)),
+		model.MetricFromGauge("CPUsteal"+suffix, model.Gauge(p.steal)),
+	)
+}
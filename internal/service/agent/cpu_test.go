@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func TestCPUPercentBetween(t *testing.T) {
+	prev := cpu.TimesStat{User: 10, System: 5, Idle: 80, Iowait: 3, Steal: 2}
+	cur := cpu.TimesStat{User: 40, System: 15, Idle: 120, Iowait: 13, Steal: 12}
+
+	p, ok := cpuPercentBetween(prev, cur)
+	require.True(t, ok)
+	assert.Equal(t, cpuPercent{
+		utilization: 60,
+		user:        30,
+		system:      10,
+		iowait:      10,
+		steal:       10,
+	}, p)
+
+	_, ok = cpuPercentBetween(cur, cur)
+	assert.False(t, ok)
+}
+
+func TestCPUSampler(t *testing.T) {
+	var s cpuSampler
+
+	assert.Empty(t, s.metrics([]cpu.TimesStat{
+		{User: 10, Idle: 10},
+		{User: 10, Idle: 10},
+	}))
+
+	metrics := s.metrics([]cpu.TimesStat{
+		{User: 20, Idle: 20},
+		{User: 10, Idle: 30},
+	})
+
+	values := make(map[model.MetricName]model.Gauge, len(metrics))
+	for _, metric := range metrics {
+		values[metric.ID] = *metric.Value
+	}
+
+	assert.Equal(t, model.Gauge(50), values["CPUutilization0"])
+	assert.Equal(t, model.Gauge(50), values["CPUuser0"])
+	assert.Equal(t, model.Gauge(0), values["CPUutilization1"])
+	assert.Equal(t, model.Gauge(25), values["CPUutilization"])
+	assert.Equal(t, model.Gauge(25), values["CPUuser"])
+	assert.Len(t, values, 15)
+
+	assert.Empty(t, s.metrics([]cpu.TimesStat{{User: 30, Idle: 30}}))
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"path"
+	"strings"
+)
+
+// PatternList is a comma-separated list of glob patterns, e.g. "eth*,wl*".
+type PatternList []string
+
+func (l *PatternList) UnmarshalText(text []byte) error {
+	list := PatternList{}
+	for _, pattern := range strings.Split(string(text), ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+		list = append(list, pattern)
+	}
+
+	*l = list
+
+	return nil
+}
+
+func (l *PatternList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *PatternList) Set(s string) error {
+	return l.UnmarshalText([]byte(s))
+}
+
+func (l PatternList) Match(names ...string) bool {
+	for _, pattern := range l {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filter selects devices by include and exclude lists. An empty include list
+// selects everything; exclude takes precedence over include.
+type filter struct {
+	include PatternList
+	exclude PatternList
+}
+
+func (f filter) allow(names ...string) bool {
+	if len(f.include) > 0 && !f.include.Match(names...) {
+		return false
+	}
+	return !f.exclude.Match(names...)
+}
@@ -0,0 +1,272 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+type metadataEntry struct {
+	id          model.MetricName
+	unit        string
+	description string
+}
+
+type metadataGroup struct {
+	collector string
+	mType     model.MetricType
+	// perCore groups also describe per-core metrics, which have the core
+	// index appended to their names, e.g. CPUutilization3.
+	perCore bool
+	entries []metadataEntry
+}
+
+var builtinMetadataGroups = []metadataGroup{
+	{
+		collector: CollectorMemStats,
+		mType:     model.MetricTypeGauge,
+		entries: []metadataEntry{
+			{"Alloc", "bytes", "Bytes of allocated heap objects."},
+			{"TotalAlloc", "bytes", "Cumulative bytes allocated for heap objects."},
+			{"BuckHashSys", "bytes", "Bytes of memory in profiling bucket hash tables."},
+			{"Frees", "objects", "Cumulative count of heap objects freed."},
+			{"GCCPUFraction", "ratio", "Fraction of the available CPU time used by the GC since the program started."},
+			{"GCSys", "bytes", "Bytes of memory in garbage collection metadata."},
+			{"HeapAlloc", "bytes", "Bytes of allocated heap objects."},
+			{"HeapIdle", "bytes", "Bytes in idle (unused) heap spans."},
+			{"HeapInuse", "bytes", "Bytes in in-use heap spans."},
+			{"HeapObjects", "objects", "Number of allocated heap objects."},
+			{"HeapReleased", "bytes", "Bytes of physical memory returned to the OS."},
+			{"HeapSys", "bytes", "Bytes of heap memory obtained from the OS."},
+			{"LastGC", "nanoseconds", "Time the last garbage collection finished, since the Unix epoch."},
+			{"Lookups", "lookups", "Number of pointer lookups performed by the runtime."},
+			{"MCacheInuse", "bytes", "Bytes of allocated mcache structures."},
+			{"MCacheSys", "bytes", "Bytes of memory obtained from the OS for mcache structures."},
+			{"MSpanInuse", "bytes", "Bytes of allocated mspan structures."},
+			{"MSpanSys", "bytes", "Bytes of memory obtained from the OS for mspan structures."},
+			{"Mallocs", "objects", "Cumulative count of heap objects allocated."},
+			{"NextGC", "bytes", "Target heap size of the next GC cycle."},
+			{"NumForcedGC", "cycles", "Number of GC cycles forced by the application."},
+			{"NumGC", "cycles", "Number of completed GC cycles."},
+			{"OtherSys", "bytes", "Bytes of memory in miscellaneous off-heap runtime allocations."},
+			{"PauseTotalNs", "nanoseconds", "Cumulative time spent in GC stop-the-world pauses."},
+			{"StackInuse", "bytes", "Bytes in stack spans."},
+			{"StackSys", "bytes", "Bytes of stack memory obtained from the OS."},
+			{"Sys", "bytes", "Total bytes of memory obtained from the OS."},
+		},
+	},
+	{
+		collector: CollectorRandom,
+		mType:     model.MetricTypeGauge,
+		entries: []metadataEntry{
+			{"RandomValue", "", "Random value updated on every poll."},
+		},
+	},
+	{
+		collector: CollectorPollCount,
+		mType:     model.MetricTypeCounter,
+		entries: []metadataEntry{
+			{"PollCount", "polls", "Number of polls made by the agent."},
+		},
+	},
+	{
+		collector: CollectorGopsutil,
+		mType:     model.MetricTypeGauge,
+		entries: []metadataEntry{
+			{"TotalMemory", "bytes", "Total amount of RAM on the host."},
+			{"FreeMemory", "bytes", "Amount of unused RAM on the host."},
+		},
+	},
+	{
+		collector: CollectorGopsutil,
+		mType:     model.MetricTypeGauge,
+		perCore:   true,
+		entries: []metadataEntry{
+			{"CPUutilization", "percent", "Share of CPU time not spent idle."},
+			{"CPUuser", "percent", "Share of CPU time spent in user mode."},
+			{"CPUsystem", "percent", "Share of CPU time spent in kernel mode."},
+			{"CPUiowait", "percent", "Share of CPU time spent waiting for I/O."},
+			{"CPUsteal", "percent", "Share of CPU time stolen by the hypervisor."},
+		},
+	},
+	{
+		collector: CollectorLoad,
+		mType:     model.MetricTypeGauge,
+		entries: []metadataEntry{
+			{"LoadAverage1", "", "System load average over 1 minute."},
+			{"LoadAverage5", "", "System load average over 5 minutes."},
+			{"LoadAverage15", "", "System load average over 15 minutes."},
+		},
+	},
+	{
+		collector: CollectorProcess,
+		mType:     model.MetricTypeGauge,
+		entries: []metadataEntry{
+			{"ProcessCount", "processes", "Number of processes on the host."},
+			{"ThreadCount", "threads", "Number of threads on the host."},
+			{"ProcessRunning", "processes", "Number of runnable processes."},
+			{"ProcessBlocked", "processes", "Number of processes blocked waiting for I/O."},
+		},
+	},
+	{
+		collector: CollectorDisk,
+		mType:     model.MetricTypeGauge,
+		entries: []metadataEntry{
+			{"DiskTotal", "bytes", "Total size of the file system."},
+			{"DiskFree", "bytes", "Free space of the file system."},
+			{"DiskUsed", "bytes", "Used space of the file system."},
+			{"DiskUsedPercent", "percent", "Share of the file system space in use."},
+		},
+	},
+	{
+		collector: CollectorDisk,
+		mType:     model.MetricTypeCounter,
+		entries: []metadataEntry{
+			{"DiskReadBytes", "bytes", "Bytes read from the disk."},
+			{"DiskWriteBytes", "bytes", "Bytes written to the disk."},
+			{"DiskReads", "operations", "Number of completed disk reads."},
+			{"DiskWrites", "operations", "Number of completed disk writes."},
+		},
+	},
+	{
+		collector: CollectorNet,
+		mType:     model.MetricTypeCounter,
+		entries: []metadataEntry{
+			{"NetBytesSent", "bytes", "Bytes sent by the network interface."},
+			{"NetBytesRecv", "bytes", "Bytes received by the network interface."},
+			{"NetPacketsSent", "packets", "Packets sent by the network interface."},
+			{"NetPacketsRecv", "packets", "Packets received by the network interface."},
+			{"NetErrorsIn", "errors", "Receive errors of the network interface."},
+			{"NetErrorsOut", "errors", "Transmit errors of the network interface."},
+			{"NetDropsIn", "packets", "Incoming packets dropped by the network interface."},
+			{"NetDropsOut", "packets", "Outgoing packets dropped by the network interface."},
+		},
+	},
+	{
+		collector: CollectorCgroup,
+		mType:     model.MetricTypeGauge,
+		entries: []metadataEntry{
+			{"CgroupMemoryUsage", "bytes", "Memory used by the cgroup."},
+			{"CgroupMemoryLimit", "bytes", "Memory limit of the cgroup."},
+			{"CgroupPidsCurrent", "processes", "Number of processes in the cgroup."},
+			{"CgroupPidsLimit", "processes", "Process limit of the cgroup."},
+		},
+	},
+	{
+		collector: CollectorCgroup,
+		mType:     model.MetricTypeCounter,
+		entries: []metadataEntry{
+			{"CgroupCPUUsageUsec", "microseconds", "CPU time consumed by the cgroup."},
+			{"CgroupCPUPeriods", "periods", "Number of elapsed CPU enforcement periods of the cgroup."},
+			{"CgroupCPUThrottledPeriods", "periods", "Number of CPU periods the cgroup was throttled in."},
+			{"CgroupCPUThrottledUsec", "microseconds", "Time the cgroup was throttled for."},
+		},
+	},
+}
+
+type builtinMetadataEntry struct {
+	metadata model.Metadata
+	perCore  bool
+}
+
+var builtinMetadata = func() map[model.MetricName]builtinMetadataEntry {
+	index := make(map[model.MetricName]builtinMetadataEntry)
+	for _, group := range builtinMetadataGroups {
+		for _, entry := range group.entries {
+			index[entry.id] = builtinMetadataEntry{
+				metadata: model.Metadata{
+					ID:          entry.id,
+					Unit:        entry.unit,
+					Description: entry.description,
+					Owner:       "agent/" + group.collector,
+					Type:        group.mType,
+				},
+				perCore: group.perCore,
+			}
+		}
+	}
+	return index
+}()
+
+// lookupBuiltinMetadata returns the metadata of a metric reported by one of
+// the built-in collectors.
+func lookupBuiltinMetadata(id model.MetricName) (model.Metadata, bool) {
+	if entry, ok := builtinMetadata[id]; ok {
+		return entry.metadata, true
+	}
+
+	name := strings.TrimRight(string(id), "0123456789")
+	if name == string(id) {
+		return model.Metadata{}, false
+	}
+
+	entry, ok := builtinMetadata[model.MetricName(name)]
+	if !ok || !entry.perCore {
+		return model.Metadata{}, false
+	}
+
+	metadata := entry.metadata
+	metadata.ID = id
+	metadata.Description = fmt.Sprintf("%s CPU core %s.", metadata.Description, string(id)[len(name):])
+
+	return metadata, true
+}
+
+// metadataSeeder collects the metadata of the built-in metrics seen by the
+// agent, so that it is posted to the server once per metric.
+type metadataSeeder struct {
+	sync.Mutex
+
+	seen     map[model.MetricName]bool
+	pending  []model.Metadata
+	disabled bool
+}
+
+func newMetadataSeeder() *metadataSeeder {
+	return &metadataSeeder{seen: make(map[model.MetricName]bool)}
+}
+
+func (s *metadataSeeder) observe(id model.MetricName) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.disabled || s.seen[id] {
+		return
+	}
+	s.seen[id] = true
+
+	if metadata, ok := lookupBuiltinMetadata(id); ok {
+		s.pending = append(s.pending, metadata)
+	}
+}
+
+// take removes and returns the metadata that hasn't been posted yet.
+func (s *metadataSeeder) take() []model.Metadata {
+	s.Lock()
+	defer s.Unlock()
+
+	pending := s.pending
+	s.pending = nil
+
+	return pending
+}
+
+// disable drops the pending metadata and stops collecting it.
+func (s *metadataSeeder) disable() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.disabled = true
+	s.seen = nil
+	s.pending = nil
+}
+
+// requeue returns metadata taken by take after a failed delivery.
+func (s *metadataSeeder) requeue(list []model.Metadata) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.pending = append(list, s.pending...)
+}
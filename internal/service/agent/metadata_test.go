@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/outbox"
+)
+
+func TestLookupBuiltinMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		id   model.MetricName
+		want *model.Metadata
+	}{
+		{
+			name: "memstats",
+			id:   "BuckHashSys",
+			want: &model.Metadata{
+				ID:          "BuckHashSys",
+				Unit:        "bytes",
+				Description: "Bytes of memory in profiling bucket hash tables.",
+				Owner:       "agent/memstats",
+				Type:        model.MetricTypeGauge,
+			},
+		},
+		{
+			name: "per-core",
+			id:   "CPUutilization3",
+			want: &model.Metadata{
+				ID:          "CPUutilization3",
+				Unit:        "percent",
+				Description: "Share of CPU time not spent idle. CPU core 3.",
+				Owner:       "agent/gopsutil",
+				Type:        model.MetricTypeGauge,
+			},
+		},
+		{
+			name: "name ending with digits",
+			id:   "LoadAverage15",
+			want: &model.Metadata{
+				ID:          "LoadAverage15",
+				Description: "System load average over 15 minutes.",
+				Owner:       "agent/load",
+				Type:        model.MetricTypeGauge,
+			},
+		},
+		{
+			name: "not per-core",
+			id:   "Alloc1",
+		},
+		{
+			name: "unknown",
+			id:   "metric1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, ok := lookupBuiltinMetadata(tt.id)
+			if tt.want == nil {
+				assert.False(t, ok)
+				return
+			}
+
+			require.True(t, ok)
+			assert.Equal(t, *tt.want, metadata)
+			assert.NoError(t, metadata.Validate())
+		})
+	}
+}
+
+func TestPostMetadata(t *testing.T) {
+	var requests int
+	var list []model.Metadata
+	status := http.StatusInternalServerError
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/metadata/", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("seed"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&list))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	a, err := NewAgent(Config{
+		PollInterval:        1 * time.Second,
+		ReportInterval:      1 * time.Second,
+		PostWorkersPoolSize: 1,
+		ReportMode:          ReportModeBatch,
+		WindowMaxSize:       10,
+		OutboxMaxSize:       10,
+		OutboxDropPolicy:    outbox.DropOldest,
+		Transport:           TransportHTTP,
+	}, NewHTTPTransport(Config{}, "", "", server.URL+"/metadata/"))
+	require.NoError(t, err)
+
+	a.queueMetrics(model.MetricFromCounter("PollCount", model.Counter(1)))
+	a.queueMetrics(model.MetricFromCounter("PollCount", model.Counter(1)))
+	a.queueMetrics(model.MetricFromGauge("metric1", model.Gauge(1)))
+
+	want := []model.Metadata{{
+		ID:          "PollCount",
+		Unit:        "polls",
+		Description: "Number of polls made by the agent.",
+		Owner:       "agent/pollcount",
+		Type:        model.MetricTypeCounter,
+	}}
+
+	// Failed deliveries are retried on the next report.
+	ctx := context.Background()
+	a.postMetadata(ctx)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, want, list)
+
+	status = http.StatusOK
+	a.postMetadata(ctx)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, want, list)
+
+	// Metadata is posted once per metric.
+	a.queueMetrics(model.MetricFromCounter("PollCount", model.Counter(1)))
+	a.postMetadata(ctx)
+	assert.Equal(t, 2, requests)
+}
+
+func TestPostMetadataNotSupported(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotImplemented)
+	}))
+	defer server.Close()
+
+	a, err := NewAgent(Config{
+		PollInterval:        1 * time.Second,
+		ReportInterval:      1 * time.Second,
+		PostWorkersPoolSize: 1,
+		ReportMode:          ReportModeBatch,
+		WindowMaxSize:       10,
+		OutboxMaxSize:       10,
+		OutboxDropPolicy:    outbox.DropOldest,
+		Transport:           TransportHTTP,
+	}, NewHTTPTransport(Config{}, "", "", server.URL+"/metadata/"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	a.queueMetrics(model.MetricFromCounter("PollCount", model.Counter(1)))
+	a.postMetadata(ctx)
+	assert.Equal(t, 1, requests)
+
+	// The metadata isn't retried, nor is the metadata of new metrics posted.
+	a.queueMetrics(model.MetricFromGauge("Alloc", model.Gauge(1)))
+	a.postMetadata(ctx)
+	assert.Equal(t, 1, requests)
+}
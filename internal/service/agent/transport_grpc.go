@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/metricspb"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+// GRPCTransport posts metrics to the gRPC API of the server.
+type GRPCTransport struct {
+	conn   *grpc.ClientConn
+	client metricspb.MetricsClient
+}
+
+func NewGRPCTransport(address string, opts ...grpc.DialOption) (*GRPCTransport, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+
+	conn, err := grpc.Dial(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GRPCTransport{
+		conn:   conn,
+		client: metricspb.NewMetricsClient(conn),
+	}, nil
+}
+
+func (t *GRPCTransport) PostMetric(ctx context.Context, metric model.Metric) error {
+	_, err := t.client.UpdateMetric(ctx, &metricspb.UpdateMetricRequest{
+		Metric: metricspb.MetricFromModel(metric),
+	})
+	return err
+}
+
+func (t *GRPCTransport) PostMetricList(ctx context.Context, metrics []model.Metric) error {
+	_, err := t.client.UpdateMetrics(ctx, &metricspb.UpdateMetricsRequest{
+		Metrics: metricspb.MetricListFromModel(metrics),
+	})
+	return err
+}
+
+func (t *GRPCTransport) PostMetadataList(ctx context.Context, list []model.Metadata) error {
+	_, err := t.client.UpdateMetadata(ctx, &metricspb.UpdateMetadataRequest{
+		Metadata: metricspb.MetadataListFromModel(list),
+		Seed:     true,
+	})
+	if status.Code(err) == codes.Unimplemented {
+		return fmt.Errorf("%w: %v", ErrMetadataNotSupported, err)
+	}
+	return err
+}
+
+func (t *GRPCTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/metricspb"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+type testMetricsServer struct {
+	metricspb.UnimplementedMetricsServer
+
+	metrics []model.Metric
+}
+
+func (s *testMetricsServer) UpdateMetric(
+	ctx context.Context,
+	req *metricspb.UpdateMetricRequest,
+) (*metricspb.UpdateMetricResponse, error) {
+	s.metrics = append(s.metrics, req.GetMetric().ToModel())
+	return &metricspb.UpdateMetricResponse{}, nil
+}
+
+func (s *testMetricsServer) UpdateMetrics(
+	ctx context.Context,
+	req *metricspb.UpdateMetricsRequest,
+) (*metricspb.UpdateMetricsResponse, error) {
+	for _, m := range req.GetMetrics() {
+		s.metrics = append(s.metrics, m.ToModel())
+	}
+	return &metricspb.UpdateMetricsResponse{}, nil
+}
+
+func TestGRPCTransport(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+	ms := &testMetricsServer{}
+	s := grpc.NewServer()
+	metricspb.RegisterMetricsServer(s, ms)
+	go s.Serve(listener)
+	defer s.Stop()
+
+	transport, err := NewGRPCTransport(
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+	)
+	require.NoError(t, err)
+	defer transport.Close()
+
+	gauge := model.MetricFromGauge("metric1", model.Gauge(1.5))
+	counter := model.MetricFromCounter("metric2", model.Counter(2))
+	counter.Labels = model.Labels{"host": "a"}
+
+	ctx := context.Background()
+	require.NoError(t, transport.PostMetric(ctx, gauge))
+	require.NoError(t, transport.PostMetricList(ctx, []model.Metric{counter}))
+
+	assert.Equal(t, []model.Metric{gauge, counter}, ms.metrics)
+}
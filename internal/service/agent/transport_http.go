@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+// HTTPTransport posts metrics as JSON to the REST API of the server.
+type HTTPTransport struct {
+	client      *resty.Client
+	updateURL   string
+	updatesURL  string
+	metadataURL string
+}
+
+func NewHTTPTransport(config Config, updateURL, updatesURL, metadataURL string) *HTTPTransport {
+	t := &http.Transport{}
+	t.MaxIdleConns = config.MaxIdleConns
+	t.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+
+	httpClient := &http.Client{
+		Transport: t,
+	}
+
+	client := resty.NewWithClient(httpClient)
+	client.
+		SetRetryCount(config.RetryCount).
+		SetRetryWaitTime(config.RetryWaitTime).
+		SetRetryMaxWaitTime(config.RetryMaxWaitTime)
+
+	return &HTTPTransport{
+		client:      client,
+		updateURL:   updateURL,
+		updatesURL:  updatesURL,
+		metadataURL: metadataURL,
+	}
+}
+
+func (t *HTTPTransport) PostMetric(ctx context.Context, metric model.Metric) error {
+	return t.post(ctx, t.updateURL, metric)
+}
+
+func (t *HTTPTransport) PostMetricList(ctx context.Context, metrics []model.Metric) error {
+	return t.post(ctx, t.updatesURL, metrics)
+}
+
+func (t *HTTPTransport) PostMetadataList(ctx context.Context, list []model.Metadata) error {
+	err := t.post(ctx, t.metadataURL+"?seed=true", list)
+
+	// Servers that don't keep metadata don't serve or implement it.
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && (statusErr.code == http.StatusNotFound || statusErr.code == http.StatusNotImplemented) {
+		return fmt.Errorf("%w: %v", ErrMetadataNotSupported, err)
+	}
+
+	return err
+}
+
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %s", e.status)
+}
+
+func (t *HTTPTransport) post(ctx context.Context, url string, body interface{}) error {
+	resp, err := t.client.R().
+		SetContext(ctx).
+		SetBody(body).
+		Post(url)
+	if err != nil {
+		return err
+	}
+
+	if resp.IsError() {
+		return &statusError{code: resp.StatusCode(), status: resp.Status()}
+	}
+
+	return nil
+}
+
+func (t *HTTPTransport) Close() error {
+	return nil
+}
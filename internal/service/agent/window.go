@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+// AggregationLabel marks the extra gauges reported for a GaugeAggregation.
+const AggregationLabel = "aggregation"
+
+type GaugeAggregation string
+
+const (
+	GaugeAggregationMin GaugeAggregation = "min"
+	GaugeAggregationMax GaugeAggregation = "max"
+	GaugeAggregationAvg GaugeAggregation = "avg"
+)
+
+func (g GaugeAggregation) Validate() error {
+	switch g {
+	case GaugeAggregationMin, GaugeAggregationMax, GaugeAggregationAvg:
+		return nil
+	default:
+		return fmt.Errorf("unknown GaugeAggregation: %s", g)
+	}
+}
+
+// GaugeAggregationList is a comma-separated list of gauge aggregations.
+type GaugeAggregationList []GaugeAggregation
+
+func (l *GaugeAggregationList) UnmarshalText(text []byte) error {
+	list := GaugeAggregationList{}
+	for _, s := range strings.Split(string(text), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		aggregation := GaugeAggregation(s)
+		if err := aggregation.Validate(); err != nil {
+			return err
+		}
+		list = append(list, aggregation)
+	}
+
+	*l = list
+
+	return nil
+}
+
+func (l *GaugeAggregationList) String() string {
+	if l == nil {
+		return ""
+	}
+
+	s := make([]string, 0, len(*l))
+	for _, aggregation := range *l {
+		s = append(s, string(aggregation))
+	}
+
+	return strings.Join(s, ",")
+}
+
+func (l *GaugeAggregationList) Set(s string) error {
+	return l.UnmarshalText([]byte(s))
+}
+
+func (l GaugeAggregationList) Validate() error {
+	for _, aggregation := range l {
+		if err := aggregation.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type metricKey struct {
+	mType model.MetricType
+	key   string
+}
+
+type windowEntry struct {
+	metric model.Metric
+	min    float64
+	max    float64
+	sum    float64
+	count  int
+}
+
+// window aggregates the polled metrics between two reports: counter deltas
+// are summed, histograms and summaries are merged, gauges keep the last value
+// along with min, max and average.
+// It holds at most maxSize distinct metrics and is allocated for size of them.
+type window struct {
+	sync.Mutex
+
+	maxSize      int
+	size         int
+	aggregations GaugeAggregationList
+	entries      map[metricKey]*windowEntry
+	order        []metricKey
+}
+
+func newWindow(maxSize, size int, aggregations GaugeAggregationList) *window {
+	return &window{
+		maxSize:      maxSize,
+		size:         size,
+		aggregations: aggregations,
+		entries:      make(map[metricKey]*windowEntry, size),
+	}
+}
+
+// add aggregates the metric into the window. It returns false if the
+// metric is new and the window is full.
+func (w *window) add(metric model.Metric) bool {
+	w.Lock()
+	defer w.Unlock()
+
+	key := metricKey{mType: metric.MType, key: metric.Key()}
+
+	e, ok := w.entries[key]
+	if !ok {
+		if len(w.entries) >= w.maxSize {
+			return false
+		}
+
+		e = &windowEntry{metric: metric.Clone()}
+		if metric.MType == model.MetricTypeGauge {
+			e.min, e.max = math.Inf(1), math.Inf(-1)
+		}
+		w.entries[key] = e
+		w.order = append(w.order, key)
+	} else if metric.MType == model.MetricTypeCounter {
+		delta := *e.metric.Delta + *metric.Delta
+		e.metric.Delta = &delta
+	} else if metric.MType == model.MetricTypeHistogram {
+		// Histograms whose bounds have changed start over.
+		if err := e.metric.Histogram.Merge(*metric.Histogram); err != nil {
+			e.metric = metric.Clone()
+		}
+	} else if metric.MType == model.MetricTypeSummary {
+		// Summaries whose accuracy has changed start over.
+		if err := e.metric.Summary.Merge(*metric.Summary); err != nil {
+			e.metric = metric.Clone()
+		}
+	} else {
+		e.metric = metric.Clone()
+	}
+	e.metric.Timestamp = metric.Timestamp
+
+	if metric.MType == model.MetricTypeGauge {
+		value := float64(*metric.Value)
+		e.min = math.Min(e.min, value)
+		e.max = math.Max(e.max, value)
+		e.sum += value
+		e.count++
+	}
+
+	return true
+}
+
+// drain returns the aggregates of the window in the order the metrics were
+// first polled and starts a new window.
+func (w *window) drain() []model.Metric {
+	w.Lock()
+	defer w.Unlock()
+
+	metrics := make([]model.Metric, 0, len(w.order)*(1+len(w.aggregations)))
+	for _, key := range w.order {
+		e := w.entries[key]
+		metrics = append(metrics, e.metric)
+
+		if e.metric.MType != model.MetricTypeGauge {
+			continue
+		}
+
+		for _, aggregation := range w.aggregations {
+			var value float64
+			switch aggregation {
+			case GaugeAggregationMin:
+				value = e.min
+			case GaugeAggregationMax:
+				value = e.max
+			case GaugeAggregationAvg:
+				value = e.sum / float64(e.count)
+			}
+			metrics = append(metrics, aggregatedGauge(e.metric, aggregation, value))
+		}
+	}
+
+	w.entries = make(map[metricKey]*windowEntry, w.size)
+	w.order = nil
+
+	return metrics
+}
+
+func aggregatedGauge(metric model.Metric, aggregation GaugeAggregation, value float64) model.Metric {
+	labels := make(model.Labels, len(metric.Labels)+1)
+	for name, v := range metric.Labels {
+		labels[name] = v
+	}
+	labels[AggregationLabel] = string(aggregation)
+
+	result := model.MetricFromGauge(string(metric.ID), model.Gauge(value))
+	result.Labels = labels
+	result.Timestamp = metric.Timestamp
+
+	return result
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func TestGaugeAggregationList_UnmarshalText(t *testing.T) {
+	var list GaugeAggregationList
+	require.NoError(t, list.UnmarshalText([]byte("min, avg")))
+	assert.Equal(t, GaugeAggregationList{GaugeAggregationMin, GaugeAggregationAvg}, list)
+
+	assert.Error(t, list.UnmarshalText([]byte("min,median")))
+}
+
+func TestWindow(t *testing.T) {
+	w := newWindow(2, 2, GaugeAggregationList{GaugeAggregationMax})
+
+	labelled := model.MetricFromGauge("metric1", model.Gauge(1))
+	labelled.Labels = model.Labels{"host": "a"}
+
+	assert.True(t, w.add(labelled))
+	assert.True(t, w.add(model.MetricFromCounter("metric2", model.Counter(1))))
+	assert.True(t, w.add(model.MetricFromCounter("metric2", model.Counter(1))))
+	assert.False(t, w.add(model.MetricFromGauge("metric3", model.Gauge(1))))
+
+	max := model.MetricFromGauge("metric1", model.Gauge(1))
+	max.Labels = model.Labels{"host": "a", AggregationLabel: string(GaugeAggregationMax)}
+
+	assert.Equal(t, []model.Metric{
+		labelled,
+		max,
+		model.MetricFromCounter("metric2", model.Counter(2)),
+	}, w.drain())
+
+	assert.True(t, w.add(model.MetricFromGauge("metric3", model.Gauge(1))))
+}
+
+func TestWindowHistogram(t *testing.T) {
+	w := newWindow(10, 10, nil)
+
+	h := model.NewHistogram([]float64{1})
+	h.Observe(0.5)
+
+	assert.True(t, w.add(model.MetricFromHistogram("metric1", h)))
+	assert.True(t, w.add(model.MetricFromHistogram("metric1", h)))
+	assert.Equal(t, []model.Metric{
+		model.MetricFromHistogram("metric1", model.Histogram{
+			Bounds: []float64{1},
+			Counts: []uint64{2, 0},
+			Count:  2,
+			Sum:    1,
+		}),
+	}, w.drain())
+
+	// A histogram with other bounds replaces the aggregated one.
+	assert.True(t, w.add(model.MetricFromHistogram("metric1", h)))
+	assert.True(t, w.add(model.MetricFromHistogram("metric1", model.NewHistogram([]float64{2}))))
+	assert.Equal(t, []model.Metric{
+		model.MetricFromHistogram("metric1", model.NewHistogram([]float64{2})),
+	}, w.drain())
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/metricspb"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+type GRPCHandler struct {
+	metricspb.UnimplementedMetricsServer
+
+	Server *Server
+}
+
+func NewGRPCHandler(server *Server) (*GRPCHandler, error) {
+	if server == nil {
+		return nil, errors.New("invalid server value: nil")
+	}
+
+	return &GRPCHandler{Server: server}, nil
+}
+
+func NewGRPCServer(h *GRPCHandler, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	metricspb.RegisterMetricsServer(s, h)
+	return s
+}
+
+func (h *GRPCHandler) validateMetric(metric model.Metric) error {
+	if err := metric.MType.Validate(); err != nil {
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+
+	if err := metric.Validate(); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	valid, err := h.Server.ValidateHash(metric)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	if !valid {
+		return status.Error(codes.InvalidArgument, "invalid hash value")
+	}
+
+	return nil
+}
+
+// pushErrorStatus converts a failed push into a status error. Metric names
+// rejected by the name policy, timestamps too far ahead and histograms or
+// summaries that can't be merged into the stored ones are invalid
+// arguments.
+func pushErrorStatus(err error) error {
+	var nameErr *model.NameError
+	var timestampErr *model.TimestampError
+	if errors.As(err, &nameErr) || errors.As(err, &timestampErr) || isMergeMismatch(err) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (h *GRPCHandler) UpdateMetric(
+	ctx context.Context,
+	req *metricspb.UpdateMetricRequest,
+) (*metricspb.UpdateMetricResponse, error) {
+	if req.GetMetric() == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing metric")
+	}
+
+	metric := req.GetMetric().ToModel()
+	if err := h.validateMetric(metric); err != nil {
+		return nil, err
+	}
+
+	if err := h.Server.PushMetric(ctx, metric); err != nil {
+		return nil, pushErrorStatus(err)
+	}
+
+	return &metricspb.UpdateMetricResponse{}, nil
+}
+
+func (h *GRPCHandler) UpdateMetrics(
+	ctx context.Context,
+	req *metricspb.UpdateMetricsRequest,
+) (*metricspb.UpdateMetricsResponse, error) {
+	metrics := make([]model.Metric, 0, len(req.GetMetrics()))
+
+	for _, m := range req.GetMetrics() {
+		metric := m.ToModel()
+		if err := h.validateMetric(metric); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+
+	if err := h.Server.PushMetricList(ctx, metrics); err != nil {
+		return nil, pushErrorStatus(err)
+	}
+
+	return &metricspb.UpdateMetricsResponse{}, nil
+}
+
+func (h *GRPCHandler) GetMetric(
+	ctx context.Context,
+	req *metricspb.GetMetricRequest,
+) (*metricspb.GetMetricResponse, error) {
+	metric := model.Metric{
+		ID:    model.MetricName(req.GetId()),
+		MType: model.MetricType(req.GetType()),
+	}
+
+	if len(req.GetLabels()) > 0 {
+		metric.Labels = req.GetLabels()
+	}
+
+	if err := metric.MType.Validate(); err != nil {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+
+	if err := metric.ID.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := metric.Labels.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	m, err := h.Server.LoadMetric(ctx, metric)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if m == nil {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("Metric %s not found", metric.Key()))
+	}
+
+	return &metricspb.GetMetricResponse{Metric: metricspb.MetricFromModel(*m)}, nil
+}
+
+func (h *GRPCHandler) ListMetrics(
+	ctx context.Context,
+	req *metricspb.ListMetricsRequest,
+) (*metricspb.ListMetricsResponse, error) {
+	metrics, err := h.Server.LoadMetricList(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &metricspb.ListMetricsResponse{Metrics: metricspb.MetricListFromModel(metrics)}, nil
+}
+
+func (h *GRPCHandler) UpdateMetadata(
+	ctx context.Context,
+	req *metricspb.UpdateMetadataRequest,
+) (*metricspb.UpdateMetadataResponse, error) {
+	list := make([]model.Metadata, 0, len(req.GetMetadata()))
+
+	for _, m := range req.GetMetadata() {
+		metadata := m.ToModel()
+		if err := metadata.Validate(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		list = append(list, metadata)
+	}
+
+	save := h.Server.SaveMetadataList
+	if req.GetSeed() {
+		save = h.Server.SeedMetadataList
+	}
+
+	err := save(ctx, list)
+	if errors.Is(err, ErrMetadataNotSupported) {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+	if err != nil {
+		return nil, pushErrorStatus(err)
+	}
+
+	return &metricspb.UpdateMetadataResponse{}, nil
+}
+
+func (h *GRPCHandler) Ping(
+	ctx context.Context,
+	req *metricspb.PingRequest,
+) (*metricspb.PingResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	if err := h.Server.Heartbeat(ctx); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	return &metricspb.PingResponse{}, nil
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/metricspb"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	storagemock "github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/mock"
+)
+
+func newTestGRPCClient(t *testing.T, srv *Server) metricspb.MetricsClient {
+	h, err := NewGRPCHandler(srv)
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	s := NewGRPCServer(h)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial(
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return metricspb.NewMetricsClient(conn)
+}
+
+func TestGRPCUpdateMetric(t *testing.T) {
+	key := "secret"
+
+	signed := model.MetricFromGauge("metric1", model.Gauge(1.5))
+	require.NoError(t, signed.UpdateHash(key))
+
+	badHash := model.MetricFromGauge("metric1", model.Gauge(1.5))
+	badHash.Hash = "bad"
+
+	stamped := model.MetricFromGauge("metric2", model.Gauge(1.5))
+	stamped.Timestamp = 1700000000000
+	require.NoError(t, stamped.UpdateHash(key))
+
+	// The hash covers the timestamp.
+	restamped := stamped
+	restamped.Timestamp++
+
+	tests := []struct {
+		name     string
+		metric   *metricspb.Metric
+		wantCode codes.Code
+	}{
+		{
+			name:     "Valid signed gauge",
+			metric:   metricspb.MetricFromModel(signed),
+			wantCode: codes.OK,
+		},
+		{
+			name:     "Invalid hash",
+			metric:   metricspb.MetricFromModel(badHash),
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Valid signed timestamped gauge",
+			metric:   metricspb.MetricFromModel(stamped),
+			wantCode: codes.OK,
+		},
+		{
+			name:     "Tampered timestamp",
+			metric:   metricspb.MetricFromModel(restamped),
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Invalid MType",
+			metric:   &metricspb.Metric{Id: "metric1", Type: "unknown"},
+			wantCode: codes.Unimplemented,
+		},
+		{
+			name:     "Missing metric",
+			metric:   nil,
+			wantCode: codes.InvalidArgument,
+		},
+	}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	metricStorage.EXPECT().SaveMetric(gomock.Any(), signed).Return(nil)
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), stamped).Return(nil, nil)
+	metricStorage.EXPECT().SaveMetric(gomock.Any(), stamped).Return(nil)
+
+	srv, err := NewServer(Config{StoreInterval: 1 * time.Second, Key: key}, metricStorage)
+	require.NoError(t, err)
+	client := newTestGRPCClient(t, srv)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.UpdateMetric(context.Background(), &metricspb.UpdateMetricRequest{Metric: tt.metric})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestGRPCUpdateMetrics(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	gauge := model.MetricFromGauge("metric1", model.Gauge(1.5))
+	counter := model.MetricFromCounter("metric2", model.Counter(2))
+	counter.Labels = model.Labels{"host": "a"}
+	histogram := model.MetricFromHistogram("metric3", newTestHistogram())
+	summary := model.MetricFromSummary("metric4", newTestSummary(t))
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	metricStorage.EXPECT().SaveMetricList(gomock.Any(), []model.Metric{gauge}).Return(nil)
+	metricStorage.EXPECT().IncrMetricList(gomock.Any(), []model.Metric{counter, histogram, summary}).Return(nil)
+
+	srv, err := NewServer(Config{StoreInterval: 1 * time.Second}, metricStorage)
+	require.NoError(t, err)
+	client := newTestGRPCClient(t, srv)
+
+	_, err = client.UpdateMetrics(context.Background(), &metricspb.UpdateMetricsRequest{
+		Metrics: metricspb.MetricListFromModel([]model.Metric{gauge, counter, histogram, summary}),
+	})
+	require.NoError(t, err)
+}
+
+func TestGRPCGetMetric(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	metric := model.MetricFromGauge("metric1", model.Gauge(1.5))
+	query := model.Metric{ID: "metric1", MType: model.MetricTypeGauge}
+	missing := model.Metric{ID: "metric2", MType: model.MetricTypeGauge}
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), query).Return(&metric, nil)
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), missing).Return(nil, nil)
+
+	srv, err := NewServer(Config{StoreInterval: 1 * time.Second}, metricStorage)
+	require.NoError(t, err)
+	client := newTestGRPCClient(t, srv)
+
+	resp, err := client.GetMetric(context.Background(), &metricspb.GetMetricRequest{
+		Id:   "metric1",
+		Type: string(model.MetricTypeGauge),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, metric, resp.GetMetric().ToModel())
+
+	_, err = client.GetMetric(context.Background(), &metricspb.GetMetricRequest{
+		Id:   "metric2",
+		Type: string(model.MetricTypeGauge),
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCUpdateMetadata(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	metricStorage := newMetadataMetricStorage(mockCtrl)
+	metricStorage.MockMetadataStorage.EXPECT().SaveMetadata(gomock.Any(), testAllocMetadata).Return(nil)
+	metricStorage.MockMetadataStorage.EXPECT().SeedMetadata(gomock.Any(), testAllocMetadata).Return(nil)
+
+	srv, err := NewServer(Config{StoreInterval: 1 * time.Second}, metricStorage)
+	require.NoError(t, err)
+	client := newTestGRPCClient(t, srv)
+
+	_, err = client.UpdateMetadata(context.Background(), &metricspb.UpdateMetadataRequest{
+		Metadata: metricspb.MetadataListFromModel([]model.Metadata{testAllocMetadata}),
+	})
+	require.NoError(t, err)
+
+	_, err = client.UpdateMetadata(context.Background(), &metricspb.UpdateMetadataRequest{
+		Metadata: metricspb.MetadataListFromModel([]model.Metadata{testAllocMetadata}),
+		Seed:     true,
+	})
+	require.NoError(t, err)
+
+	_, err = client.UpdateMetadata(context.Background(), &metricspb.UpdateMetadataRequest{
+		Metadata: []*metricspb.Metadata{{Id: "Alloc", Type: "abrakadabra"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCUpdateMetricsMergeMismatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	histogram := model.MetricFromHistogram("metric1", newTestHistogram())
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	metricStorage.EXPECT().SaveMetricList(gomock.Any(), []model.Metric{}).Return(nil)
+	metricStorage.EXPECT().IncrMetricList(gomock.Any(), []model.Metric{histogram}).Return(model.ErrHistogramBoundsMismatch)
+
+	srv, err := NewServer(Config{StoreInterval: 1 * time.Second}, metricStorage)
+	require.NoError(t, err)
+	client := newTestGRPCClient(t, srv)
+
+	_, err = client.UpdateMetrics(context.Background(), &metricspb.UpdateMetricsRequest{
+		Metrics: metricspb.MetricListFromModel([]model.Metric{histogram}),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCUpdateMetricsInvalidName(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+
+	srv, err := NewServer(Config{StoreInterval: 1 * time.Second}, metricStorage)
+	require.NoError(t, err)
+	client := newTestGRPCClient(t, srv)
+
+	_, err = client.UpdateMetrics(context.Background(), &metricspb.UpdateMetricsRequest{
+		Metrics: metricspb.MetricListFromModel([]model.Metric{
+			model.MetricFromGauge("metric1", model.Gauge(1)),
+			model.MetricFromGauge("disk used", model.Gauge(1)),
+		}),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
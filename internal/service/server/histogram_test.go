@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/common/testutils"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	storagemock "github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/mock"
+)
+
+func newTestHistogram() model.Histogram {
+	h := model.NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(0.7)
+	return h
+}
+
+func TestUpdateHistogramListWithBody(t *testing.T) {
+	latency := model.MetricFromHistogram("latency", newTestHistogram())
+
+	invalid := model.MetricFromHistogram("latency", newTestHistogram())
+	invalid.Histogram.Count = 1
+
+	tests := []struct {
+		name       string
+		metrics    []model.Metric
+		storageErr error
+		wantCode   int
+	}{
+		{
+			name:     "Histogram",
+			metrics:  []model.Metric{latency},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Invalid count",
+			metrics:  []model.Metric{invalid},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Missing histogram",
+			metrics:  []model.Metric{{ID: "latency", MType: model.MetricTypeHistogram}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Bounds mismatch",
+			metrics:    []model.Metric{latency},
+			storageErr: model.ErrHistogramBoundsMismatch,
+			wantCode:   http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+
+			metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+			h := newTestHandler(t, metricStorage)
+			server := httptest.NewServer(h.Router)
+			defer server.Close()
+
+			if tt.wantCode == http.StatusOK || tt.storageErr != nil {
+				gomock.InOrder(
+					metricStorage.EXPECT().SaveMetricList(gomock.Any(), []model.Metric{}).Return(nil),
+					metricStorage.EXPECT().IncrMetricList(gomock.Any(), tt.metrics).Return(tt.storageErr),
+				)
+			}
+
+			data, err := json.Marshal(tt.metrics)
+			require.NoError(t, err)
+
+			statusCode, _ := testutils.DoRequest(t, server, http.MethodPost, "/updates/", &data)
+			assert.Equal(t, tt.wantCode, statusCode)
+		})
+	}
+}
+
+func TestGetHistogram(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	latency := model.MetricFromHistogram("latency", newTestHistogram())
+	latency.Labels = model.Labels{"handler": "update"}
+
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), gomock.Any()).Return(&latency, nil).Times(2)
+	metricStorage.EXPECT().LoadMetricList(gomock.Any()).Return([]model.Metric{latency}, nil).Times(2)
+
+	statusCode, body := testutils.DoRequest(t, server, http.MethodGet, "/value/histogram/latency?label=handler=update", nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "count=3 sum=1.25 {0.1:1 1:2 +Inf:0}", body)
+
+	data := []byte(`{"id":"latency","type":"histogram","labels":{"handler":"update"}}`)
+	statusCode, body = testutils.DoRequest(t, server, http.MethodPost, "/value/", &data)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.JSONEq(t, `{
+		"id": "latency",
+		"type": "histogram",
+		"histogram": {"bounds": [0.1, 1], "counts": [1, 2, 0], "count": 3, "sum": 1.25},
+		"labels": {"handler": "update"}
+	}`, body)
+
+	statusCode, body = testutils.DoRequest(t, server, http.MethodGet, "/", nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, body, "latency{handler=&#34;update&#34;}: count=3 sum=1.25 {0.1:1 1:2 &#43;Inf:0}")
+
+	want := `# HELP latency Metric latency of type histogram.
+# TYPE latency histogram
+latency_bucket{handler="update",le="0.1"} 1
+latency_bucket{handler="update",le="1"} 3
+latency_bucket{handler="update",le="+Inf"} 3
+latency_sum{handler="update"} 1.25
+latency_count{handler="update"} 3
+`
+	statusCode, body = testutils.DoRequest(t, server, http.MethodGet, "/metrics", nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, want, body)
+}
+
+func TestUpdateHistogramWithURL(t *testing.T) {
+	h := newTestHandler(t, storagemock.NewMockMetricStorage(nil))
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	statusCode, _ := testutils.DoRequest(t, server, http.MethodPost, "/update/histogram/latency/1", nil)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+}
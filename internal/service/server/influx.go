@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ingest/influx"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+type influxErrorResponse struct {
+	Code    string             `json:"code"`
+	Message string             `json:"message"`
+	Errors  []influx.LineError `json:"errors"`
+}
+
+// influxWrite receives a batch in InfluxDB line protocol. The valid lines
+// are stored even if some lines are invalid; in that case the response is
+// 400 with an error for every invalid line. The counter baselines move only
+// if the batch is stored, so a retry after a failure isn't lost.
+//
+// Line timestamps are in the unit given by the precision parameter,
+// nanoseconds by default.
+func (h *Handler) influxWrite(w http.ResponseWriter, r *http.Request) {
+	precision, err := influx.ParsePrecision(r.URL.Query().Get("precision"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics, lineErrors, err := h.influx.Parse(r.Body, precision)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.influx.Convert(metrics, func(metrics []model.Metric) error {
+		return h.Server.PushMetricList(r.Context(), metrics)
+	})
+	if err != nil {
+		writePushError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if len(lineErrors) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	data, err := json.Marshal(influxErrorResponse{
+		Code:    "invalid",
+		Message: fmt.Sprintf("partial write: %d lines rejected", len(lineErrors)),
+		Errors:  lineErrors,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	fmt.Fprint(w, string(data))
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/common/testutils"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	storagemock "github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/mock"
+)
+
+func TestInfluxWrite(t *testing.T) {
+	usage := model.MetricFromGauge("cpu_usage", model.Gauge(1.5))
+	usage.Labels = model.Labels{"host": "a"}
+
+	stamped := usage
+	stamped.Timestamp = 1700000000000
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		gauges     []model.Metric
+		code       int
+		lineErrors []int
+	}{
+		{
+			name:   "Valid batch",
+			path:   "/api/v2/write",
+			body:   "cpu,host=a usage=1.5\nmem used=2i\n",
+			gauges: []model.Metric{usage, model.MetricFromGauge("mem_used", model.Gauge(2))},
+			code:   http.StatusNoContent,
+		},
+		{
+			name:       "Partially invalid batch",
+			path:       "/write",
+			body:       "cpu,host=a usage=1.5\nmem used=abc\ndisk\n",
+			gauges:     []model.Metric{usage},
+			code:       http.StatusBadRequest,
+			lineErrors: []int{2, 3},
+		},
+		{
+			name:   "Seconds precision",
+			path:   "/write?precision=s",
+			body:   "cpu,host=a usage=1.5 1700000000\n",
+			gauges: []model.Metric{stamped},
+			code:   http.StatusNoContent,
+		},
+		{
+			name: "Invalid precision",
+			path: "/api/v2/write?precision=abrakadabra",
+			body: "cpu,host=a usage=1.5 1700000000\n",
+			code: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid batch",
+			path:       "/write",
+			body:       "mem used=abc\n",
+			code:       http.StatusBadRequest,
+			lineErrors: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+			for _, gauge := range tt.gauges {
+				if gauge.Timestamp != 0 {
+					metricStorage.EXPECT().LoadMetric(gomock.Any(), gauge).Return(nil, nil)
+				}
+			}
+			if tt.gauges != nil {
+				metricStorage.EXPECT().SaveMetricList(gomock.Any(), tt.gauges).Return(nil)
+				metricStorage.EXPECT().IncrMetricList(gomock.Any(), []model.Metric{}).Return(nil)
+			}
+
+			h := newTestHandler(t, metricStorage)
+			server := httptest.NewServer(h.Router)
+			defer server.Close()
+
+			body := []byte(tt.body)
+			code, respBody := testutils.DoRequest(t, server, http.MethodPost, tt.path, &body)
+			require.Equal(t, tt.code, code)
+
+			if tt.lineErrors == nil {
+				return
+			}
+
+			var resp influxErrorResponse
+			require.NoError(t, json.Unmarshal([]byte(respBody), &resp))
+			lines := make([]int, 0, len(resp.Errors))
+			for _, e := range resp.Errors {
+				lines = append(lines, e.Line)
+			}
+			assert.Equal(t, tt.lineErrors, lines)
+		})
+	}
+}
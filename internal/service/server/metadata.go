@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+// updateMetadataList merges a JSON list of metadata into the stored one.
+// Empty fields keep their stored values. With seed=true, only the metrics
+// without metadata get it.
+func (h *Handler) updateMetadataList(w http.ResponseWriter, r *http.Request) {
+	seed := false
+	if value := r.URL.Query().Get("seed"); value != "" {
+		var err error
+		if seed, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, fmt.Sprintf("invalid seed: %q", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var list []model.Metadata
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, metadata := range list {
+		if err := metadata.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	save := h.Server.SaveMetadataList
+	if seed {
+		save = h.Server.SeedMetadataList
+	}
+
+	err := save(r.Context(), list)
+	if errors.Is(err, ErrMetadataNotSupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		writePushError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, struct{}{})
+}
+
+func (h *Handler) getMetadataList(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Server.LoadMetadataList(r.Context())
+	if errors.Is(err, ErrMetadataNotSupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if list == nil {
+		list = []model.Metadata{}
+	}
+
+	writeJSON(w, list)
+}
+
+func (h *Handler) getMetadata(w http.ResponseWriter, r *http.Request) {
+	id := model.MetricName(chi.URLParam(r, "metricName"))
+	if err := id.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := h.Server.LoadMetadata(r.Context(), id)
+	if errors.Is(err, ErrMetadataNotSupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if metadata == nil {
+		http.Error(w, fmt.Sprintf("Metadata of %s not found", id), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, metadata)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, string(data))
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/common/testutils"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	storagemock "github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/mock"
+)
+
+type metadataMetricStorage struct {
+	*storagemock.MockMetricStorage
+	*storagemock.MockMetadataStorage
+}
+
+func newMetadataMetricStorage(mockCtrl *gomock.Controller) metadataMetricStorage {
+	return metadataMetricStorage{
+		MockMetricStorage:   storagemock.NewMockMetricStorage(mockCtrl),
+		MockMetadataStorage: storagemock.NewMockMetadataStorage(mockCtrl),
+	}
+}
+
+var testAllocMetadata = model.Metadata{
+	ID:          "Alloc",
+	Unit:        "bytes",
+	Description: "Bytes of allocated heap objects.",
+	Owner:       "agent/memstats",
+	Type:        model.MetricTypeGauge,
+}
+
+func TestUpdateMetadataList(t *testing.T) {
+	type want struct {
+		code int
+		body string
+	}
+	tests := []struct {
+		name  string
+		query string
+		body  string
+		save  []model.Metadata
+		seed  []model.Metadata
+		want  want
+	}{
+		{
+			name: "Valid metadata",
+			body: `[{"id":"Alloc","unit":"bytes","description":"Bytes of allocated heap objects.","owner":"agent/memstats","type":"gauge"}]`,
+			save: []model.Metadata{testAllocMetadata},
+			want: want{
+				code: http.StatusOK,
+				body: `{}`,
+			},
+		},
+		{
+			name:  "Seeded metadata",
+			query: "?seed=true",
+			body:  `[{"id":"Alloc","unit":"bytes","description":"Bytes of allocated heap objects.","owner":"agent/memstats","type":"gauge"}]`,
+			seed:  []model.Metadata{testAllocMetadata},
+			want: want{
+				code: http.StatusOK,
+				body: `{}`,
+			},
+		},
+		{
+			name:  "Invalid seed",
+			query: "?seed=abrakadabra",
+			body:  `[{"id":"Alloc"}]`,
+			want: want{
+				code: http.StatusBadRequest,
+				body: "invalid seed: \"abrakadabra\"\n",
+			},
+		},
+		{
+			name: "Invalid type",
+			body: `[{"id":"Alloc","type":"abrakadabra"}]`,
+			want: want{
+				code: http.StatusBadRequest,
+				body: "unknown MetricType: abrakadabra\n",
+			},
+		},
+		{
+			name: "Invalid body",
+			body: `{"id":"Alloc"}`,
+			want: want{
+				code: http.StatusBadRequest,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+
+			metricStorage := newMetadataMetricStorage(mockCtrl)
+			h := newTestHandler(t, metricStorage)
+			server := httptest.NewServer(h.Router)
+			defer server.Close()
+
+			for _, metadata := range tt.save {
+				metricStorage.MockMetadataStorage.EXPECT().SaveMetadata(gomock.Any(), metadata).Return(nil)
+			}
+			for _, metadata := range tt.seed {
+				metricStorage.MockMetadataStorage.EXPECT().SeedMetadata(gomock.Any(), metadata).Return(nil)
+			}
+
+			data := []byte(tt.body)
+			statusCode, body := testutils.DoRequest(t, server, http.MethodPost, "/metadata/"+tt.query, &data)
+			assert.Equal(t, tt.want.code, statusCode)
+			if tt.want.body != "" {
+				assert.Equal(t, tt.want.body, body)
+			}
+		})
+	}
+}
+
+func TestGetMetadata(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := newMetadataMetricStorage(mockCtrl)
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	metricStorage.MockMetadataStorage.EXPECT().LoadMetadata(gomock.Any(), model.MetricName("Alloc")).
+		Return(&testAllocMetadata, nil)
+	metricStorage.MockMetadataStorage.EXPECT().LoadMetadata(gomock.Any(), model.MetricName("Sys")).
+		Return(nil, nil)
+	metricStorage.MockMetadataStorage.EXPECT().LoadMetadataList(gomock.Any()).
+		Return([]model.Metadata{{ID: "Sys"}, testAllocMetadata}, nil)
+
+	wantAlloc := `{"id":"Alloc","unit":"bytes","description":"Bytes of allocated heap objects.","owner":"agent/memstats","type":"gauge"}`
+
+	statusCode, body := testutils.DoRequest(t, server, http.MethodGet, "/metadata/Alloc", nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, wantAlloc, body)
+
+	statusCode, _ = testutils.DoRequest(t, server, http.MethodGet, "/metadata/Sys", nil)
+	assert.Equal(t, http.StatusNotFound, statusCode)
+
+	statusCode, body = testutils.DoRequest(t, server, http.MethodGet, "/metadata/", nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, `[`+wantAlloc+`,{"id":"Sys"}]`, body)
+}
+
+func TestMetadataNotSupported(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	data := []byte(`[{"id":"Alloc","unit":"bytes"}]`)
+	statusCode, _ := testutils.DoRequest(t, server, http.MethodPost, "/metadata/", &data)
+	assert.Equal(t, http.StatusNotImplemented, statusCode)
+
+	statusCode, _ = testutils.DoRequest(t, server, http.MethodGet, "/metadata/Alloc", nil)
+	assert.Equal(t, http.StatusNotImplemented, statusCode)
+}
+
+func TestGetMetricListWithMetadata(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := newMetadataMetricStorage(mockCtrl)
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	metricStorage.MockMetricStorage.EXPECT().LoadMetricList(gomock.Any()).Return([]model.Metric{
+		model.MetricFromGauge("Alloc", model.Gauge(1)),
+		model.MetricFromCounter("PollCount", model.Counter(7)),
+	}, nil).Times(2)
+	metricStorage.MockMetadataStorage.EXPECT().LoadMetadataList(gomock.Any()).
+		Return([]model.Metadata{testAllocMetadata}, nil).Times(2)
+
+	statusCode, body := testutils.DoRequest(t, server, http.MethodGet, "/", nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, body, "<div>Alloc: 1 bytes &mdash; Bytes of allocated heap objects. (owner: agent/memstats)</div>")
+	assert.Contains(t, body, "<div>PollCount: 7</div>")
+
+	want := `# HELP Alloc Bytes of allocated heap objects. Unit: bytes.
+# TYPE Alloc gauge
+Alloc 1
+# HELP PollCount Metric PollCount of type counter.
+# TYPE PollCount counter
+PollCount 7
+`
+
+	statusCode, body = testutils.DoRequest(t, server, http.MethodGet, "/metrics", nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, want, body)
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/common/testutils"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	storagemock "github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/mock"
+)
+
+func TestNamePolicyRejections(t *testing.T) {
+	longName := strings.Repeat("a", model.DefaultNameMaxLength+1)
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		wantID string
+	}{
+		{
+			name:   "URL",
+			path:   "/update/gauge/" + longName + "/1",
+			wantID: longName,
+		},
+		{
+			name:   "JSON",
+			path:   "/update/",
+			body:   `{"id":"disk used","type":"gauge","value":1}`,
+			wantID: "disk used",
+		},
+		{
+			name:   "JSON list",
+			path:   "/updates/",
+			body:   `[{"id":"metric1","type":"gauge","value":1},{"id":"disk/used","type":"gauge","value":1}]`,
+			wantID: "disk/used",
+		},
+		{
+			name:   "Metadata",
+			path:   "/metadata/",
+			body:   `[{"id":"disk used","unit":"bytes"}]`,
+			wantID: "disk used",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+
+			// Nothing is stored, as the mocks expect no calls.
+			h := newTestHandler(t, newMetadataMetricStorage(mockCtrl))
+			server := httptest.NewServer(h.Router)
+			defer server.Close()
+
+			var data *[]byte
+			if tt.body != "" {
+				body := []byte(tt.body)
+				data = &body
+			}
+
+			statusCode, body := testutils.DoRequest(t, server, http.MethodPost, tt.path, data)
+			assert.Equal(t, http.StatusBadRequest, statusCode)
+
+			var resp errorResponse
+			require.NoError(t, json.Unmarshal([]byte(body), &resp))
+			assert.Equal(t, "invalid_metric_name", resp.Code)
+			assert.Equal(t, tt.wantID, resp.ID)
+			assert.NotEmpty(t, resp.Message)
+		})
+	}
+}
+
+func TestNamePolicyInfluxLines(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	// Only the line with the rejected name fails.
+	metricStorage.EXPECT().SaveMetricList(gomock.Any(), []model.Metric{model.MetricFromGauge("cpu_usage", model.Gauge(1))}).Return(nil)
+	metricStorage.EXPECT().IncrMetricList(gomock.Any(), []model.Metric{}).Return(nil)
+
+	data := []byte("cpu usage=1\ndisk\\ io,host=a read=1\n")
+	statusCode, body := testutils.DoRequest(t, server, http.MethodPost, "/write", &data)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+
+	var resp influxErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, 2, resp.Errors[0].Line)
+	assert.Contains(t, resp.Errors[0].Err, "disk io_read")
+}
+
+func TestNamePolicyWebSocket(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	srv, err := NewServer(Config{StoreInterval: 1 * time.Second, NameCase: model.NameCaseLower}, metricStorage)
+	require.NoError(t, err)
+
+	h, err := NewHandler(srv)
+	require.NoError(t, err)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	conn := dialWebSocket(t, server)
+	defer conn.Close()
+
+	alloc := model.Metric{ID: "alloc", MType: model.MetricTypeGauge}
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), alloc).Return(nil, nil)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsSubscribe, Metrics: []model.Metric{{ID: "Alloc", MType: model.MetricTypeGauge}}}))
+	assert.Equal(t, wsSnapshot, readWebSocket(t, conn).Type)
+
+	// The subscription matches the update published under the normalised name.
+	stored := model.MetricFromGauge("alloc", model.Gauge(1))
+	metricStorage.EXPECT().SaveMetric(gomock.Any(), stored).Return(nil)
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), alloc).Return(&stored, nil)
+
+	require.NoError(t, srv.PushMetric(context.Background(), model.MetricFromGauge("ALLOC", model.Gauge(1))))
+	assert.Equal(t, wsMessage{Type: wsUpdate, Metrics: []model.Metric{stored}}, readWebSocket(t, conn))
+}
+
+func TestNamePolicyNormalisation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	srv, err := NewServer(Config{
+		StoreInterval:      1 * time.Second,
+		NameReservedPrefix: "__",
+		NameCase:           model.NameCaseLower,
+		NameSeparator:      "_",
+	}, metricStorage)
+	require.NoError(t, err)
+
+	h, err := NewHandler(srv)
+	require.NoError(t, err)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	stored := model.MetricFromGauge("http_server_latency", model.Gauge(1))
+	metricStorage.EXPECT().SaveMetric(gomock.Any(), stored).Return(nil)
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), model.Metric{ID: "http_server_latency", MType: model.MetricTypeGauge}).
+		Return(&stored, nil)
+
+	statusCode, _ := testutils.DoRequest(t, server, http.MethodPost, "/update/gauge/HTTP.Server-Latency/1", nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	statusCode, body := testutils.DoRequest(t, server, http.MethodGet, "/value/gauge/HTTP.Server-Latency", nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "1", body)
+
+	// The reserved prefix is checked after normalisation.
+	statusCode, _ = testutils.DoRequest(t, server, http.MethodPost, "/update/gauge/-.internal/1", nil)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+}
+
+func TestConfig_ValidateNamePolicy(t *testing.T) {
+	cfg := Config{StoreInterval: 1 * time.Second}
+	assert.NoError(t, cfg.Validate())
+
+	invalid := cfg
+	invalid.NamePattern = "["
+	assert.Error(t, invalid.Validate())
+
+	invalid = cfg
+	invalid.NameMaxLength = -1
+	assert.Error(t, invalid.Validate())
+
+	invalid = cfg
+	invalid.NameCase = "abrakadabra"
+	assert.Error(t, invalid.Validate())
+}
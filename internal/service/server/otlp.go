@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+const (
+	otlpProtobufContentType = "application/x-protobuf"
+	otlpJSONContentType     = "application/json"
+	otlpMaxBodySize         = 32 << 20
+)
+
+// otlpMetrics receives metrics over OTLP/HTTP, encoded either as protobuf
+// or as JSON. Compressed payloads are handled by the GzipDecoder middleware.
+func (h *Handler) otlpMetrics(w http.ResponseWriter, r *http.Request) {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != otlpProtobufContentType && contentType != otlpJSONContentType) {
+		http.Error(w, fmt.Sprintf("unsupported content type: %q", r.Header.Get("Content-Type")), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, otlpMaxBodySize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(data) > otlpMaxBodySize {
+		http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req colmetricspb.ExportMetricsServiceRequest
+	if contentType == otlpJSONContentType {
+		err = protojson.Unmarshal(data, &req)
+	} else {
+		err = proto.Unmarshal(data, &req)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	partialSuccess, err := h.otlp.Convert(&req, func(metrics []model.Metric) error {
+		return h.Server.PushMetricList(r.Context(), metrics)
+	})
+	if err != nil {
+		writePushError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp := &colmetricspb.ExportMetricsServiceResponse{PartialSuccess: partialSuccess}
+
+	var body []byte
+	if contentType == otlpJSONContentType {
+		body, err = protojson.Marshal(resp)
+	} else {
+		body, err = proto.Marshal(resp)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	storagemock "github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/mock"
+)
+
+func TestOTLPMetrics(t *testing.T) {
+	req := &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Metrics: []*metricspb.Metric{
+					{
+						Name: "temperature",
+						Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+							DataPoints: []*metricspb.NumberDataPoint{
+								{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 21.5}},
+							},
+						}},
+					},
+				},
+			}},
+		}},
+	}
+
+	protoBody, err := proto.Marshal(req)
+	require.NoError(t, err)
+
+	var gzipBody bytes.Buffer
+	gz := gzip.NewWriter(&gzipBody)
+	_, err = gz.Write(protoBody)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	jsonBody, err := protojson.Marshal(req)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		body            []byte
+		contentType     string
+		contentEncoding string
+		code            int
+	}{
+		{
+			name:        "Protobuf",
+			body:        protoBody,
+			contentType: "application/x-protobuf",
+			code:        http.StatusOK,
+		},
+		{
+			name:            "Compressed protobuf",
+			body:            gzipBody.Bytes(),
+			contentType:     "application/x-protobuf",
+			contentEncoding: "gzip",
+			code:            http.StatusOK,
+		},
+		{
+			name:        "JSON",
+			body:        jsonBody,
+			contentType: "application/json",
+			code:        http.StatusOK,
+		},
+		{
+			name:        "Invalid protobuf",
+			body:        []byte("invalid"),
+			contentType: "application/x-protobuf",
+			code:        http.StatusBadRequest,
+		},
+		{
+			name:        "Unsupported content type",
+			body:        jsonBody,
+			contentType: "text/plain",
+			code:        http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+			if tt.code == http.StatusOK {
+				metricStorage.EXPECT().
+					SaveMetricList(gomock.Any(), []model.Metric{model.MetricFromGauge("temperature", model.Gauge(21.5))}).
+					Return(nil)
+				metricStorage.EXPECT().IncrMetricList(gomock.Any(), []model.Metric{}).Return(nil)
+			}
+
+			h := newTestHandler(t, metricStorage)
+			server := httptest.NewServer(h.Router)
+			defer server.Close()
+
+			request, err := http.NewRequest(http.MethodPost, server.URL+"/v1/metrics", bytes.NewReader(tt.body))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", tt.contentType)
+			if tt.contentEncoding != "" {
+				request.Header.Set("Content-Encoding", tt.contentEncoding)
+			}
+
+			response, err := http.DefaultClient.Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			assert.Equal(t, tt.code, response.StatusCode)
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			body, err := io.ReadAll(response.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.contentType, response.Header.Get("Content-Type"))
+
+			var resp colmetricspb.ExportMetricsServiceResponse
+			if tt.contentType == "application/json" {
+				require.NoError(t, protojson.Unmarshal(body, &resp))
+			} else {
+				require.NoError(t, proto.Unmarshal(body, &resp))
+			}
+			assert.Nil(t, resp.GetPartialSuccess())
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+const (
+	prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+type prometheusMetric struct {
+	model.Metric
+	name string
+	key  string
+}
+
+type prometheusFamily struct {
+	name    string
+	mType   model.MetricType
+	help    string
+	metrics []model.Metric
+}
+
+// writePrometheusText renders metrics in the Prometheus text exposition
+// format (version 0.0.4). Families are sorted by name so that the output is
+// stable between scrapes. The HELP line of a family is taken from the
+// metadata of its first metric, if there is any.
+//
+// Metrics are ordered by sanitised name, type and key before they are
+// grouped, so when several types collide on one name the same family wins
+// on every scrape. The series left out are logged.
+func writePrometheusText(
+	w io.Writer,
+	metrics []model.Metric,
+	metadata map[model.MetricName]model.Metadata,
+) error {
+	sorted := make([]prometheusMetric, 0, len(metrics))
+	for _, metric := range metrics {
+		sorted = append(sorted, prometheusMetric{
+			name:   prometheusName(string(metric.ID)),
+			key:    metric.Key(),
+			Metric: metric,
+		})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.MType != b.MType {
+			return a.MType < b.MType
+		}
+		return a.key < b.key
+	})
+
+	families := make(map[string]*prometheusFamily)
+	dropped := 0
+
+	for _, m := range sorted {
+		name, metric := m.name, m.Metric
+		family, ok := families[name]
+		if !ok {
+			family = &prometheusFamily{
+				name:  name,
+				mType: metric.MType,
+				help:  prometheusHelp(metric, metadata[metric.ID]),
+			}
+			families[name] = family
+		}
+
+		// A family can only have one type, so a metric whose sanitised name
+		// collides with a family of another type can't be exposed.
+		if family.mType != metric.MType {
+			dropped++
+			continue
+		}
+
+		family.metrics = append(family.metrics, metric)
+	}
+
+	if dropped > 0 {
+		log.Printf("Prometheus exposition left out %d series with colliding names", dropped)
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		if err := writePrometheusFamily(bw, families[name]); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+func prometheusHelp(metric model.Metric, metadata model.Metadata) string {
+	help := metadata.Description
+	if help == "" {
+		help = fmt.Sprintf("Metric %s of type %s.", metric.ID, metric.MType)
+	}
+
+	if metadata.Unit != "" {
+		help = fmt.Sprintf("%s Unit: %s.", help, metadata.Unit)
+	}
+
+	return help
+}
+
+func writePrometheusFamily(w io.Writer, family *prometheusFamily) error {
+	var promType string
+	switch family.mType {
+	case model.MetricTypeGauge:
+		promType = "gauge"
+	case model.MetricTypeCounter:
+		promType = "counter"
+	case model.MetricTypeHistogram:
+		promType = "histogram"
+	case model.MetricTypeSummary:
+		promType = "summary"
+	default:
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n", family.name, escapePrometheusHelp(family.help)); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", family.name, promType); err != nil {
+		return err
+	}
+
+	sort.Slice(family.metrics, func(i, j int) bool {
+		return family.metrics[i].Key() < family.metrics[j].Key()
+	})
+
+	for _, metric := range family.metrics {
+		switch metric.MType {
+		case model.MetricTypeHistogram:
+			if err := writePrometheusHistogram(w, family.name, metric); err != nil {
+				return err
+			}
+			continue
+		case model.MetricTypeSummary:
+			if err := writePrometheusSummary(w, family.name, metric); err != nil {
+				return err
+			}
+			continue
+		}
+
+		labels := prometheusLabels(metric.Labels)
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", family.name, labels, metric.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writePrometheusHistogram writes the cumulative _bucket series, one per
+// bound and le="+Inf", followed by _sum and _count.
+func writePrometheusHistogram(w io.Writer, name string, metric model.Metric) error {
+	h := metric.Histogram
+
+	cumulative := uint64(0)
+	for i, c := range h.Counts {
+		cumulative += c
+
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = model.Gauge(h.Bounds[i]).String()
+		}
+
+		labels := make(model.Labels, len(metric.Labels)+1)
+		for k, v := range metric.Labels {
+			labels[k] = v
+		}
+		labels["le"] = le
+
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", name, prometheusLabels(labels), cumulative); err != nil {
+			return err
+		}
+	}
+
+	labels := prometheusLabels(metric.Labels)
+	if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, model.Gauge(h.Sum)); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.Count)
+	return err
+}
+
+// writePrometheusSummary writes a series per model.SummaryQuantiles, NaN
+// while the summary is empty, followed by _sum and _count.
+func writePrometheusSummary(w io.Writer, name string, metric model.Metric) error {
+	s := metric.Summary
+
+	for _, q := range model.SummaryQuantiles {
+		value := "NaN"
+		if v, err := s.Quantile(q); err == nil {
+			value = model.Gauge(v).String()
+		}
+
+		labels := make(model.Labels, len(metric.Labels)+1)
+		for k, v := range metric.Labels {
+			labels[k] = v
+		}
+		labels["quantile"] = model.Gauge(q).String()
+
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", name, prometheusLabels(labels), value); err != nil {
+			return err
+		}
+	}
+
+	labels := prometheusLabels(metric.Labels)
+	if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, model.Gauge(s.Sum)); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%s_count%s %d\n", name, labels, s.Count)
+	return err
+}
+
+// prometheusName turns a metric ID into a valid Prometheus metric name
+// matching [a-zA-Z_:][a-zA-Z0-9_:]*.
+func prometheusName(id string) string {
+	var b strings.Builder
+	b.Grow(len(id) + 1)
+
+	for i, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	if b.Len() == 0 {
+		return "_"
+	}
+
+	return b.String()
+}
+
+func prometheusLabels(labels model.Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range labels.Names() {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapePrometheusLabelValue(labels[name]))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+func escapePrometheusLabelValue(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+func escapePrometheusHelp(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
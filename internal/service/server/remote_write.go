@@ -0,0 +1,133 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/prompb"
+)
+
+const (
+	remoteWriteMaxBodySize = 32 << 20
+	metricNameLabel        = "__name__"
+)
+
+// remoteWrite receives series from Prometheus remote_write. Every series is
+// stored as a gauge: the metric name becomes the ID and the other labels
+// become labels. Only the latest finite sample of a series is kept, with
+// its timestamp, so that a retried request doesn't overwrite newer values.
+func (h *Handler) remoteWrite(w http.ResponseWriter, r *http.Request) {
+	compressed, err := io.ReadAll(io.LimitReader(r.Body, remoteWriteMaxBodySize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(compressed) > remoteWriteMaxBodySize {
+		http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req prompb.WriteRequest
+	if err := proto.Unmarshal(data, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics, err := metricsFromWriteRequest(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Server.PushMetricList(r.Context(), metrics); err != nil {
+		writePushError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func metricsFromWriteRequest(req *prompb.WriteRequest) ([]model.Metric, error) {
+	metrics := make([]model.Metric, 0, len(req.GetTimeseries()))
+
+	for _, ts := range req.GetTimeseries() {
+		metric, ok, err := metricFromTimeSeries(ts)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return metrics, nil
+}
+
+// metricFromTimeSeries returns false for a series without finite samples,
+// e.g. one that only carries staleness markers.
+func metricFromTimeSeries(ts *prompb.TimeSeries) (model.Metric, bool, error) {
+	var name string
+	var labels model.Labels
+
+	for _, l := range ts.GetLabels() {
+		// An empty label value is the same as a missing label.
+		if l.GetValue() == "" {
+			continue
+		}
+
+		if l.GetName() == metricNameLabel {
+			name = l.GetValue()
+			continue
+		}
+
+		if labels == nil {
+			labels = make(model.Labels, len(ts.GetLabels()))
+		}
+		if _, ok := labels[l.GetName()]; ok {
+			return model.Metric{}, false, fmt.Errorf("duplicate label name: %s", l.GetName())
+		}
+		labels[l.GetName()] = l.GetValue()
+	}
+
+	if name == "" {
+		return model.Metric{}, false, errors.New("invalid series: missing metric name")
+	}
+
+	var latest *prompb.Sample
+	for _, s := range ts.GetSamples() {
+		if math.IsNaN(s.GetValue()) || math.IsInf(s.GetValue(), 0) {
+			continue
+		}
+		if latest == nil || s.GetTimestamp() >= latest.GetTimestamp() {
+			latest = s
+		}
+	}
+
+	if latest == nil {
+		return model.Metric{}, false, nil
+	}
+
+	metric := model.MetricFromGauge(name, model.Gauge(latest.GetValue()))
+	metric.Labels = labels
+	metric.Timestamp = latest.GetTimestamp()
+
+	if err := metric.Validate(); err != nil {
+		return model.Metric{}, false, err
+	}
+
+	return metric, true, nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/common/testutils"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	storagemock "github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/mock"
+)
+
+func TestRemoteWrite(t *testing.T) {
+	labels := model.Labels{"instance": "host-a:9100", "job": "node"}
+
+	// The latest sample of a series is kept with its timestamp.
+	load1 := model.MetricFromGauge("node_load1", model.Gauge(0.75))
+	load1.Labels = labels
+	load1.Timestamp = 1660000015000
+	up := model.MetricFromGauge("up", model.Gauge(1))
+	up.Labels = labels
+	up.Timestamp = 1660000000000
+
+	tests := []struct {
+		name    string
+		fixture string
+		body    []byte
+		want    []model.Metric
+		code    int
+	}{
+		{
+			name:    "Valid request",
+			fixture: "testdata/remote_write/write_request.snappy",
+			want:    []model.Metric{load1, up},
+			code:    http.StatusNoContent,
+		},
+		{
+			name:    "Missing metric name",
+			fixture: "testdata/remote_write/missing_name.snappy",
+			code:    http.StatusBadRequest,
+		},
+		{
+			name: "Invalid snappy payload",
+			body: []byte("not snappy"),
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+			for _, metric := range tt.want {
+				metricStorage.EXPECT().LoadMetric(gomock.Any(), metric).Return(nil, nil)
+			}
+			if tt.want != nil {
+				metricStorage.EXPECT().SaveMetricList(gomock.Any(), tt.want).Return(nil)
+				metricStorage.EXPECT().IncrMetricList(gomock.Any(), []model.Metric{}).Return(nil)
+			}
+
+			h := newTestHandler(t, metricStorage)
+			server := httptest.NewServer(h.Router)
+			defer server.Close()
+
+			body := tt.body
+			if tt.fixture != "" {
+				var err error
+				body, err = os.ReadFile(tt.fixture)
+				require.NoError(t, err)
+			}
+
+			code, _ := testutils.DoRequest(t, server, http.MethodPost, "/api/v1/write", &body)
+			assert.Equal(t, tt.code, code)
+		})
+	}
+}
+
+func TestRemoteWriteOutOfOrder(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	labels := model.Labels{"instance": "host-a:9100", "job": "node"}
+
+	load1 := model.MetricFromGauge("node_load1", model.Gauge(0.75))
+	load1.Labels = labels
+	load1.Timestamp = 1660000015000
+	up := model.MetricFromGauge("up", model.Gauge(1))
+	up.Labels = labels
+	up.Timestamp = 1660000000000
+
+	stored := load1
+	stored.Value = model.MetricFromGauge("node_load1", model.Gauge(2)).Value
+	stored.Timestamp = 1660000030000
+
+	// A retried request doesn't overwrite the newer value.
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), load1).Return(&stored, nil)
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), up).Return(nil, nil)
+	metricStorage.EXPECT().SaveMetricList(gomock.Any(), []model.Metric{up}).Return(nil)
+	metricStorage.EXPECT().IncrMetricList(gomock.Any(), []model.Metric{}).Return(nil)
+
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	body, err := os.ReadFile("testdata/remote_write/write_request.snappy")
+	require.NoError(t, err)
+
+	code, _ := testutils.DoRequest(t, server, http.MethodPost, "/api/v1/write", &body)
+	assert.Equal(t, http.StatusNoContent, code)
+}
@@ -1,25 +1,39 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	mw "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httplog"
 
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ddsketch"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ingest/influx"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ingest/otlp"
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/middleware"
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/pubsub"
+)
+
+const (
+	DefaultHistoryWindow = 1 * time.Hour
 )
 
 type Handler struct {
 	Server *Server
 	Router *chi.Mux
+
+	influx *influx.Parser
+	otlp   *otlp.Converter
+	stream *pubsub.Broker
 }
 
 func NewHandler(server *Server) (*Handler, error) {
@@ -27,11 +41,35 @@ func NewHandler(server *Server) (*Handler, error) {
 		return nil, errors.New("invalid server value: nil")
 	}
 
+	influxParser, err := influx.NewParser(server.config.InfluxIntegerCounters, server.config.InfluxSeriesTTL, server.AcceptMetric)
+	if err != nil {
+		return nil, err
+	}
+
+	bufferSize := server.config.StreamBufferSize
+	if bufferSize == 0 {
+		bufferSize = pubsub.DefaultBufferSize
+	}
+
+	dropPolicy := server.config.StreamDropPolicy
+	if dropPolicy == "" {
+		dropPolicy = pubsub.DefaultDropPolicy
+	}
+
+	stream, err := pubsub.NewBroker(bufferSize, dropPolicy)
+	if err != nil {
+		return nil, err
+	}
+	server.AddPublishHook(stream.Publish)
+
 	router := chi.NewRouter()
 
 	h := &Handler{
 		Server: server,
 		Router: router,
+		influx: influxParser,
+		otlp:   otlp.NewConverter(server.config.OTLPSeriesTTL, server.AcceptMetric),
+		stream: stream,
 	}
 
 	logger := httplog.NewLogger("http-request-logger", httplog.Options{
@@ -57,10 +95,31 @@ func NewHandler(server *Server) (*Handler, error) {
 
 	h.Router.Post("/value/", h.getMetricWithBody)
 
+	h.Router.Route("/history/{metricType}/{metricName}", func(r chi.Router) {
+		r.Get("/", h.getMetricHistory)
+	})
+
+	h.Router.Post("/metadata/", h.updateMetadataList)
+	h.Router.Get("/metadata/", h.getMetadataList)
+	h.Router.Get("/metadata/{metricName}", h.getMetadata)
+
 	h.Router.Get("/", h.getMetricList)
 
 	h.Router.Get("/ping", h.heartbeat)
 
+	h.Router.Get("/metrics", h.getMetricListPrometheus)
+
+	h.Router.Get("/stream", h.streamMetrics)
+
+	h.Router.Get("/ws", h.subscribeWebSocket)
+
+	h.Router.Post("/api/v1/write", h.remoteWrite)
+
+	h.Router.Post("/api/v2/write", h.influxWrite)
+	h.Router.Post("/write", h.influxWrite)
+
+	h.Router.Post("/v1/metrics", h.otlpMetrics)
+
 	return h, nil
 }
 
@@ -74,14 +133,21 @@ func (h *Handler) updateMetricWithURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	labels, err := labelsFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	metric, err := model.MetricFromString(metricName, metricType, metricStringValue)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	metric.Labels = labels
 
 	if err := h.Server.PushMetric(r.Context(), metric); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writePushError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -117,7 +183,7 @@ func (h *Handler) updateMetricWithBody(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.Server.PushMetric(r.Context(), metric); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writePushError(w, err, http.StatusBadRequest)
 		return
 	}
 
@@ -157,8 +223,13 @@ func (h *Handler) updateMetricListWithBody(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	if err := h.Server.PushMetricList(r.Context(), metrics); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	err := h.Server.PushMetricList(r.Context(), metrics)
+	if isMergeMismatch(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writePushError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -192,6 +263,25 @@ func (h *Handler) getMetricWithURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	labels, err := labelsFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metric.Labels = labels
+
+	q, hasQuantile, err := quantileFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if hasQuantile && metric.MType != model.MetricTypeSummary {
+		err := fmt.Errorf("quantiles are not supported for MetricType: %s", metric.MType)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	m, err := h.Server.LoadMetric(r.Context(), metric)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -199,13 +289,23 @@ func (h *Handler) getMetricWithURL(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if m == nil {
-		http.Error(w, fmt.Sprintf("Metric %s not found", metric.ID), http.StatusNotFound)
+		http.Error(w, fmt.Sprintf("Metric %s not found", metric.Key()), http.StatusNotFound)
 		return
 	}
 
+	value := m.String()
+	if hasQuantile {
+		v, err := m.Summary.Quantile(q)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Metric %s: %v", metric.Key(), err), http.StatusNotFound)
+			return
+		}
+		value = model.Gauge(v).String()
+	}
+
 	w.Header().Set("Content-Type", "text/plain")
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, m.String())
+	fmt.Fprint(w, value)
 }
 
 func (h *Handler) getMetricWithBody(w http.ResponseWriter, r *http.Request) {
@@ -225,6 +325,11 @@ func (h *Handler) getMetricWithBody(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := metric.Labels.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	m, err := h.Server.LoadMetric(r.Context(), metric)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -232,7 +337,7 @@ func (h *Handler) getMetricWithBody(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if m == nil {
-		http.Error(w, fmt.Sprintf("Metric %s not found", metric.ID), http.StatusNotFound)
+		http.Error(w, fmt.Sprintf("Metric %s not found", metric.Key()), http.StatusNotFound)
 		return
 	}
 
@@ -247,6 +352,67 @@ func (h *Handler) getMetricWithBody(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, string(data))
 }
 
+func (h *Handler) getMetricHistory(w http.ResponseWriter, r *http.Request) {
+	metric := model.Metric{
+		ID:    model.MetricName(chi.URLParam(r, "metricName")),
+		MType: model.MetricType(chi.URLParam(r, "metricType")),
+	}
+
+	if err := metric.MType.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	if err := metric.ID.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	labels, err := labelsFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metric.Labels = labels
+
+	to, err := timeFromQuery(r, "to", time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, err := timeFromQuery(r, "from", to.Add(-DefaultHistoryWindow))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if from.After(to) {
+		http.Error(w, "invalid range: from is after to", http.StatusBadRequest)
+		return
+	}
+
+	samples, err := h.Server.LoadMetricHistory(r.Context(), metric, from, to)
+	if errors.Is(err, ErrHistoryNotSupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(samples)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, string(data))
+}
+
 func (h *Handler) getMetricList(w http.ResponseWriter, r *http.Request) {
 	htmlTemplate := `
 	<!DOCTYPE html>
@@ -256,7 +422,10 @@ func (h *Handler) getMetricList(w http.ResponseWriter, r *http.Request) {
 		<title>{{.Title}}</title>
 	</head>
 	<body>
-		{{range .Metrics}}<div>{{ .ID }}: {{ .String }}</div>{{end}}
+		{{range .Metrics}}<div>{{ .Key }}: {{ .String }}
+			{{- with .Metadata.Unit}} {{.}}{{end}}
+			{{- with .Metadata.Description}} &mdash; {{.}}{{end}}
+			{{- with .Metadata.Owner}} (owner: {{.}}){{end}}</div>{{end}}
 	</body>
 	</html>`
 
@@ -274,12 +443,28 @@ func (h *Handler) getMetricList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	metadata, err := h.Server.LoadMetadataIndex(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type metricListItem struct {
+		model.Metric
+		Metadata model.Metadata
+	}
+
+	items := make([]metricListItem, 0, len(metrics))
+	for _, metric := range metrics {
+		items = append(items, metricListItem{Metric: metric, Metadata: metadata[metric.ID]})
+	}
+
 	data := struct {
 		Title   string
-		Metrics []model.Metric
+		Metrics []metricListItem
 	}{
 		Title:   "Metric List",
-		Metrics: metrics,
+		Metrics: items,
 	}
 
 	w.Header().Set("Content-Type", "text/html")
@@ -287,6 +472,112 @@ func (h *Handler) getMetricList(w http.ResponseWriter, r *http.Request) {
 	_ = t.Execute(w, data)
 }
 
+func (h *Handler) getMetricListPrometheus(w http.ResponseWriter, r *http.Request) {
+	metrics, err := h.Server.LoadMetricList(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	metadata, err := h.Server.LoadMetadataIndex(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := writePrometheusText(&buf, metrics, metadata); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
+
+// labelsFromQuery reads metric labels passed as repeated "label=name=value"
+// query parameters.
+func labelsFromQuery(r *http.Request) (model.Labels, error) {
+	return model.LabelsFromStrings(r.URL.Query()["label"])
+}
+
+// quantileFromQuery reads a summary quantile passed as the "q" query
+// parameter, e.g. q=0.99.
+func quantileFromQuery(r *http.Request) (float64, bool, error) {
+	value := r.URL.Query().Get("q")
+	if value == "" {
+		return 0, false, nil
+	}
+
+	q, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(q >= 0 && q <= 1) {
+		return 0, false, fmt.Errorf("invalid quantile value: %s, must be in [0, 1]", value)
+	}
+
+	return q, true, nil
+}
+
+// isMergeMismatch reports whether a histogram or a summary couldn't be merged
+// into the stored one, as its buckets or accuracy differ.
+func isMergeMismatch(err error) bool {
+	return errors.Is(err, model.ErrHistogramBoundsMismatch) || errors.Is(err, ddsketch.ErrAccuracyMismatch)
+}
+
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	ID      string `json:"id,omitempty"`
+}
+
+// writePushError reports a failed push with the given status code. Metric
+// names rejected by the name policy and timestamps too far ahead are
+// reported as 400 with a JSON body, whatever the ingestion path.
+func writePushError(w http.ResponseWriter, err error, code int) {
+	var resp errorResponse
+
+	var nameErr *model.NameError
+	var timestampErr *model.TimestampError
+	switch {
+	case errors.As(err, &nameErr):
+		resp = errorResponse{Code: "invalid_metric_name", Message: nameErr.Error(), ID: string(nameErr.ID)}
+	case errors.As(err, &timestampErr):
+		resp = errorResponse{Code: "invalid_metric_timestamp", Message: timestampErr.Error(), ID: string(timestampErr.ID)}
+	default:
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	fmt.Fprint(w, string(data))
+}
+
+// timeFromQuery reads a time passed either in RFC 3339 or as unix seconds.
+func timeFromQuery(r *http.Request, name string, defaultValue time.Time) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s value: %s", name, value)
+	}
+
+	return t, nil
+}
+
 func (h *Handler) heartbeat(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Millisecond)
 	defer cancel()
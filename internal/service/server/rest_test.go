@@ -62,6 +62,20 @@ func TestUpdateMetricWithURL(t *testing.T) {
 				code: http.StatusOK,
 			},
 		},
+		{
+			name: "Valid labelled gauge metric1",
+			path: "/update/gauge/metric1/123.45?label=host=a",
+			want: want{
+				code: http.StatusOK,
+			},
+		},
+		{
+			name: "Invalid label",
+			path: "/update/gauge/metric1/123.45?label=host",
+			want: want{
+				code: http.StatusBadRequest,
+			},
+		},
 		{
 			name: "Invalid MType",
 			path: "/update/abcdef/metric3/123",
@@ -80,10 +94,13 @@ func TestUpdateMetricWithURL(t *testing.T) {
 
 	metric1 := model.MetricFromGauge("metric1", model.Gauge(123.45))
 	metric2 := model.MetricFromCounter("metric2", model.Counter(123))
+	labelledMetric1 := model.MetricFromGauge("metric1", model.Gauge(123.45))
+	labelledMetric1.Labels = model.Labels{"host": "a"}
 
 	gomock.InOrder(
 		metricStorage.EXPECT().SaveMetric(gomock.Any(), metric1).Return(nil),
 		metricStorage.EXPECT().IncrMetric(gomock.Any(), metric2).Return(nil),
+		metricStorage.EXPECT().SaveMetric(gomock.Any(), labelledMetric1).Return(nil),
 	)
 
 	for _, tt := range tests {
@@ -294,3 +311,164 @@ func TestGetMetricWithBody(t *testing.T) {
 		})
 	}
 }
+
+func TestGetMetricListPrometheus(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	labelledAlloc := model.MetricFromGauge("Alloc", model.Gauge(2))
+	labelledAlloc.Labels = model.Labels{"host": "b", "service": `a"b`}
+
+	metricStorage.EXPECT().LoadMetricList(gomock.Any()).Return([]model.Metric{
+		model.MetricFromGauge("CPUutilization0", model.Gauge(12.5)),
+		model.MetricFromCounter("PollCount", model.Counter(7)),
+		model.MetricFromGauge("0disk used/%", model.Gauge(3)),
+		labelledAlloc,
+		model.MetricFromGauge("Alloc", model.Gauge(1)),
+	}, nil)
+
+	want := `# HELP Alloc Metric Alloc of type gauge.
+# TYPE Alloc gauge
+Alloc 1
+Alloc{host="b",service="a\"b"} 2
+# HELP CPUutilization0 Metric CPUutilization0 of type gauge.
+# TYPE CPUutilization0 gauge
+CPUutilization0 12.5
+# HELP PollCount Metric PollCount of type counter.
+# TYPE PollCount counter
+PollCount 7
+# HELP _0disk_used__ Metric 0disk used/% of type gauge.
+# TYPE _0disk_used__ gauge
+_0disk_used__ 3
+`
+
+	statusCode, body := testutils.DoRequest(t, server, http.MethodGet, "/metrics", nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, want, body)
+}
+
+func TestGetMetricListPrometheusCollision(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	metrics := []model.Metric{
+		model.MetricFromGauge("X", model.Gauge(1)),
+		model.MetricFromCounter("X", model.Counter(2)),
+		model.MetricFromGauge("a_b", model.Gauge(3)),
+		model.MetricFromCounter("a.b", model.Counter(4)),
+	}
+	reversed := make([]model.Metric, len(metrics))
+	for i, metric := range metrics {
+		reversed[len(metrics)-1-i] = metric
+	}
+
+	want := `# HELP X Metric X of type counter.
+# TYPE X counter
+X 2
+# HELP a_b Metric a.b of type counter.
+# TYPE a_b counter
+a_b 4
+`
+
+	// The same family wins whatever order the storage returns metrics in.
+	for _, list := range [][]model.Metric{metrics, reversed} {
+		metricStorage.EXPECT().LoadMetricList(gomock.Any()).Return(list, nil)
+
+		statusCode, body := testutils.DoRequest(t, server, http.MethodGet, "/metrics", nil)
+		assert.Equal(t, http.StatusOK, statusCode)
+		assert.Equal(t, want, body)
+	}
+}
+
+type historyMetricStorage struct {
+	*storagemock.MockMetricStorage
+	*storagemock.MockMetricHistoryStorage
+}
+
+func TestGetMetricHistory(t *testing.T) {
+	type want struct {
+		code int
+		body string
+	}
+	tests := []struct {
+		name string
+		path string
+		want want
+	}{
+		{
+			name: "Valid gauge metric1",
+			path: "/history/gauge/metric1?from=1000&to=2000",
+			want: want{
+				code: http.StatusOK,
+				body: `[{"timestamp":"1970-01-01T00:16:40Z","value":1.5},{"timestamp":"1970-01-01T00:25:00Z","value":2.5}]`,
+			},
+		},
+		{
+			name: "Invalid range",
+			path: "/history/gauge/metric1?from=2000&to=1000",
+			want: want{
+				code: http.StatusBadRequest,
+				body: "invalid range: from is after to\n",
+			},
+		},
+		{
+			name: "Invalid time",
+			path: "/history/gauge/metric1?from=yesterday",
+			want: want{
+				code: http.StatusBadRequest,
+				body: "invalid from value: yesterday\n",
+			},
+		},
+	}
+
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := historyMetricStorage{
+		MockMetricStorage:        storagemock.NewMockMetricStorage(mockCtrl),
+		MockMetricHistoryStorage: storagemock.NewMockMetricHistoryStorage(mockCtrl),
+	}
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	value1, value2 := model.Gauge(1.5), model.Gauge(2.5)
+	samples := []model.Sample{
+		{Timestamp: time.Unix(1000, 0).UTC(), Value: &value1},
+		{Timestamp: time.Unix(1500, 0).UTC(), Value: &value2},
+	}
+
+	metricStorage.MockMetricHistoryStorage.EXPECT().LoadMetricHistory(
+		gomock.Any(),
+		model.Metric{ID: "metric1", MType: model.MetricTypeGauge},
+		time.Unix(1000, 0),
+		time.Unix(2000, 0),
+	).Return(samples, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusCode, body := testutils.DoRequest(t, server, http.MethodGet, tt.path, nil)
+			assert.Equal(t, tt.want.code, statusCode)
+			assert.Equal(t, tt.want.body, body)
+		})
+	}
+}
+
+func TestGetMetricHistoryNotSupported(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	statusCode, _ := testutils.DoRequest(t, server, http.MethodGet, "/history/gauge/metric1", nil)
+	assert.Equal(t, http.StatusNotImplemented, statusCode)
+}
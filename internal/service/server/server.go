@@ -4,33 +4,128 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/pubsub"
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage"
 )
 
 const (
-	DefaultShutdownTimeout = 3 * time.Second
-	DefaultStoreInterval   = 300 * time.Second
+	DefaultShutdownTimeout  = 3 * time.Second
+	DefaultStoreInterval    = 300 * time.Second
+	DefaultMaxTimestampSkew = 5 * time.Minute
+)
+
+var (
+	ErrHistoryNotSupported  = errors.New("metric history is not supported by the storage")
+	ErrMetadataNotSupported = errors.New("metric metadata is not supported by the storage")
 )
 
 type Config struct {
 	ShutdownTimeout time.Duration
 	StoreInterval   time.Duration `env:"STORE_INTERVAL"`
 	Key             string        `env:"KEY"`
+	// InfluxIntegerCounters are glob patterns of the metric names whose
+	// integer Influx fields are cumulative counters rather than gauges.
+	InfluxIntegerCounters []string `env:"INFLUX_INTEGER_COUNTERS" envSeparator:","`
+	// InfluxSeriesTTL is how long the baseline of an Influx integer counter
+	// series is kept after its last point. Zero falls back to the influx
+	// default.
+	InfluxSeriesTTL time.Duration `env:"INFLUX_SERIES_TTL"`
+	// OTLPSeriesTTL is how long the state of an OTLP Sum series is kept after
+	// its last point. Zero falls back to the otlp default.
+	OTLPSeriesTTL time.Duration `env:"OTLP_SERIES_TTL"`
+	// StreamBufferSize and StreamDropPolicy apply to every /stream
+	// subscriber. Zero values fall back to the pubsub defaults.
+	StreamBufferSize int `env:"STREAM_BUFFER_SIZE"`
+	// MaxTimestampSkew limits how far ahead of the server time a metric may
+	// be sampled. Zero falls back to DefaultMaxTimestampSkew.
+	MaxTimestampSkew time.Duration     `env:"MAX_TIMESTAMP_SKEW"`
+	StreamDropPolicy pubsub.DropPolicy `env:"STREAM_DROP_POLICY"`
+	// NamePattern, NameMaxLength and NameReservedPrefix restrict the names of
+	// pushed metrics after they are normalised with NameCase and
+	// NameSeparator. Zero NamePattern and NameMaxLength fall back to the
+	// model defaults.
+	NamePattern        string         `env:"NAME_PATTERN"`
+	NameMaxLength      int            `env:"NAME_MAX_LENGTH"`
+	NameReservedPrefix string         `env:"NAME_RESERVED_PREFIX"`
+	NameCase           model.NameCase `env:"NAME_CASE"`
+	NameSeparator      string         `env:"NAME_SEPARATOR"`
 }
 
 func (c Config) Validate() error {
 	if c.StoreInterval <= 0 {
 		return fmt.Errorf("invalid non-positive StoreInterval=%v", c.StoreInterval)
 	}
+	if c.InfluxSeriesTTL < 0 {
+		return fmt.Errorf("invalid negative InfluxSeriesTTL=%v", c.InfluxSeriesTTL)
+	}
+	if c.OTLPSeriesTTL < 0 {
+		return fmt.Errorf("invalid negative OTLPSeriesTTL=%v", c.OTLPSeriesTTL)
+	}
+	if c.MaxTimestampSkew < 0 {
+		return fmt.Errorf("invalid negative MaxTimestampSkew=%v", c.MaxTimestampSkew)
+	}
+	if c.StreamBufferSize < 0 {
+		return fmt.Errorf("invalid negative StreamBufferSize=%v", c.StreamBufferSize)
+	}
+	if c.StreamDropPolicy != "" {
+		if err := c.StreamDropPolicy.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.NameMaxLength < 0 {
+		return fmt.Errorf("invalid negative NameMaxLength=%v", c.NameMaxLength)
+	}
+	if _, err := regexp.Compile(c.NamePattern); err != nil {
+		return fmt.Errorf("invalid NamePattern=%q: %w", c.NamePattern, err)
+	}
+	if c.NameCase != "" {
+		if err := c.NameCase.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (c Config) namePolicy() model.NamePolicy {
+	pattern := c.NamePattern
+	if pattern == "" {
+		pattern = model.DefaultNamePattern
+	}
+
+	maxLength := c.NameMaxLength
+	if maxLength == 0 {
+		maxLength = model.DefaultNameMaxLength
+	}
+
+	return model.NamePolicy{
+		Pattern:        regexp.MustCompile(pattern),
+		MaxLength:      maxLength,
+		ReservedPrefix: c.NameReservedPrefix,
+		Case:           c.NameCase,
+		Separator:      c.NameSeparator,
+	}
+}
+
+// PublishHook is called with the metrics accepted by PushMetric and
+// PushMetricList. Counters and histograms carry the pushed delta.
+type PublishHook func(metrics []model.Metric)
+
 type Server struct {
 	storage.MetricStorage
-	config Config
+	config  Config
+	names   model.NamePolicy
+	maxSkew time.Duration
+	now     func() time.Time
+
+	hooksMu sync.RWMutex
+	hooks   []PublishHook
 }
 
 func NewServer(config Config, metricStorage storage.MetricStorage) (*Server, error) {
@@ -42,49 +137,191 @@ func NewServer(config Config, metricStorage storage.MetricStorage) (*Server, err
 		return nil, err
 	}
 
+	maxSkew := config.MaxTimestampSkew
+	if maxSkew == 0 {
+		maxSkew = DefaultMaxTimestampSkew
+	}
+
 	srv := &Server{
 		MetricStorage: metricStorage,
 		config:        config,
+		names:         config.namePolicy(),
+		maxSkew:       maxSkew,
+		now:           time.Now,
 	}
 
 	return srv, nil
 }
 
+// AddPublishHook registers a hook called after every accepted update.
+func (s *Server) AddPublishHook(hook PublishHook) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+
+	s.hooks = append(s.hooks, hook)
+}
+
+func (s *Server) publish(metrics []model.Metric) {
+	if len(metrics) == 0 {
+		return
+	}
+
+	s.hooksMu.RLock()
+	defer s.hooksMu.RUnlock()
+
+	for _, hook := range s.hooks {
+		hook(metrics)
+	}
+}
+
+// applyNamePolicy returns the metric with its name normalised, or a
+// *model.NameError if the name isn't allowed. The hash of a renamed metric
+// is dropped, as it no longer matches.
+func (s *Server) applyNamePolicy(metric model.Metric) (model.Metric, error) {
+	id, err := s.names.Apply(metric.ID)
+	if err != nil {
+		return model.Metric{}, err
+	}
+
+	if id != metric.ID {
+		metric.ID = id
+		metric.Hash = ""
+	}
+
+	return metric, nil
+}
+
+// checkTimestamp returns a *model.TimestampError if the metric is sampled
+// too far ahead of the server time.
+func (s *Server) checkTimestamp(metric model.Metric) error {
+	if metric.Timestamp > s.now().Add(s.maxSkew).UnixMilli() {
+		return &model.TimestampError{ID: metric.ID, Timestamp: metric.Timestamp, MaxSkew: s.maxSkew}
+	}
+	return nil
+}
+
+// AcceptMetric returns the metric with its name normalised, or an error if
+// either its name or its timestamp isn't allowed. Ingestion paths that report
+// errors per item call it before pushing, so that one bad item doesn't fail
+// the whole batch.
+func (s *Server) AcceptMetric(metric model.Metric) (model.Metric, error) {
+	metric, err := s.applyNamePolicy(metric)
+	if err != nil {
+		return model.Metric{}, err
+	}
+
+	if err := s.checkTimestamp(metric); err != nil {
+		return model.Metric{}, err
+	}
+
+	return metric, nil
+}
+
+// supersedingGauges returns the gauges that supersede both the stored ones
+// and the earlier ones of the list, i.e. the gauges the storage applies.
+// The storage still ignores out-of-order writes racing with the check.
+func (s *Server) supersedingGauges(ctx context.Context, metrics []model.Metric) ([]model.Metric, error) {
+	latest := make(map[string]model.Metric, len(metrics))
+	result := make([]model.Metric, 0, len(metrics))
+
+	for _, metric := range metrics {
+		key := metric.Key()
+
+		prev, ok := latest[key]
+		if !ok && metric.Timestamp != 0 {
+			stored, err := s.MetricStorage.LoadMetric(ctx, metric)
+			if err != nil {
+				return nil, err
+			}
+			if stored != nil {
+				prev, ok = *stored, true
+			}
+		}
+
+		if ok && !metric.Supersedes(prev) {
+			continue
+		}
+
+		latest[key] = metric
+		result = append(result, metric)
+	}
+
+	return result, nil
+}
+
+// PushMetric stores the metric under its normalised name. A name not allowed
+// by the policy is rejected with a *model.NameError, and a metric sampled too
+// far ahead with a *model.TimestampError. An out-of-order gauge is ignored.
 func (s *Server) PushMetric(ctx context.Context, metric model.Metric) error {
+	metric, err := s.AcceptMetric(metric)
+	if err != nil {
+		return err
+	}
+
 	switch metric.MType {
 	case model.MetricTypeGauge:
-		return s.MetricStorage.SaveMetric(ctx, metric)
-	case model.MetricTypeCounter:
-		return s.MetricStorage.IncrMetric(ctx, metric)
+		var gaugeMetrics []model.Metric
+		if gaugeMetrics, err = s.supersedingGauges(ctx, []model.Metric{metric}); err != nil || len(gaugeMetrics) == 0 {
+			return err
+		}
+		err = s.MetricStorage.SaveMetric(ctx, metric)
+	case model.MetricTypeCounter, model.MetricTypeHistogram, model.MetricTypeSummary:
+		err = s.MetricStorage.IncrMetric(ctx, metric)
+	default:
+		return nil
 	}
+
+	if err != nil {
+		return err
+	}
+
+	s.publish([]model.Metric{metric})
+
 	return nil
 }
 
+// PushMetricList saves gauges and merges counters, histograms and summaries
+// into the stored ones. If any name or timestamp isn't allowed, none of the
+// metrics are stored, see AcceptMetric. Out-of-order gauges are ignored.
 func (s *Server) PushMetricList(ctx context.Context, metrics []model.Metric) error {
 	gaugeMetrics := make([]model.Metric, 0, len(metrics))
 	counterMetrics := make([]model.Metric, 0, len(metrics))
 
 	for _, metric := range metrics {
+		metric, err := s.AcceptMetric(metric)
+		if err != nil {
+			return err
+		}
+
 		switch metric.MType {
 		case model.MetricTypeGauge:
 			gaugeMetrics = append(gaugeMetrics, metric)
-		case model.MetricTypeCounter:
+		case model.MetricTypeCounter, model.MetricTypeHistogram, model.MetricTypeSummary:
 			counterMetrics = append(counterMetrics, metric)
 		}
 	}
 
+	gaugeMetrics, err := s.supersedingGauges(ctx, gaugeMetrics)
+	if err != nil {
+		return err
+	}
+
 	if err := s.MetricStorage.SaveMetricList(ctx, gaugeMetrics); err != nil {
 		return err
 	}
+	s.publish(gaugeMetrics)
 
 	if err := s.MetricStorage.IncrMetricList(ctx, counterMetrics); err != nil {
 		return err
 	}
+	s.publish(counterMetrics)
 
 	return nil
 }
 
 func (s *Server) LoadMetric(ctx context.Context, metric model.Metric) (*model.Metric, error) {
+	metric.ID = s.names.Normalise(metric.ID)
+
 	m, err := s.MetricStorage.LoadMetric(ctx, metric)
 	if err != nil {
 		return nil, err
@@ -117,6 +354,120 @@ func (s *Server) LoadMetricList(ctx context.Context) ([]model.Metric, error) {
 	return metricList, nil
 }
 
+func (s *Server) LoadMetricHistory(
+	ctx context.Context,
+	metric model.Metric,
+	from, to time.Time,
+) ([]model.Sample, error) {
+	historyStorage, ok := s.MetricStorage.(storage.MetricHistoryStorage)
+	if !ok {
+		return nil, ErrHistoryNotSupported
+	}
+
+	metric.ID = s.names.Normalise(metric.ID)
+
+	return historyStorage.LoadMetricHistory(ctx, metric, from, to)
+}
+
+func (s *Server) metadataStorage() (storage.MetadataStorage, error) {
+	metadataStorage, ok := s.MetricStorage.(storage.MetadataStorage)
+	if !ok {
+		return nil, ErrMetadataNotSupported
+	}
+	return metadataStorage, nil
+}
+
+// SaveMetadataList merges every metadata into the stored one. The metric IDs
+// are normalised like the names of pushed metrics.
+func (s *Server) SaveMetadataList(ctx context.Context, list []model.Metadata) error {
+	metadataStorage, err := s.metadataStorage()
+	if err != nil {
+		return err
+	}
+
+	return s.storeMetadataList(ctx, list, metadataStorage.SaveMetadata)
+}
+
+// SeedMetadataList stores the metadata of the metrics that have none, e.g.
+// the defaults of an agent, so that the values set by operators are kept.
+func (s *Server) SeedMetadataList(ctx context.Context, list []model.Metadata) error {
+	metadataStorage, err := s.metadataStorage()
+	if err != nil {
+		return err
+	}
+
+	return s.storeMetadataList(ctx, list, metadataStorage.SeedMetadata)
+}
+
+func (s *Server) storeMetadataList(
+	ctx context.Context,
+	list []model.Metadata,
+	store func(ctx context.Context, metadata model.Metadata) error,
+) error {
+	for i := range list {
+		id, err := s.names.Apply(list[i].ID)
+		if err != nil {
+			return err
+		}
+		list[i].ID = id
+	}
+
+	for _, metadata := range list {
+		if err := store(ctx, metadata); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) LoadMetadata(ctx context.Context, id model.MetricName) (*model.Metadata, error) {
+	metadataStorage, err := s.metadataStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	return metadataStorage.LoadMetadata(ctx, s.names.Normalise(id))
+}
+
+// LoadMetadataList returns the stored metadata sorted by metric ID.
+func (s *Server) LoadMetadataList(ctx context.Context) ([]model.Metadata, error) {
+	metadataStorage, err := s.metadataStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := metadataStorage.LoadMetadataList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return list, nil
+}
+
+// LoadMetadataIndex returns the stored metadata by metric ID. It is empty
+// if the storage doesn't keep metadata.
+func (s *Server) LoadMetadataIndex(ctx context.Context) (map[model.MetricName]model.Metadata, error) {
+	list, err := s.LoadMetadataList(ctx)
+	if errors.Is(err, ErrMetadataNotSupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[model.MetricName]model.Metadata, len(list))
+	for _, metadata := range list {
+		index[metadata.ID] = metadata
+	}
+
+	return index, nil
+}
+
 func (s *Server) ValidateHash(metric model.Metric) (bool, error) {
 	if s.config.Key == "" {
 		return true, nil
@@ -136,8 +487,10 @@ func (s *Server) Run(ctx context.Context) error {
 	for {
 		select {
 		case <-storeTicker.C:
+			// A failed flush is retried on the next tick rather than
+			// stopping the server.
 			if err := s.Flush(ctx); err != nil {
-				return fmt.Errorf("failed to flush: %w", err)
+				log.Printf("failed to flush: %v", err)
 			}
 		case <-ctx.Done():
 			ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
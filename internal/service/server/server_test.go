@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -69,3 +70,116 @@ func TestServer_PushMetric(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_PublishHook(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	srv, err := NewServer(Config{StoreInterval: 1 * time.Second}, metricStorage)
+	require.NoError(t, err)
+
+	var published []model.Metric
+	srv.AddPublishHook(func(metrics []model.Metric) {
+		published = append(published, metrics...)
+	})
+
+	gauge := model.MetricFromGauge("metric1", model.Gauge(1))
+	counter := model.MetricFromCounter("metric2", model.Counter(1))
+
+	gomock.InOrder(
+		metricStorage.EXPECT().SaveMetric(gomock.Any(), gauge).Return(nil),
+		metricStorage.EXPECT().IncrMetric(gomock.Any(), counter).Return(errors.New("failed")),
+		metricStorage.EXPECT().SaveMetricList(gomock.Any(), []model.Metric{gauge}).Return(nil),
+		metricStorage.EXPECT().IncrMetricList(gomock.Any(), []model.Metric{counter}).Return(nil),
+	)
+
+	require.NoError(t, srv.PushMetric(context.Background(), gauge))
+	assert.Error(t, srv.PushMetric(context.Background(), counter))
+	require.NoError(t, srv.PushMetricList(context.Background(), []model.Metric{counter, gauge}))
+
+	// Failed updates aren't published.
+	assert.Equal(t, []model.Metric{gauge, gauge, counter}, published)
+}
+
+func TestServer_PushFutureTimestamp(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	srv, err := NewServer(Config{StoreInterval: 1 * time.Second, MaxTimestampSkew: time.Minute}, metricStorage)
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	srv.now = func() time.Time { return now }
+
+	stamped := func(ts time.Time) model.Metric {
+		metric := model.MetricFromGauge("metric1", model.Gauge(1))
+		metric.Timestamp = ts.UnixMilli()
+		return metric
+	}
+
+	ahead := stamped(now.Add(time.Minute))
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), ahead).Return(nil, nil)
+	metricStorage.EXPECT().SaveMetric(gomock.Any(), ahead).Return(nil)
+	require.NoError(t, srv.PushMetric(context.Background(), ahead))
+
+	var timestampErr *model.TimestampError
+	err = srv.PushMetric(context.Background(), stamped(now.Add(2*time.Minute)))
+	assert.ErrorAs(t, err, &timestampErr)
+	err = srv.PushMetricList(context.Background(), []model.Metric{stamped(now.Add(2 * time.Minute))})
+	assert.ErrorAs(t, err, &timestampErr)
+}
+
+func TestServer_PublishOutOfOrder(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	srv, err := NewServer(Config{StoreInterval: 1 * time.Second}, metricStorage)
+	require.NoError(t, err)
+
+	var published []model.Metric
+	srv.AddPublishHook(func(metrics []model.Metric) {
+		published = append(published, metrics...)
+	})
+
+	stamped := func(value model.Gauge, ts int64) model.Metric {
+		metric := model.MetricFromGauge("metric1", value)
+		metric.Timestamp = ts
+		return metric
+	}
+
+	stored := stamped(1, 2000)
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), gomock.Any()).Return(&stored, nil).Times(2)
+	metricStorage.EXPECT().SaveMetricList(gomock.Any(), []model.Metric{stamped(3, 3000)}).Return(nil)
+	metricStorage.EXPECT().IncrMetricList(gomock.Any(), []model.Metric{}).Return(nil)
+
+	// Gauges sampled before the stored one, or before an earlier one of the
+	// list, are neither stored nor published.
+	require.NoError(t, srv.PushMetric(context.Background(), stamped(2, 1000)))
+	require.NoError(t, srv.PushMetricList(context.Background(), []model.Metric{stamped(3, 3000), stamped(4, 2500)}))
+
+	assert.Equal(t, []model.Metric{stamped(3, 3000)}, published)
+}
+
+func TestServer_RunFlushError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	srv, err := NewServer(Config{StoreInterval: 10 * time.Millisecond}, metricStorage)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Failed flushes on ticks don't stop the server.
+	flushes := 0
+	metricStorage.EXPECT().Flush(gomock.Any()).DoAndReturn(func(context.Context) error {
+		flushes++
+		if flushes == 2 {
+			cancel()
+		}
+		return errors.New("failed to encode snapshot")
+	}).Times(2)
+	metricStorage.EXPECT().Flush(gomock.Any()).Return(nil).MinTimes(1)
+
+	assert.NoError(t, srv.Run(ctx))
+}
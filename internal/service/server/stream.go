@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/pubsub"
+)
+
+const (
+	streamKeepAliveInterval = 15 * time.Second
+)
+
+// CloseStreams ends every /stream response, e.g. on shutdown.
+func (h *Handler) CloseStreams() {
+	h.stream.Close()
+}
+
+// filterFromQuery reads the types, either repeated or comma-separated, and
+// the name prefix to stream.
+func filterFromQuery(r *http.Request) (pubsub.Filter, error) {
+	var filter pubsub.Filter
+
+	for _, value := range r.URL.Query()["type"] {
+		for _, s := range strings.Split(value, ",") {
+			mType := model.MetricType(s)
+			if err := mType.Validate(); err != nil {
+				return pubsub.Filter{}, err
+			}
+			filter.Types = append(filter.Types, mType)
+		}
+	}
+
+	filter.Prefix = r.URL.Query().Get("prefix")
+
+	return filter, nil
+}
+
+// streamMetrics sends accepted updates as Server-Sent Events: a "metric"
+// event per update and a "dropped" event with the total number of updates
+// lost whenever the client falls behind.
+func (h *Handler) streamMetrics(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	filter, err := filterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sub := h.stream.Subscribe(filter)
+	defer h.stream.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	var dropped uint64
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case metric, ok := <-sub.C:
+			if !ok {
+				return
+			}
+
+			if n := sub.Dropped(); n != dropped {
+				dropped = n
+				if _, err := fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", dropped); err != nil {
+					return
+				}
+			}
+
+			data, err := json.Marshal(metric)
+			if err != nil {
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "event: metric\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	storagemock "github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/mock"
+)
+
+type streamEvent struct {
+	name string
+	data string
+}
+
+func readStreamEvent(t *testing.T, r *bufio.Reader) streamEvent {
+	var event streamEvent
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return event
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func openStream(t *testing.T, ctx context.Context, server *httptest.Server, path string, gzipped bool) io.ReadCloser {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+	require.NoError(t, err)
+	if gzipped {
+		request.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	if !gzipped {
+		return response.Body
+	}
+
+	require.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+	gz, err := gzip.NewReader(response.Body)
+	require.NoError(t, err)
+
+	return gz
+}
+
+func TestStreamMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		gzipped bool
+	}{
+		{
+			name: "Plain",
+		},
+		{
+			name:    "Gzip",
+			gzipped: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+			metricStorage.EXPECT().SaveMetricList(gomock.Any(), gomock.Any()).Return(nil)
+			metricStorage.EXPECT().IncrMetricList(gomock.Any(), gomock.Any()).Return(nil)
+
+			h := newTestHandler(t, metricStorage)
+			server := httptest.NewServer(h.Router)
+			defer server.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			body := openStream(t, ctx, server, "/stream?type=counter&prefix=Poll", tt.gzipped)
+			defer body.Close()
+
+			err := h.Server.PushMetricList(context.Background(), []model.Metric{
+				model.MetricFromGauge("PollInterval", model.Gauge(2)),
+				model.MetricFromCounter("RandomCount", model.Counter(1)),
+				model.MetricFromCounter("PollCount", model.Counter(5)),
+			})
+			require.NoError(t, err)
+
+			event := readStreamEvent(t, bufio.NewReader(body))
+			assert.Equal(t, "metric", event.name)
+
+			var metric model.Metric
+			require.NoError(t, json.Unmarshal([]byte(event.data), &metric))
+			assert.Equal(t, model.MetricFromCounter("PollCount", model.Counter(5)), metric)
+		})
+	}
+}
+
+func TestStreamMetricsDropped(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	metricStorage.EXPECT().SaveMetricList(gomock.Any(), gomock.Any()).Return(nil)
+	metricStorage.EXPECT().IncrMetricList(gomock.Any(), gomock.Any()).Return(nil)
+
+	srv, err := NewServer(Config{StoreInterval: 1, StreamBufferSize: 1}, metricStorage)
+	require.NoError(t, err)
+
+	h, err := NewHandler(srv)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	body := openStream(t, ctx, server, "/stream", false)
+	defer body.Close()
+
+	const n = 100
+	metrics := make([]model.Metric, 0, n)
+	for i := 1; i <= n; i++ {
+		metrics = append(metrics, model.MetricFromGauge("Alloc", model.Gauge(i)))
+	}
+	require.NoError(t, srv.PushMetricList(context.Background(), metrics))
+
+	// How many updates the handler keeps up with varies, but every update is
+	// either delivered or reported as dropped.
+	r := bufio.NewReader(body)
+	delivered, dropped := 0, 0
+	for {
+		event := readStreamEvent(t, r)
+		if event.name == "dropped" {
+			var err error
+			dropped, err = strconv.Atoi(event.data)
+			require.NoError(t, err)
+			continue
+		}
+
+		require.Equal(t, "metric", event.name)
+		delivered++
+
+		var metric model.Metric
+		require.NoError(t, json.Unmarshal([]byte(event.data), &metric))
+		if *metric.Value == n {
+			break
+		}
+	}
+
+	assert.Equal(t, n, delivered+dropped)
+}
+
+func TestStreamMetricsClose(t *testing.T) {
+	h := newTestHandler(t, storagemock.NewMockMetricStorage(nil))
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	body := openStream(t, context.Background(), server, "/stream", false)
+	defer body.Close()
+
+	h.CloseStreams()
+
+	_, err := io.ReadAll(body)
+	assert.NoError(t, err)
+}
+
+func TestStreamMetricsInvalidType(t *testing.T) {
+	h := newTestHandler(t, storagemock.NewMockMetricStorage(nil))
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/stream?type=gauge,abrakadabra")
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
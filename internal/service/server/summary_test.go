@@ -0,0 +1,208 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/common/testutils"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ddsketch"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	storagemock "github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/mock"
+)
+
+func newTestSummary(t *testing.T) ddsketch.Sketch {
+	s, err := ddsketch.NewSketch(ddsketch.DefaultRelativeAccuracy)
+	require.NoError(t, err)
+
+	for i := 1; i <= 100; i++ {
+		require.NoError(t, s.Add(float64(i)))
+	}
+
+	return *s
+}
+
+func testQuantile(t *testing.T, s ddsketch.Sketch, q float64) string {
+	v, err := s.Quantile(q)
+	require.NoError(t, err)
+	return model.Gauge(v).String()
+}
+
+func TestUpdateSummaryListWithBody(t *testing.T) {
+	latency := model.MetricFromSummary("latency", newTestSummary(t))
+
+	invalid := model.MetricFromSummary("latency", newTestSummary(t))
+	invalid.Summary.Count = 1
+
+	tests := []struct {
+		name       string
+		metrics    []model.Metric
+		storageErr error
+		wantCode   int
+	}{
+		{
+			name:     "Summary",
+			metrics:  []model.Metric{latency},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Invalid count",
+			metrics:  []model.Metric{invalid},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Missing summary",
+			metrics:  []model.Metric{{ID: "latency", MType: model.MetricTypeSummary}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Accuracy mismatch",
+			metrics:    []model.Metric{latency},
+			storageErr: ddsketch.ErrAccuracyMismatch,
+			wantCode:   http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+
+			metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+			h := newTestHandler(t, metricStorage)
+			server := httptest.NewServer(h.Router)
+			defer server.Close()
+
+			if tt.wantCode == http.StatusOK || tt.storageErr != nil {
+				gomock.InOrder(
+					metricStorage.EXPECT().SaveMetricList(gomock.Any(), []model.Metric{}).Return(nil),
+					metricStorage.EXPECT().IncrMetricList(gomock.Any(), tt.metrics).Return(tt.storageErr),
+				)
+			}
+
+			data, err := json.Marshal(tt.metrics)
+			require.NoError(t, err)
+
+			statusCode, _ := testutils.DoRequest(t, server, http.MethodPost, "/updates/", &data)
+			assert.Equal(t, tt.wantCode, statusCode)
+		})
+	}
+}
+
+func TestGetSummaryQuantile(t *testing.T) {
+	s := newTestSummary(t)
+	latency := model.MetricFromSummary("latency", s)
+
+	empty, err := ddsketch.NewSketch(ddsketch.DefaultRelativeAccuracy)
+	require.NoError(t, err)
+	idle := model.MetricFromSummary("idle", *empty)
+
+	tests := []struct {
+		name     string
+		path     string
+		metric   *model.Metric
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Quantile",
+			path:     "/value/summary/latency?q=0.99",
+			metric:   &latency,
+			wantCode: http.StatusOK,
+			wantBody: testQuantile(t, s, 0.99),
+		},
+		{
+			name:     "Median",
+			path:     "/value/summary/latency?q=0.5",
+			metric:   &latency,
+			wantCode: http.StatusOK,
+			wantBody: testQuantile(t, s, 0.5),
+		},
+		{
+			name:     "Summary",
+			path:     "/value/summary/latency",
+			metric:   &latency,
+			wantCode: http.StatusOK,
+			wantBody: fmt.Sprintf(
+				"count=100 sum=5050 {0.5:%s 0.9:%s 0.99:%s}",
+				testQuantile(t, s, 0.5),
+				testQuantile(t, s, 0.9),
+				testQuantile(t, s, 0.99),
+			),
+		},
+		{
+			name:     "Empty summary",
+			path:     "/value/summary/idle?q=0.5",
+			metric:   &idle,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Not found",
+			path:     "/value/summary/latency?q=0.5",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid quantile",
+			path:     "/value/summary/latency?q=1.5",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Quantile of a gauge",
+			path:     "/value/gauge/latency?q=0.5",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+
+			metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+			h := newTestHandler(t, metricStorage)
+			server := httptest.NewServer(h.Router)
+			defer server.Close()
+
+			if tt.wantCode == http.StatusOK || tt.wantCode == http.StatusNotFound {
+				metricStorage.EXPECT().LoadMetric(gomock.Any(), gomock.Any()).Return(tt.metric, nil)
+			}
+
+			statusCode, body := testutils.DoRequest(t, server, http.MethodGet, tt.path, nil)
+			assert.Equal(t, tt.wantCode, statusCode)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestGetSummaryPrometheus(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	s := newTestSummary(t)
+	latency := model.MetricFromSummary("latency", s)
+
+	metricStorage.EXPECT().LoadMetricList(gomock.Any()).Return([]model.Metric{latency}, nil)
+
+	want := fmt.Sprintf(`# HELP latency Metric latency of type summary.
+# TYPE latency summary
+latency{quantile="0.5"} %s
+latency{quantile="0.9"} %s
+latency{quantile="0.99"} %s
+latency_sum 5050
+latency_count 100
+`, testQuantile(t, s, 0.5), testQuantile(t, s, 0.9), testQuantile(t, s, 0.99))
+
+	statusCode, body := testutils.DoRequest(t, server, http.MethodGet, "/metrics", nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, want, body)
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/pubsub"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	wsMaxMessage = 64 * 1024
+)
+
+type wsMessageType string
+
+const (
+	// wsSubscribe and wsUnsubscribe are sent by clients with the metrics to
+	// (un)subscribe to. Only the id, type and labels of a metric are used.
+	wsSubscribe   wsMessageType = "subscribe"
+	wsUnsubscribe wsMessageType = "unsubscribe"
+	// wsSnapshot answers a subscription with the current values of the
+	// metrics that exist.
+	wsSnapshot wsMessageType = "snapshot"
+	// wsUpdate carries the current values of updated metrics.
+	wsUpdate wsMessageType = "update"
+	wsError  wsMessageType = "error"
+)
+
+type wsMessage struct {
+	Type    wsMessageType  `json:"type"`
+	Metrics []model.Metric `json:"metrics,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// wsRequest is a client message or the reason it couldn't be decoded.
+type wsRequest struct {
+	msg wsMessage
+	err error
+}
+
+type wsSession struct {
+	h    *Handler
+	conn *websocket.Conn
+	sub  *pubsub.Subscription
+	keys map[pubsub.MetricKey]struct{}
+}
+
+// subscribeWebSocket serves the WebSocket subscription API. Updates come from
+// the publish hook, and the metrics are reloaded from the storage, so that
+// counters carry their totals rather than the pushed deltas.
+func (h *Handler) subscribeWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied with an error.
+		return
+	}
+	defer conn.Close()
+
+	s := &wsSession{
+		h:    h,
+		conn: conn,
+		sub:  h.stream.Subscribe(pubsub.Filter{Keys: map[pubsub.MetricKey]struct{}{}}),
+		keys: make(map[pubsub.MetricKey]struct{}),
+	}
+	defer h.stream.Unsubscribe(s.sub)
+
+	if err := s.run(r.Context()); err != nil {
+		log.Printf("WebSocket session failed: %v", err)
+	}
+}
+
+func (s *wsSession) run(ctx context.Context) error {
+	requests := make(chan wsRequest)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go s.read(requests, readErr, done)
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return err
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return err
+			}
+		case req := <-requests:
+			if req.err != nil {
+				if err := s.writeError(req.err); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := s.handle(ctx, req.msg); err != nil {
+				return err
+			}
+		case metric, ok := <-s.sub.C:
+			if !ok {
+				// The streams are closed on shutdown.
+				return s.conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, ""),
+					time.Now().Add(wsWriteWait),
+				)
+			}
+
+			if err := s.update(ctx, metric); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// read is the only reader of the connection.
+func (s *wsSession) read(requests chan<- wsRequest, readErr chan<- error, done <-chan struct{}) {
+	s.conn.SetReadLimit(wsMaxMessage)
+	s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			readErr <- err
+			return
+		}
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req.msg); err != nil {
+			req.err = fmt.Errorf("invalid message: %w", err)
+		}
+
+		select {
+		case requests <- req:
+		case <-done:
+			return
+		}
+	}
+}
+
+func (s *wsSession) write(msg wsMessage) error {
+	s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return s.conn.WriteJSON(msg)
+}
+
+func (s *wsSession) writeError(err error) error {
+	return s.write(wsMessage{Type: wsError, Error: err.Error()})
+}
+
+func validateSubscription(metric model.Metric) error {
+	if err := metric.MType.Validate(); err != nil {
+		return err
+	}
+	if err := metric.ID.Validate(); err != nil {
+		return err
+	}
+	return metric.Labels.Validate()
+}
+
+func (s *wsSession) handle(ctx context.Context, msg wsMessage) error {
+	switch msg.Type {
+	case wsSubscribe, wsUnsubscribe:
+	default:
+		return s.writeError(fmt.Errorf("unknown message type: %s", msg.Type))
+	}
+
+	// Updates are published under normalised names.
+	for i, metric := range msg.Metrics {
+		if err := validateSubscription(metric); err != nil {
+			return s.writeError(err)
+		}
+		msg.Metrics[i].ID = s.h.Server.names.Normalise(metric.ID)
+	}
+
+	for _, metric := range msg.Metrics {
+		key := pubsub.KeyOf(metric)
+		if msg.Type == wsSubscribe {
+			s.keys[key] = struct{}{}
+		} else {
+			delete(s.keys, key)
+		}
+	}
+
+	keys := make(map[pubsub.MetricKey]struct{}, len(s.keys))
+	for key := range s.keys {
+		keys[key] = struct{}{}
+	}
+	s.h.stream.SetFilter(s.sub, pubsub.Filter{Keys: keys})
+
+	if msg.Type == wsUnsubscribe {
+		return nil
+	}
+
+	// The snapshot is loaded after the filter is set, so that no update
+	// between the two is missed.
+	snapshot, err := s.load(ctx, msg.Metrics)
+	if err != nil {
+		return s.writeError(err)
+	}
+
+	return s.write(wsMessage{Type: wsSnapshot, Metrics: snapshot})
+}
+
+// update sends the current values of the updated metric and of any other
+// updates already queued.
+func (s *wsSession) update(ctx context.Context, metric model.Metric) error {
+	updated := map[pubsub.MetricKey]struct{}{pubsub.KeyOf(metric): {}}
+	metrics := []model.Metric{metric}
+
+	for queued := true; queued; {
+		select {
+		case m, ok := <-s.sub.C:
+			if !ok {
+				queued = false
+				break
+			}
+			if _, ok := updated[pubsub.KeyOf(m)]; !ok {
+				updated[pubsub.KeyOf(m)] = struct{}{}
+				metrics = append(metrics, m)
+			}
+		default:
+			queued = false
+		}
+	}
+
+	current, err := s.load(ctx, metrics)
+	if err != nil {
+		return s.writeError(err)
+	}
+
+	if len(current) == 0 {
+		return nil
+	}
+
+	return s.write(wsMessage{Type: wsUpdate, Metrics: current})
+}
+
+func (s *wsSession) load(ctx context.Context, metrics []model.Metric) ([]model.Metric, error) {
+	result := make([]model.Metric, 0, len(metrics))
+
+	for _, metric := range metrics {
+		m, err := s.h.Server.LoadMetric(ctx, model.Metric{
+			ID:     metric.ID,
+			MType:  metric.MType,
+			Labels: metric.Labels,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if m != nil {
+			result = append(result, *m)
+		}
+	}
+
+	return result, nil
+}
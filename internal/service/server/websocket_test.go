@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+	storagemock "github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/storage/mock"
+)
+
+func dialWebSocket(t *testing.T, server *httptest.Server) *websocket.Conn {
+	header := http.Header{}
+	header.Set("Accept-Encoding", "gzip")
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	return conn
+}
+
+func readWebSocket(t *testing.T, conn *websocket.Conn) wsMessage {
+	var msg wsMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func TestSubscribeWebSocket(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	metricStorage := storagemock.NewMockMetricStorage(mockCtrl)
+
+	h := newTestHandler(t, metricStorage)
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	conn := dialWebSocket(t, server)
+	defer conn.Close()
+
+	alloc := model.Metric{ID: "Alloc", MType: model.MetricTypeGauge}
+	pollCount := model.Metric{ID: "PollCount", MType: model.MetricTypeCounter}
+
+	// Subscribing replies with a snapshot of the metrics that exist.
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), alloc).Return(nil, nil)
+	pollCount1 := model.MetricFromCounter("PollCount", model.Counter(1))
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), pollCount).Return(&pollCount1, nil)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsSubscribe, Metrics: []model.Metric{alloc, pollCount}}))
+	assert.Equal(t, wsMessage{Type: wsSnapshot, Metrics: []model.Metric{pollCount1}}, readWebSocket(t, conn))
+
+	// Updates carry the totals of the counters.
+	pollCount3 := model.MetricFromCounter("PollCount", model.Counter(3))
+	metricStorage.EXPECT().IncrMetric(gomock.Any(), gomock.Any()).Return(nil)
+	metricStorage.EXPECT().LoadMetric(gomock.Any(), pollCount).Return(&pollCount3, nil)
+
+	require.NoError(t, h.Server.PushMetric(context.Background(), model.MetricFromCounter("PollCount", model.Counter(2))))
+	assert.Equal(t, wsMessage{Type: wsUpdate, Metrics: []model.Metric{pollCount3}}, readWebSocket(t, conn))
+
+	// The error reply confirms that the unsubscription is done.
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsUnsubscribe, Metrics: []model.Metric{pollCount}}))
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("{")))
+	assert.Equal(t, wsError, readWebSocket(t, conn).Type)
+
+	// Updates of metrics that aren't subscribed to are neither loaded nor sent.
+	metricStorage.EXPECT().IncrMetric(gomock.Any(), gomock.Any()).Return(nil)
+	metricStorage.EXPECT().SaveMetric(gomock.Any(), gomock.Any()).Return(nil)
+
+	require.NoError(t, h.Server.PushMetric(context.Background(), model.MetricFromCounter("PollCount", model.Counter(2))))
+	require.NoError(t, h.Server.PushMetric(context.Background(), model.MetricFromGauge("Other", model.Gauge(1))))
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: "unknown"}))
+	assert.Equal(t, wsMessage{Type: wsError, Error: "unknown message type: unknown"}, readWebSocket(t, conn))
+}
+
+func TestSubscribeWebSocketInvalidMetric(t *testing.T) {
+	h := newTestHandler(t, storagemock.NewMockMetricStorage(nil))
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	conn := dialWebSocket(t, server)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteJSON(wsMessage{
+		Type:    wsSubscribe,
+		Metrics: []model.Metric{{ID: "Alloc", MType: "abrakadabra"}},
+	}))
+	assert.Equal(t, wsError, readWebSocket(t, conn).Type)
+}
+
+func TestSubscribeWebSocketClose(t *testing.T) {
+	h := newTestHandler(t, storagemock.NewMockMetricStorage(nil))
+	server := httptest.NewServer(h.Router)
+	defer server.Close()
+
+	conn := dialWebSocket(t, server)
+	defer conn.Close()
+
+	h.CloseStreams()
+
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+// histogramArg encodes a histogram as a jsonb statement argument.
+func histogramArg(h *model.Histogram) (string, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func histogramFromColumn(data []byte) (*model.Histogram, error) {
+	var h model.Histogram
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+// incrHistogram merges the histogram into the stored one. The stored row is
+// locked until tx ends, so that concurrent merges don't lose observations.
+func (s *MetricStorage) incrHistogram(
+	ctx context.Context,
+	tx *sql.Tx,
+	id model.MetricName,
+	labels string,
+	h *model.Histogram,
+) error {
+	value, err := histogramArg(h)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.StmtContext(ctx, s.histogramInsertStmt).ExecContext(ctx, id, labels, value)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if inserted > 0 {
+		return nil
+	}
+
+	var data []byte
+	row := tx.StmtContext(ctx, s.histogramLoadForUpdateStmt).QueryRowContext(ctx, id, labels)
+	if err := row.Scan(&data); err != nil {
+		return err
+	}
+
+	stored, err := histogramFromColumn(data)
+	if err != nil {
+		return err
+	}
+
+	if err := stored.Merge(*h); err != nil {
+		return err
+	}
+
+	if value, err = histogramArg(stored); err != nil {
+		return err
+	}
+
+	_, err = tx.StmtContext(ctx, s.histogramSaveStmt).ExecContext(ctx, id, labels, value)
+	return err
+}
+
+func (s *MetricStorage) loadHistogramMetricList(
+	ctx context.Context,
+	tx *sql.Tx,
+) ([]model.Metric, error) {
+	txStmt := tx.StmtContext(ctx, s.histogramLoadListStmt)
+	rows, err := txStmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := make([]model.Metric, 0, 50)
+
+	for rows.Next() {
+		metric := model.Metric{MType: model.MetricTypeHistogram}
+		var labels, value []byte
+		if err := rows.Scan(&metric.ID, &labels, &value); err != nil {
+			return nil, err
+		}
+		if metric.Labels, err = labelsFromColumn(labels); err != nil {
+			return nil, err
+		}
+		if metric.Histogram, err = histogramFromColumn(value); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
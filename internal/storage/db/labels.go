@@ -0,0 +1,35 @@
+package db
+
+import (
+	"encoding/json"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+// labelsArg encodes labels as a jsonb statement argument. Missing labels are
+// stored as an empty object to keep the (id, labels) unique key canonical.
+func labelsArg(labels model.Labels) (string, error) {
+	if len(labels) == 0 {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func labelsFromColumn(data []byte) (model.Labels, error) {
+	var labels model.Labels
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return nil, err
+	}
+
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	return labels, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func (s *MetricStorage) SaveMetadata(ctx context.Context, metadata model.Metadata) error {
+	if s.db == nil {
+		return errors.New("database connection is not opened")
+	}
+
+	_, err := s.metadataSaveStmt.ExecContext(
+		ctx,
+		metadata.ID,
+		metadata.Unit,
+		metadata.Description,
+		metadata.Owner,
+		metadata.Type,
+	)
+	return err
+}
+
+func (s *MetricStorage) SeedMetadata(ctx context.Context, metadata model.Metadata) error {
+	if s.db == nil {
+		return errors.New("database connection is not opened")
+	}
+
+	_, err := s.metadataSeedStmt.ExecContext(
+		ctx,
+		metadata.ID,
+		metadata.Unit,
+		metadata.Description,
+		metadata.Owner,
+		metadata.Type,
+	)
+	return err
+}
+
+func (s *MetricStorage) LoadMetadata(ctx context.Context, id model.MetricName) (*model.Metadata, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection is not opened")
+	}
+
+	metadata := model.Metadata{ID: id}
+	row := s.metadataLoadStmt.QueryRowContext(ctx, id)
+	err := row.Scan(&metadata.Unit, &metadata.Description, &metadata.Owner, &metadata.Type)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
+
+func (s *MetricStorage) LoadMetadataList(ctx context.Context) ([]model.Metadata, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection is not opened")
+	}
+
+	rows, err := s.metadataLoadListStmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.Metadata, 0, 50)
+
+	for rows.Next() {
+		var metadata model.Metadata
+		err := rows.Scan(
+			&metadata.ID,
+			&metadata.Unit,
+			&metadata.Description,
+			&metadata.Owner,
+			&metadata.Type,
+		)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, metadata)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
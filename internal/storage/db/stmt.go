@@ -26,6 +26,14 @@ func (s *MetricStorage) PrepareStatements(ctx context.Context) error {
 		return err
 	}
 
+	if err := s.prepareGaugeLoadHistoryStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareGaugePruneHistoryStmt(ctx); err != nil {
+		return err
+	}
+
 	if err := s.prepareCounterSaveStmt(ctx); err != nil {
 		return err
 	}
@@ -42,14 +50,90 @@ func (s *MetricStorage) PrepareStatements(ctx context.Context) error {
 		return err
 	}
 
+	if err := s.prepareCounterLoadHistoryStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareCounterPruneHistoryStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareHistogramSaveStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareHistogramInsertStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareHistogramLoadStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareHistogramLoadForUpdateStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareHistogramLoadListStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareSummarySaveStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareSummaryInsertStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareSummaryLoadStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareSummaryLoadForUpdateStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareSummaryLoadListStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareMetadataSaveStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareMetadataSeedStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareMetadataLoadStmt(ctx); err != nil {
+		return err
+	}
+
+	if err := s.prepareMetadataLoadListStmt(ctx); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// prepareGaugeSaveStmt ignores out-of-order writes: a gauge doesn't replace
+// one with a later timestamp. Gauges without timestamps always do.
+//
+// History rows of this and the other save and incr statements are recorded
+// at the metric timestamp, in milliseconds, or at the time of the write if
+// the metric has none.
 func (s *MetricStorage) prepareGaugeSaveStmt(ctx context.Context) error {
 	expr := `
-INSERT INTO gauge_metrics (id, value)
-VALUES ($1, $2)
-ON CONFLICT (id) DO UPDATE SET value = $2`
+WITH upserted AS (
+  INSERT INTO gauge_metrics (id, labels, value, timestamp_ms)
+  VALUES ($1, $2, $3, $4)
+  ON CONFLICT (id, labels) DO UPDATE SET value = $3, timestamp_ms = $4
+  WHERE $4 IS NULL OR gauge_metrics.timestamp_ms IS NULL OR gauge_metrics.timestamp_ms <= $4
+  RETURNING id, labels, value
+)
+INSERT INTO gauge_metrics_history (id, labels, value, created_at)
+SELECT id, labels, value, COALESCE(to_timestamp($4 / 1000.0), now()) FROM upserted`
 
 	stmt, err := s.db.PrepareContext(ctx, expr)
 	if err != nil {
@@ -61,9 +145,14 @@ ON CONFLICT (id) DO UPDATE SET value = $2`
 
 func (s *MetricStorage) prepareGaugeIncrStmt(ctx context.Context) error {
 	expr := `
-INSERT INTO gauge_metrics (id, value)
-VALUES ($1, $2)
-ON CONFLICT (id) DO UPDATE SET value = gauge_metrics.value + $2`
+WITH upserted AS (
+  INSERT INTO gauge_metrics (id, labels, value)
+  VALUES ($1, $2, $3)
+  ON CONFLICT (id, labels) DO UPDATE SET value = gauge_metrics.value + $3
+  RETURNING id, labels, value
+)
+INSERT INTO gauge_metrics_history (id, labels, value, created_at)
+SELECT id, labels, value, COALESCE(to_timestamp($4::bigint / 1000.0), now()) FROM upserted`
 
 	stmt, err := s.db.PrepareContext(ctx, expr)
 	if err != nil {
@@ -74,7 +163,7 @@ ON CONFLICT (id) DO UPDATE SET value = gauge_metrics.value + $2`
 }
 
 func (s *MetricStorage) prepareGaugeLoadStmt(ctx context.Context) error {
-	expr := "SELECT value FROM gauge_metrics WHERE id = $1"
+	expr := "SELECT value, timestamp_ms FROM gauge_metrics WHERE id = $1 AND labels = $2"
 	stmt, err := s.db.PrepareContext(ctx, expr)
 	if err != nil {
 		return err
@@ -84,7 +173,7 @@ func (s *MetricStorage) prepareGaugeLoadStmt(ctx context.Context) error {
 }
 
 func (s *MetricStorage) prepareGaugeLoadListStmt(ctx context.Context) error {
-	expr := "SELECT id, value FROM gauge_metrics"
+	expr := "SELECT id, labels, value, timestamp_ms FROM gauge_metrics"
 	stmt, err := s.db.PrepareContext(ctx, expr)
 	if err != nil {
 		return err
@@ -93,11 +182,41 @@ func (s *MetricStorage) prepareGaugeLoadListStmt(ctx context.Context) error {
 	return nil
 }
 
+func (s *MetricStorage) prepareGaugeLoadHistoryStmt(ctx context.Context) error {
+	expr := `
+SELECT value, created_at FROM gauge_metrics_history
+WHERE id = $1 AND labels = $2 AND created_at BETWEEN $3 AND $4
+ORDER BY created_at`
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.gaugeLoadHistoryStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareGaugePruneHistoryStmt(ctx context.Context) error {
+	expr := "DELETE FROM gauge_metrics_history WHERE created_at < $1"
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.gaugePruneHistoryStmt = stmt
+	return nil
+}
+
 func (s *MetricStorage) prepareCounterSaveStmt(ctx context.Context) error {
 	expr := `
-INSERT INTO counter_metrics (id, value)
-VALUES ($1, $2)
-ON CONFLICT (id) DO UPDATE SET value = $2`
+WITH upserted AS (
+  INSERT INTO counter_metrics (id, labels, value)
+  VALUES ($1, $2, $3)
+  ON CONFLICT (id, labels) DO UPDATE SET value = $3
+  RETURNING id, labels, value
+)
+INSERT INTO counter_metrics_history (id, labels, value, created_at)
+SELECT id, labels, value, COALESCE(to_timestamp($4::bigint / 1000.0), now()) FROM upserted`
 
 	stmt, err := s.db.PrepareContext(ctx, expr)
 	if err != nil {
@@ -109,9 +228,14 @@ ON CONFLICT (id) DO UPDATE SET value = $2`
 
 func (s *MetricStorage) prepareCounterIncrStmt(ctx context.Context) error {
 	expr := `
-INSERT INTO counter_metrics (id, value)
-VALUES ($1, $2)
-ON CONFLICT (id) DO UPDATE SET value = counter_metrics.value + $2`
+WITH upserted AS (
+  INSERT INTO counter_metrics (id, labels, value)
+  VALUES ($1, $2, $3)
+  ON CONFLICT (id, labels) DO UPDATE SET value = counter_metrics.value + $3
+  RETURNING id, labels, value
+)
+INSERT INTO counter_metrics_history (id, labels, value, created_at)
+SELECT id, labels, value, COALESCE(to_timestamp($4::bigint / 1000.0), now()) FROM upserted`
 
 	stmt, err := s.db.PrepareContext(ctx, expr)
 	if err != nil {
@@ -122,7 +246,7 @@ ON CONFLICT (id) DO UPDATE SET value = counter_metrics.value + $2`
 }
 
 func (s *MetricStorage) prepareCounterLoadStmt(ctx context.Context) error {
-	expr := "SELECT value FROM counter_metrics WHERE id = $1"
+	expr := "SELECT value FROM counter_metrics WHERE id = $1 AND labels = $2"
 
 	stmt, err := s.db.PrepareContext(ctx, expr)
 	if err != nil {
@@ -133,7 +257,7 @@ func (s *MetricStorage) prepareCounterLoadStmt(ctx context.Context) error {
 }
 
 func (s *MetricStorage) prepareCounterLoadListStmt(ctx context.Context) error {
-	expr := "SELECT id, value FROM counter_metrics"
+	expr := "SELECT id, labels, value FROM counter_metrics"
 
 	stmt, err := s.db.PrepareContext(ctx, expr)
 	if err != nil {
@@ -142,3 +266,211 @@ func (s *MetricStorage) prepareCounterLoadListStmt(ctx context.Context) error {
 	s.counterLoadListStmt = stmt
 	return nil
 }
+
+func (s *MetricStorage) prepareCounterLoadHistoryStmt(ctx context.Context) error {
+	expr := `
+SELECT value, created_at FROM counter_metrics_history
+WHERE id = $1 AND labels = $2 AND created_at BETWEEN $3 AND $4
+ORDER BY created_at`
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.counterLoadHistoryStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareCounterPruneHistoryStmt(ctx context.Context) error {
+	expr := "DELETE FROM counter_metrics_history WHERE created_at < $1"
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.counterPruneHistoryStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareHistogramSaveStmt(ctx context.Context) error {
+	expr := `
+INSERT INTO histogram_metrics (id, labels, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (id, labels) DO UPDATE SET value = $3`
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.histogramSaveStmt = stmt
+	return nil
+}
+
+// prepareHistogramInsertStmt inserts a histogram unless it exists, so that
+// an existing one can be locked and merged into.
+func (s *MetricStorage) prepareHistogramInsertStmt(ctx context.Context) error {
+	expr := `
+INSERT INTO histogram_metrics (id, labels, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (id, labels) DO NOTHING`
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.histogramInsertStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareHistogramLoadStmt(ctx context.Context) error {
+	expr := "SELECT value FROM histogram_metrics WHERE id = $1 AND labels = $2"
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.histogramLoadStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareHistogramLoadForUpdateStmt(ctx context.Context) error {
+	expr := "SELECT value FROM histogram_metrics WHERE id = $1 AND labels = $2 FOR UPDATE"
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.histogramLoadForUpdateStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareHistogramLoadListStmt(ctx context.Context) error {
+	expr := "SELECT id, labels, value FROM histogram_metrics"
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.histogramLoadListStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareSummarySaveStmt(ctx context.Context) error {
+	expr := `
+INSERT INTO summary_metrics (id, labels, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (id, labels) DO UPDATE SET value = $3`
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.summarySaveStmt = stmt
+	return nil
+}
+
+// prepareSummaryInsertStmt inserts a summary unless it exists, so that
+// an existing one can be locked and merged into.
+func (s *MetricStorage) prepareSummaryInsertStmt(ctx context.Context) error {
+	expr := `
+INSERT INTO summary_metrics (id, labels, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (id, labels) DO NOTHING`
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.summaryInsertStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareSummaryLoadStmt(ctx context.Context) error {
+	expr := "SELECT value FROM summary_metrics WHERE id = $1 AND labels = $2"
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.summaryLoadStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareSummaryLoadForUpdateStmt(ctx context.Context) error {
+	expr := "SELECT value FROM summary_metrics WHERE id = $1 AND labels = $2 FOR UPDATE"
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.summaryLoadForUpdateStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareSummaryLoadListStmt(ctx context.Context) error {
+	expr := "SELECT id, labels, value FROM summary_metrics"
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.summaryLoadListStmt = stmt
+	return nil
+}
+
+// prepareMetadataSaveStmt merges the metadata into the stored one: empty
+// fields keep the stored values.
+func (s *MetricStorage) prepareMetadataSaveStmt(ctx context.Context) error {
+	expr := `
+INSERT INTO metric_metadata (id, unit, description, owner, type)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (id) DO UPDATE SET
+  unit = COALESCE(NULLIF(EXCLUDED.unit, ''), metric_metadata.unit),
+  description = COALESCE(NULLIF(EXCLUDED.description, ''), metric_metadata.description),
+  owner = COALESCE(NULLIF(EXCLUDED.owner, ''), metric_metadata.owner),
+  type = COALESCE(NULLIF(EXCLUDED.type, ''), metric_metadata.type)`
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.metadataSaveStmt = stmt
+	return nil
+}
+
+// prepareMetadataSeedStmt stores the metadata only if the metric has none.
+func (s *MetricStorage) prepareMetadataSeedStmt(ctx context.Context) error {
+	expr := `
+INSERT INTO metric_metadata (id, unit, description, owner, type)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (id) DO NOTHING`
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.metadataSeedStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareMetadataLoadStmt(ctx context.Context) error {
+	expr := "SELECT unit, description, owner, type FROM metric_metadata WHERE id = $1"
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.metadataLoadStmt = stmt
+	return nil
+}
+
+func (s *MetricStorage) prepareMetadataLoadListStmt(ctx context.Context) error {
+	expr := "SELECT id, unit, description, owner, type FROM metric_metadata"
+
+	stmt, err := s.db.PrepareContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	s.metadataLoadListStmt = stmt
+	return nil
+}
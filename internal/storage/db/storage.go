@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/pgx"
@@ -12,9 +14,16 @@ import (
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
 )
 
+const (
+	DefaultHistoryRetention = 7 * 24 * time.Hour
+)
+
 type Config struct {
 	DSN           string `env:"DATABASE_DSN"`
 	MigrationsURL string
+	// HistoryRetention is how long gauge and counter history is kept. Older
+	// samples are pruned on Flush. Zero keeps the history forever.
+	HistoryRetention time.Duration `env:"HISTORY_RETENTION"`
 }
 
 type MetricStorage struct {
@@ -22,15 +31,36 @@ type MetricStorage struct {
 
 	db *sql.DB
 
-	gaugeSaveStmt     *sql.Stmt
-	gaugeIncrStmt     *sql.Stmt
-	gaugeLoadStmt     *sql.Stmt
-	gaugeLoadListStmt *sql.Stmt
-
-	counterSaveStmt     *sql.Stmt
-	counterIncrStmt     *sql.Stmt
-	counterLoadStmt     *sql.Stmt
-	counterLoadListStmt *sql.Stmt
+	gaugeSaveStmt         *sql.Stmt
+	gaugeIncrStmt         *sql.Stmt
+	gaugeLoadStmt         *sql.Stmt
+	gaugeLoadListStmt     *sql.Stmt
+	gaugeLoadHistoryStmt  *sql.Stmt
+	gaugePruneHistoryStmt *sql.Stmt
+
+	counterSaveStmt         *sql.Stmt
+	counterIncrStmt         *sql.Stmt
+	counterLoadStmt         *sql.Stmt
+	counterLoadListStmt     *sql.Stmt
+	counterLoadHistoryStmt  *sql.Stmt
+	counterPruneHistoryStmt *sql.Stmt
+
+	histogramSaveStmt          *sql.Stmt
+	histogramInsertStmt        *sql.Stmt
+	histogramLoadStmt          *sql.Stmt
+	histogramLoadForUpdateStmt *sql.Stmt
+	histogramLoadListStmt      *sql.Stmt
+
+	summarySaveStmt          *sql.Stmt
+	summaryInsertStmt        *sql.Stmt
+	summaryLoadStmt          *sql.Stmt
+	summaryLoadForUpdateStmt *sql.Stmt
+	summaryLoadListStmt      *sql.Stmt
+
+	metadataSaveStmt     *sql.Stmt
+	metadataSeedStmt     *sql.Stmt
+	metadataLoadStmt     *sql.Stmt
+	metadataLoadListStmt *sql.Stmt
 }
 
 func NewMetricStorage(ctx context.Context, config Config) (*MetricStorage, error) {
@@ -85,14 +115,39 @@ func (s *MetricStorage) SaveMetric(ctx context.Context, metric model.Metric) err
 		return errors.New("database connection is not opened")
 	}
 
+	labels, err := labelsArg(metric.Labels)
+	if err != nil {
+		return err
+	}
+
 	switch metric.MType {
 	case model.MetricTypeGauge:
-		if _, err := s.gaugeSaveStmt.ExecContext(ctx, metric.ID, *metric.Value); err != nil {
+		ts := timestampArg(metric.Timestamp)
+		if _, err := s.gaugeSaveStmt.ExecContext(ctx, metric.ID, labels, *metric.Value, ts); err != nil {
 			return err
 		}
 
 	case model.MetricTypeCounter:
-		if _, err := s.counterSaveStmt.ExecContext(ctx, metric.ID, *metric.Value); err != nil {
+		ts := timestampArg(metric.Timestamp)
+		if _, err := s.counterSaveStmt.ExecContext(ctx, metric.ID, labels, *metric.Delta, ts); err != nil {
+			return err
+		}
+
+	case model.MetricTypeHistogram:
+		value, err := histogramArg(metric.Histogram)
+		if err != nil {
+			return err
+		}
+		if _, err := s.histogramSaveStmt.ExecContext(ctx, metric.ID, labels, value); err != nil {
+			return err
+		}
+
+	case model.MetricTypeSummary:
+		value, err := summaryArg(metric.Summary)
+		if err != nil {
+			return err
+		}
+		if _, err := s.summarySaveStmt.ExecContext(ctx, metric.ID, labels, value); err != nil {
 			return err
 		}
 	}
@@ -105,16 +160,49 @@ func (s *MetricStorage) IncrMetric(ctx context.Context, metric model.Metric) err
 		return errors.New("database connection is not opened")
 	}
 
+	labels, err := labelsArg(metric.Labels)
+	if err != nil {
+		return err
+	}
+
 	switch metric.MType {
 	case model.MetricTypeGauge:
-		if _, err := s.gaugeIncrStmt.ExecContext(ctx, metric.ID, *metric.Value); err != nil {
+		ts := timestampArg(metric.Timestamp)
+		if _, err := s.gaugeIncrStmt.ExecContext(ctx, metric.ID, labels, *metric.Value, ts); err != nil {
 			return err
 		}
 
 	case model.MetricTypeCounter:
-		if _, err := s.counterIncrStmt.ExecContext(ctx, metric.ID, *metric.Delta); err != nil {
+		ts := timestampArg(metric.Timestamp)
+		if _, err := s.counterIncrStmt.ExecContext(ctx, metric.ID, labels, *metric.Delta, ts); err != nil {
+			return err
+		}
+
+	case model.MetricTypeHistogram:
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := s.incrHistogram(ctx, tx, metric.ID, labels, metric.Histogram); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+
+	case model.MetricTypeSummary:
+		tx, err := s.db.Begin()
+		if err != nil {
 			return err
 		}
+		defer tx.Rollback()
+
+		if err := s.incrSummary(ctx, tx, metric.ID, labels, metric.Summary); err != nil {
+			return err
+		}
+
+		return tx.Commit()
 	}
 
 	return nil
@@ -128,19 +216,39 @@ func (s *MetricStorage) LoadMetric(
 		return nil, errors.New("database connection is not opened")
 	}
 
-	var err error
+	labels, err := labelsArg(metric.Labels)
+	if err != nil {
+		return nil, err
+	}
+
 	switch metric.MType {
 	case model.MetricTypeGauge:
-		row := s.gaugeLoadStmt.QueryRowContext(ctx, metric.ID)
+		row := s.gaugeLoadStmt.QueryRowContext(ctx, metric.ID, labels)
 		value := model.Gauge(0)
 		metric.Value = &value
-		err = row.Scan(metric.Value)
+		var ts sql.NullInt64
+		err = row.Scan(metric.Value, &ts)
+		metric.Timestamp = ts.Int64
 
 	case model.MetricTypeCounter:
-		row := s.counterLoadStmt.QueryRowContext(ctx, metric.ID)
+		row := s.counterLoadStmt.QueryRowContext(ctx, metric.ID, labels)
 		delta := model.Counter(0)
 		metric.Delta = &delta
 		err = row.Scan(metric.Delta)
+
+	case model.MetricTypeHistogram:
+		row := s.histogramLoadStmt.QueryRowContext(ctx, metric.ID, labels)
+		var value []byte
+		if err = row.Scan(&value); err == nil {
+			metric.Histogram, err = histogramFromColumn(value)
+		}
+
+	case model.MetricTypeSummary:
+		row := s.summaryLoadStmt.QueryRowContext(ctx, metric.ID, labels)
+		var value []byte
+		if err = row.Scan(&value); err == nil {
+			metric.Summary, err = summaryFromColumn(value)
+		}
 	}
 
 	if err == sql.ErrNoRows {
@@ -169,7 +277,13 @@ func (s *MetricStorage) loadGaugeMetricList(
 
 	for rows.Next() {
 		metric := model.MetricFromGauge("", 0)
-		if err := rows.Scan(&metric.ID, metric.Value); err != nil {
+		var labels []byte
+		var ts sql.NullInt64
+		if err := rows.Scan(&metric.ID, &labels, metric.Value, &ts); err != nil {
+			return nil, err
+		}
+		metric.Timestamp = ts.Int64
+		if metric.Labels, err = labelsFromColumn(labels); err != nil {
 			return nil, err
 		}
 		metrics = append(metrics, metric)
@@ -197,7 +311,11 @@ func (s *MetricStorage) loadCounterMetricList(
 
 	for rows.Next() {
 		metric := model.MetricFromCounter("", 0)
-		if err := rows.Scan(&metric.ID, metric.Delta); err != nil {
+		var labels []byte
+		if err := rows.Scan(&metric.ID, &labels, metric.Delta); err != nil {
+			return nil, err
+		}
+		if metric.Labels, err = labelsFromColumn(labels); err != nil {
 			return nil, err
 		}
 		metrics = append(metrics, metric)
@@ -223,16 +341,43 @@ func (s *MetricStorage) SaveMetricList(ctx context.Context, metrics []model.Metr
 
 	txGaugeSaveStmt := tx.StmtContext(ctx, s.gaugeSaveStmt)
 	txCounterSaveStmt := tx.StmtContext(ctx, s.counterSaveStmt)
+	txHistogramSaveStmt := tx.StmtContext(ctx, s.histogramSaveStmt)
+	txSummarySaveStmt := tx.StmtContext(ctx, s.summarySaveStmt)
 
 	for _, m := range metrics {
+		labels, err := labelsArg(m.Labels)
+		if err != nil {
+			return err
+		}
+
 		switch m.MType {
 		case model.MetricTypeGauge:
-			if _, err := txGaugeSaveStmt.ExecContext(ctx, m.ID, *m.Value); err != nil {
+			ts := timestampArg(m.Timestamp)
+			if _, err := txGaugeSaveStmt.ExecContext(ctx, m.ID, labels, *m.Value, ts); err != nil {
 				return err
 			}
 
 		case model.MetricTypeCounter:
-			if _, err := txCounterSaveStmt.ExecContext(ctx, m.ID, *m.Delta); err != nil {
+			ts := timestampArg(m.Timestamp)
+			if _, err := txCounterSaveStmt.ExecContext(ctx, m.ID, labels, *m.Delta, ts); err != nil {
+				return err
+			}
+
+		case model.MetricTypeHistogram:
+			value, err := histogramArg(m.Histogram)
+			if err != nil {
+				return err
+			}
+			if _, err := txHistogramSaveStmt.ExecContext(ctx, m.ID, labels, value); err != nil {
+				return err
+			}
+
+		case model.MetricTypeSummary:
+			value, err := summaryArg(m.Summary)
+			if err != nil {
+				return err
+			}
+			if _, err := txSummarySaveStmt.ExecContext(ctx, m.ID, labels, value); err != nil {
 				return err
 			}
 		}
@@ -256,14 +401,31 @@ func (s *MetricStorage) IncrMetricList(ctx context.Context, metrics []model.Metr
 	txCounterIncrStmt := tx.StmtContext(ctx, s.counterIncrStmt)
 
 	for _, m := range metrics {
+		labels, err := labelsArg(m.Labels)
+		if err != nil {
+			return err
+		}
+
 		switch m.MType {
 		case model.MetricTypeGauge:
-			if _, err := txGaugeIncrStmt.ExecContext(ctx, m.ID, *m.Value); err != nil {
+			ts := timestampArg(m.Timestamp)
+			if _, err := txGaugeIncrStmt.ExecContext(ctx, m.ID, labels, *m.Value, ts); err != nil {
 				return err
 			}
 
 		case model.MetricTypeCounter:
-			if _, err := txCounterIncrStmt.ExecContext(ctx, m.ID, *m.Delta); err != nil {
+			ts := timestampArg(m.Timestamp)
+			if _, err := txCounterIncrStmt.ExecContext(ctx, m.ID, labels, *m.Delta, ts); err != nil {
+				return err
+			}
+
+		case model.MetricTypeHistogram:
+			if err := s.incrHistogram(ctx, tx, m.ID, labels, m.Histogram); err != nil {
+				return err
+			}
+
+		case model.MetricTypeSummary:
+			if err := s.incrSummary(ctx, tx, m.ID, labels, m.Summary); err != nil {
 				return err
 			}
 		}
@@ -293,25 +455,134 @@ func (s *MetricStorage) LoadMetricList(ctx context.Context) ([]model.Metric, err
 		return nil, err
 	}
 
-	metrics := make([]model.Metric, len(gaugeMetrics)+len(counterMetrics))
-	_ = copy(metrics, gaugeMetrics)
-	_ = copy(metrics[len(gaugeMetrics):], counterMetrics)
+	histogramMetrics, err := s.loadHistogramMetricList(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	summaryMetrics, err := s.loadSummaryMetricList(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make(
+		[]model.Metric,
+		0,
+		len(gaugeMetrics)+len(counterMetrics)+len(histogramMetrics)+len(summaryMetrics),
+	)
+	metrics = append(metrics, gaugeMetrics...)
+	metrics = append(metrics, counterMetrics...)
+	metrics = append(metrics, histogramMetrics...)
+	metrics = append(metrics, summaryMetrics...)
 
 	return metrics, tx.Commit()
 }
 
+func (s *MetricStorage) LoadMetricHistory(
+	ctx context.Context,
+	metric model.Metric,
+	from, to time.Time,
+) ([]model.Sample, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection is not opened")
+	}
+
+	labels, err := labelsArg(metric.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+	switch metric.MType {
+	case model.MetricTypeGauge:
+		rows, err = s.gaugeLoadHistoryStmt.QueryContext(ctx, metric.ID, labels, from, to)
+	case model.MetricTypeCounter:
+		rows, err = s.counterLoadHistoryStmt.QueryContext(ctx, metric.ID, labels, from, to)
+	default:
+		return nil, fmt.Errorf("metric history is not supported for MetricType: %s", metric.MType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([]model.Sample, 0, 50)
+
+	for rows.Next() {
+		var sample model.Sample
+		switch metric.MType {
+		case model.MetricTypeGauge:
+			sample.Value = new(model.Gauge)
+			err = rows.Scan(sample.Value, &sample.Timestamp)
+		case model.MetricTypeCounter:
+			sample.Delta = new(model.Counter)
+			err = rows.Scan(sample.Delta, &sample.Timestamp)
+		}
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// Flush prunes the history older than HistoryRetention. It is called on
+// every store tick of the server.
 func (s *MetricStorage) Flush(ctx context.Context) error {
+	if s.db == nil {
+		return errors.New("database connection is not opened")
+	}
+
+	if s.config.HistoryRetention <= 0 {
+		return nil
+	}
+
+	before := time.Now().Add(-s.config.HistoryRetention)
+
+	if _, err := s.gaugePruneHistoryStmt.ExecContext(ctx, before); err != nil {
+		return err
+	}
+
+	if _, err := s.counterPruneHistoryStmt.ExecContext(ctx, before); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (s *MetricStorage) Close() {
 	for _, stmt := range []*sql.Stmt{
 		s.gaugeSaveStmt,
+		s.gaugeIncrStmt,
 		s.gaugeLoadStmt,
 		s.gaugeLoadListStmt,
+		s.gaugeLoadHistoryStmt,
+		s.gaugePruneHistoryStmt,
 		s.counterSaveStmt,
+		s.counterIncrStmt,
 		s.counterLoadStmt,
 		s.counterLoadListStmt,
+		s.counterLoadHistoryStmt,
+		s.counterPruneHistoryStmt,
+		s.histogramSaveStmt,
+		s.histogramInsertStmt,
+		s.histogramLoadStmt,
+		s.histogramLoadForUpdateStmt,
+		s.histogramLoadListStmt,
+		s.summarySaveStmt,
+		s.summaryInsertStmt,
+		s.summaryLoadStmt,
+		s.summaryLoadForUpdateStmt,
+		s.summaryLoadListStmt,
+		s.metadataSaveStmt,
+		s.metadataSeedStmt,
+		s.metadataLoadStmt,
+		s.metadataLoadListStmt,
 	} {
 		if stmt != nil {
 			stmt.Close()
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ddsketch"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+// summaryArg encodes a summary as a jsonb statement argument.
+func summaryArg(sketch *ddsketch.Sketch) (string, error) {
+	data, err := json.Marshal(sketch)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func summaryFromColumn(data []byte) (*ddsketch.Sketch, error) {
+	var sketch ddsketch.Sketch
+	if err := json.Unmarshal(data, &sketch); err != nil {
+		return nil, err
+	}
+
+	return &sketch, nil
+}
+
+// incrSummary merges the summary into the stored one. The stored row is
+// locked until tx ends, so that concurrent merges don't lose values.
+func (s *MetricStorage) incrSummary(
+	ctx context.Context,
+	tx *sql.Tx,
+	id model.MetricName,
+	labels string,
+	sketch *ddsketch.Sketch,
+) error {
+	value, err := summaryArg(sketch)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.StmtContext(ctx, s.summaryInsertStmt).ExecContext(ctx, id, labels, value)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if inserted > 0 {
+		return nil
+	}
+
+	var data []byte
+	row := tx.StmtContext(ctx, s.summaryLoadForUpdateStmt).QueryRowContext(ctx, id, labels)
+	if err := row.Scan(&data); err != nil {
+		return err
+	}
+
+	stored, err := summaryFromColumn(data)
+	if err != nil {
+		return err
+	}
+
+	if err := stored.Merge(*sketch); err != nil {
+		return err
+	}
+
+	if value, err = summaryArg(stored); err != nil {
+		return err
+	}
+
+	_, err = tx.StmtContext(ctx, s.summarySaveStmt).ExecContext(ctx, id, labels, value)
+	return err
+}
+
+func (s *MetricStorage) loadSummaryMetricList(
+	ctx context.Context,
+	tx *sql.Tx,
+) ([]model.Metric, error) {
+	txStmt := tx.StmtContext(ctx, s.summaryLoadListStmt)
+	rows, err := txStmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := make([]model.Metric, 0, 50)
+
+	for rows.Next() {
+		metric := model.Metric{MType: model.MetricTypeSummary}
+		var labels, value []byte
+		if err := rows.Scan(&metric.ID, &labels, &value); err != nil {
+			return nil, err
+		}
+		if metric.Labels, err = labelsFromColumn(labels); err != nil {
+			return nil, err
+		}
+		if metric.Summary, err = summaryFromColumn(value); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
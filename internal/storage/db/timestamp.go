@@ -0,0 +1,11 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// timestampArg encodes a metric timestamp as a statement argument. A missing
+// timestamp is stored as NULL.
+func timestampArg(ts int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: ts, Valid: ts != 0}
+}
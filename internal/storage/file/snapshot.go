@@ -0,0 +1,169 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// snapshotVersion is the version of the snapshot format. Snapshots written
+// before metadata was added hold the metrics only and have no version.
+const snapshotVersion = 1
+
+// snapshot holds the Seq of the last WAL record it covers, so that records
+// left in the log by a crash before the log was truncated aren't applied
+// twice.
+type snapshot struct {
+	Version  int           `json:"version"`
+	WALSeq   uint64        `json:"wal_seq,omitempty"`
+	Metrics  metricsMapMap `json:"metrics"`
+	Metadata metadataMap   `json:"metadata"`
+}
+
+func backupName(name string, n int) string {
+	return fmt.Sprintf("%s.%d", name, n)
+}
+
+// writeSnapshot atomically replaces the snapshot file: the data is written
+// to a temporary file in the same directory, fsynced and renamed into place.
+// Up to backups previous snapshots are kept as name.1 (the newest) ... name.N.
+func writeSnapshot(name string, backups int, v interface{}) (err error) {
+	dir := filepath.Dir(name)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := json.NewEncoder(tmp).Encode(v); err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	if err := tmp.Chmod(0644); err != nil {
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := rotateSnapshots(name, backups); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+func rotateSnapshots(name string, backups int) error {
+	if backups <= 0 {
+		return nil
+	}
+
+	for n := backups - 1; n >= 1; n-- {
+		err := os.Rename(backupName(name, n), backupName(name, n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	err := os.Rename(name, backupName(name, 1))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// readSnapshot restores the newest valid snapshot, falling back from the
+// snapshot file to its backups. Missing files are skipped; if none of the
+// files exist, the storage starts empty.
+func readSnapshot(name string, backups int) (*snapshot, error) {
+	var lastErr error
+
+	for n := 0; n <= backups; n++ {
+		candidate := name
+		if n > 0 {
+			candidate = backupName(name, n)
+		}
+
+		snap, err := decodeSnapshot(candidate)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			log.Printf("failed to restore snapshot %s: %v", candidate, err)
+			lastErr = err
+			continue
+		}
+
+		if lastErr != nil {
+			log.Printf("restored an older snapshot %s", candidate)
+		}
+
+		return snap, nil
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+
+	return &snapshot{Metrics: make(metricsMapMap), Metadata: make(metadataMap)}, nil
+}
+
+func decodeSnapshot(name string) (*snapshot, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, snap); err != nil {
+			return nil, err
+		}
+
+		if snap.Version == 0 {
+			snap.Metrics = nil
+			if err := json.Unmarshal(data, &snap.Metrics); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if snap.Metrics == nil {
+		snap.Metrics = make(metricsMapMap)
+	}
+	if snap.Metadata == nil {
+		snap.Metadata = make(metadataMap)
+	}
+
+	return snap, nil
+}
@@ -0,0 +1,124 @@
+package file
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func newTestSnapshotConfig(t *testing.T) Config {
+	return Config{
+		InitStore:    true,
+		StoreFile:    filepath.Join(t.TempDir(), "metrics.json"),
+		StoreBackups: 2,
+	}
+}
+
+func flushTestGauge(t *testing.T, cfg Config, value model.Gauge) {
+	ctx := context.Background()
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.SaveMetric(ctx, model.MetricFromGauge("metric1", value)))
+	require.NoError(t, s.Flush(ctx))
+}
+
+func TestSnapshot_Rotation(t *testing.T) {
+	cfg := newTestSnapshotConfig(t)
+
+	for i := 1; i <= 4; i++ {
+		flushTestGauge(t, cfg, model.Gauge(i))
+	}
+
+	for _, name := range []string{cfg.StoreFile, backupName(cfg.StoreFile, 1), backupName(cfg.StoreFile, 2)} {
+		_, err := os.Stat(name)
+		assert.NoError(t, err)
+	}
+
+	_, err := os.Stat(backupName(cfg.StoreFile, 3))
+	assert.True(t, os.IsNotExist(err))
+
+	matches, err := filepath.Glob(cfg.StoreFile + ".tmp-*")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestSnapshot_FallbackToBackup(t *testing.T) {
+	cfg := newTestSnapshotConfig(t)
+
+	flushTestGauge(t, cfg, model.Gauge(1))
+	flushTestGauge(t, cfg, model.Gauge(2))
+
+	require.NoError(t, os.WriteFile(cfg.StoreFile, []byte(`{"gauge":{"metr`), 0644))
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	gauge := loadTestMetric(t, s, model.Metric{ID: "metric1", MType: model.MetricTypeGauge})
+	assert.Equal(t, model.Gauge(1), *gauge.Value)
+}
+
+func TestSnapshot_NoValidSnapshot(t *testing.T) {
+	cfg := newTestSnapshotConfig(t)
+
+	require.NoError(t, os.WriteFile(cfg.StoreFile, []byte(`{"gauge":{"metr`), 0644))
+
+	_, err := NewMetricStorage(cfg)
+	assert.Error(t, err)
+}
+
+func TestSnapshot_EncodeError(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestSnapshotConfig(t)
+
+	flushTestGauge(t, cfg, model.Gauge(1))
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// The server rejects non-finite gauges; one is stored directly here only
+	// to make the encoding fail, so that a failed write is seen to keep the
+	// previous snapshot.
+	require.NoError(t, s.SaveMetric(ctx, model.MetricFromGauge("metric1", model.Gauge(math.NaN()))))
+	assert.Error(t, s.Flush(ctx))
+
+	restored, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	gauge := loadTestMetric(t, restored, model.Metric{ID: "metric1", MType: model.MetricTypeGauge})
+	assert.Equal(t, model.Gauge(1), *gauge.Value)
+
+	matches, err := filepath.Glob(cfg.StoreFile + ".tmp-*")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestSnapshot_LegacyFormat(t *testing.T) {
+	cfg := newTestSnapshotConfig(t)
+
+	legacy := `{"gauge":{"metric1":{"id":"metric1","type":"gauge","value":1.5}}}`
+	require.NoError(t, os.WriteFile(cfg.StoreFile, []byte(legacy), 0644))
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	gauge := loadTestMetric(t, s, model.Metric{ID: "metric1", MType: model.MetricTypeGauge})
+	assert.Equal(t, model.Gauge(1.5), *gauge.Value)
+
+	list, err := s.LoadMetadataList(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
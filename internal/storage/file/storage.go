@@ -2,43 +2,82 @@ package file
 
 import (
 	"context"
-	"encoding/json"
-	"io"
-	"os"
+	"fmt"
+	"log"
 	"sync"
+	"time"
 
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
 )
 
 type Config struct {
-	InitStore bool   `env:"RESTORE"`
-	StoreFile string `env:"STORE_FILE"`
+	InitStore       bool          `env:"RESTORE"`
+	StoreFile       string        `env:"STORE_FILE"`
+	StoreBackups    int           `env:"STORE_BACKUPS"`
+	WALFile         string        `env:"WAL_FILE"`
+	WALSyncPolicy   WALSyncPolicy `env:"WAL_SYNC_POLICY"`
+	WALSyncInterval time.Duration `env:"WAL_SYNC_INTERVAL"`
 }
 
-type metricsMap map[model.MetricName]model.Metric
+func (c Config) Validate() error {
+	if c.StoreBackups < 0 {
+		return fmt.Errorf("invalid negative StoreBackups=%v", c.StoreBackups)
+	}
+	if c.WALFile == "" {
+		return nil
+	}
+	if err := c.WALSyncPolicy.Validate(); err != nil {
+		return err
+	}
+	if c.WALSyncPolicy == WALSyncInterval && c.WALSyncInterval <= 0 {
+		return fmt.Errorf("invalid non-positive WALSyncInterval=%v", c.WALSyncInterval)
+	}
+	return nil
+}
+
+// metricsMap is keyed by model.Metric.Key, so that metrics with the same ID
+// but different labels are stored separately.
+type metricsMap map[string]model.Metric
 type metricsMapMap map[model.MetricType]metricsMap
 
+type metadataMap map[model.MetricName]model.Metadata
+
 type MetricStorage struct {
 	sync.RWMutex
 
-	config  Config
-	metrics metricsMapMap
+	config   Config
+	metrics  metricsMapMap
+	metadata metadataMap
+
+	wal       *wal
+	stopWAL   chan struct{}
+	walSyncWG sync.WaitGroup
 }
 
 func NewMetricStorage(config Config) (*MetricStorage, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	storage := &MetricStorage{
-		config:  config,
-		metrics: make(metricsMapMap),
+		config:   config,
+		metrics:  make(metricsMapMap),
+		metadata: make(metadataMap),
 	}
 
+	var walSeq uint64
 	if config.InitStore {
-		file, err := os.OpenFile(config.StoreFile, os.O_RDONLY|os.O_CREATE, 0644)
+		snap, err := readSnapshot(config.StoreFile, config.StoreBackups)
 		if err != nil {
 			return nil, err
 		}
-		defer file.Close()
+		storage.metrics = snap.Metrics
+		storage.metadata = snap.Metadata
+		walSeq = snap.WALSeq
+	}
 
-		if err := json.NewDecoder(file).Decode(&storage.metrics); err != nil && err != io.EOF {
+	if config.WALFile != "" {
+		if err := storage.openWAL(walSeq); err != nil {
 			return nil, err
 		}
 	}
@@ -46,6 +85,85 @@ func NewMetricStorage(config Config) (*MetricStorage, error) {
 	return storage, nil
 }
 
+// openWAL opens the write-ahead log and replays the records after walSeq on
+// top of the restored snapshot. Without a restore the log is stale and gets
+// discarded.
+func (s *MetricStorage) openWAL(walSeq uint64) error {
+	w, err := openWAL(s.config.WALFile, s.config.WALSyncPolicy)
+	if err != nil {
+		return err
+	}
+
+	if s.config.InitStore {
+		err = w.replay(walSeq, s.applyWALRecord)
+	} else {
+		err = w.truncate()
+	}
+	if err != nil {
+		w.close()
+		return err
+	}
+
+	s.wal = w
+
+	if s.config.WALSyncPolicy == WALSyncInterval {
+		s.stopWAL = make(chan struct{})
+		s.walSyncWG.Add(1)
+		go s.syncWAL()
+	}
+
+	return nil
+}
+
+func (s *MetricStorage) applyWALRecord(record walRecord) error {
+	switch record.Op {
+	case walOpSave:
+		return s.saveMetric(context.Background(), record.Metric)
+	case walOpIncr:
+		return s.incrMetric(context.Background(), record.Metric)
+	case walOpIncrList:
+		for _, metric := range record.Metrics {
+			if err := s.incrMetric(context.Background(), metric); err != nil {
+				return err
+			}
+		}
+		return nil
+	case walOpMetadata:
+		if record.Metadata == nil {
+			return fmt.Errorf("missing metadata in WAL op: %s", record.Op)
+		}
+		s.saveMetadata(*record.Metadata)
+		return nil
+	default:
+		return fmt.Errorf("unknown WAL op: %s", record.Op)
+	}
+}
+
+func (s *MetricStorage) syncWAL() {
+	defer s.walSyncWG.Done()
+
+	ticker := time.NewTicker(s.config.WALSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopWAL:
+			return
+		case <-ticker.C:
+			if err := s.wal.sync(); err != nil {
+				log.Printf("failed to sync WAL: %v", err)
+			}
+		}
+	}
+}
+
+func (s *MetricStorage) appendWAL(record walRecord) error {
+	if s.wal == nil {
+		return nil
+	}
+	return s.wal.append(record)
+}
+
 func (s *MetricStorage) saveMetric(ctx context.Context, metric model.Metric) error {
 	metrics, ok := s.metrics[metric.MType]
 	if !ok {
@@ -53,7 +171,7 @@ func (s *MetricStorage) saveMetric(ctx context.Context, metric model.Metric) err
 		s.metrics[metric.MType] = metrics
 	}
 
-	metrics[metric.ID] = metric
+	metrics[metric.Key()] = metric
 
 	return nil
 }
@@ -62,36 +180,117 @@ func (s *MetricStorage) SaveMetric(ctx context.Context, metric model.Metric) err
 	s.Lock()
 	defer s.Unlock()
 
+	// Out-of-order writes, e.g. late retries, are ignored.
+	stored, err := s.loadMetric(ctx, metric)
+	if err != nil {
+		return err
+	}
+	if stored != nil && !metric.Supersedes(*stored) {
+		return nil
+	}
+
+	if err := s.appendWAL(walRecord{Op: walOpSave, Metric: metric}); err != nil {
+		return err
+	}
+
 	return s.saveMetric(ctx, metric)
 }
 
 func (s *MetricStorage) IncrMetric(ctx context.Context, metric model.Metric) error {
-	s.Lock()
-	defer s.Unlock()
+	return s.IncrMetricList(ctx, []model.Metric{metric})
+}
+
+// checkIncr rejects a batch with histograms or summaries that can't be
+// merged into the stored ones, or into the earlier ones of the batch, before
+// anything is logged, as they would fail the WAL replay and leave the batch
+// half applied.
+func (s *MetricStorage) checkIncr(ctx context.Context, metrics []model.Metric) error {
+	merged := make(map[string]model.Metric)
+
+	for _, metric := range metrics {
+		if metric.Histogram == nil && metric.Summary == nil {
+			continue
+		}
 
+		key := string(metric.MType) + metric.Key()
+		m, ok := merged[key]
+		if !ok {
+			stored, err := s.loadMetric(ctx, metric)
+			if err != nil {
+				return err
+			}
+			if stored == nil {
+				merged[key] = metric
+				continue
+			}
+			m = *stored
+		}
+
+		m, err := mergeMetric(m, metric)
+		if err != nil {
+			return err
+		}
+		merged[key] = m
+	}
+
+	return nil
+}
+
+func (s *MetricStorage) incrMetric(ctx context.Context, metric model.Metric) error {
 	m, err := s.loadMetric(ctx, metric)
 	if err != nil {
 		return err
 	}
 
 	if m != nil {
-		if metric.Value != nil {
-			*metric.Value += *m.Value
-		}
-		if metric.Delta != nil {
-			*metric.Delta += *m.Delta
+		if metric, err = mergeMetric(*m, metric); err != nil {
+			return err
 		}
 	}
 
 	return s.saveMetric(ctx, metric)
 }
 
+// mergeMetric adds the metric to the stored one. The sums are kept in new
+// values, so that the caller's metric keeps its delta. The latest timestamp
+// is kept.
+func mergeMetric(stored, metric model.Metric) (model.Metric, error) {
+	if stored.Timestamp > metric.Timestamp {
+		metric.Timestamp = stored.Timestamp
+	}
+
+	if metric.Value != nil {
+		value := *metric.Value + *stored.Value
+		metric.Value = &value
+	}
+	if metric.Delta != nil {
+		delta := *metric.Delta + *stored.Delta
+		metric.Delta = &delta
+	}
+	if metric.Histogram != nil {
+		merged := stored.Histogram.Clone()
+		if err := merged.Merge(*metric.Histogram); err != nil {
+			return model.Metric{}, err
+		}
+		metric.Histogram = &merged
+	}
+	if metric.Summary != nil {
+		merged := stored.Summary.Clone()
+		if err := merged.Merge(*metric.Summary); err != nil {
+			return model.Metric{}, err
+		}
+		metric.Summary = &merged
+	}
+
+	return metric, nil
+}
+
 func (s *MetricStorage) loadMetric(
 	ctx context.Context,
 	metric model.Metric,
 ) (*model.Metric, error) {
 	if metrics, ok := s.metrics[metric.MType]; ok {
-		if m, ok := metrics[metric.ID]; ok {
+		if m, ok := metrics[metric.Key()]; ok {
 			return &m, nil
 		}
 	}
@@ -127,11 +326,29 @@ func (s *MetricStorage) SaveMetricList(ctx context.Context, metrics []model.Metr
 }
 
 func (s *MetricStorage) IncrMetricList(ctx context.Context, metrics []model.Metric) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	if err := s.checkIncr(ctx, metrics); err != nil {
+		return err
+	}
+
+	// The batch is logged as one record before any of it is applied, so a
+	// failed write leaves nothing applied and a retry isn't counted twice.
+	if err := s.appendWAL(walRecord{Op: walOpIncrList, Metrics: metrics}); err != nil {
+		return err
+	}
+
 	for _, metric := range metrics {
-		if err := s.IncrMetric(ctx, metric); err != nil {
+		if err := s.incrMetric(ctx, metric); err != nil {
 			return err
 		}
 	}
+
 	return nil
 }
 
@@ -150,24 +367,108 @@ func (s *MetricStorage) LoadMetricList(ctx context.Context) ([]model.Metric, err
 	return metrics, nil
 }
 
-func (s *MetricStorage) Flush(ctx context.Context) error {
-	file, err := os.OpenFile(s.config.StoreFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
+func (s *MetricStorage) saveMetadata(metadata model.Metadata) {
+	if stored, ok := s.metadata[metadata.ID]; ok {
+		metadata = stored.Merge(metadata)
+	}
+	s.metadata[metadata.ID] = metadata
+}
+
+func (s *MetricStorage) SaveMetadata(ctx context.Context, metadata model.Metadata) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.appendWAL(walRecord{Op: walOpMetadata, Metadata: &metadata}); err != nil {
+		return err
+	}
+
+	s.saveMetadata(metadata)
+
+	return nil
+}
+
+func (s *MetricStorage) SeedMetadata(ctx context.Context, metadata model.Metadata) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.metadata[metadata.ID]; ok {
+		return nil
+	}
+
+	// The metric has no metadata at this point of the WAL either, so the
+	// record is replayed as a plain save.
+	if err := s.appendWAL(walRecord{Op: walOpMetadata, Metadata: &metadata}); err != nil {
 		return err
 	}
-	defer file.Close()
 
+	s.saveMetadata(metadata)
+
+	return nil
+}
+
+func (s *MetricStorage) LoadMetadata(ctx context.Context, id model.MetricName) (*model.Metadata, error) {
 	s.RLock()
 	defer s.RUnlock()
 
-	if err := json.NewEncoder(file).Encode(&s.metrics); err != nil {
-		return nil
+	if metadata, ok := s.metadata[id]; ok {
+		return &metadata, nil
+	}
+
+	return nil, nil
+}
+
+func (s *MetricStorage) LoadMetadataList(ctx context.Context) ([]model.Metadata, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	list := make([]model.Metadata, 0, len(s.metadata))
+	for _, metadata := range s.metadata {
+		list = append(list, metadata)
+	}
+
+	return list, nil
+}
+
+func (s *MetricStorage) snapshot() *snapshot {
+	snap := &snapshot{
+		Version:  snapshotVersion,
+		Metrics:  s.metrics,
+		Metadata: s.metadata,
+	}
+	if s.wal != nil {
+		snap.WALSeq = s.wal.lastSeq()
+	}
+	return snap
+}
+
+func (s *MetricStorage) Flush(ctx context.Context) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := writeSnapshot(s.config.StoreFile, s.config.StoreBackups, s.snapshot()); err != nil {
+		return err
+	}
+
+	if s.wal != nil {
+		return s.wal.truncate()
 	}
 
 	return nil
 }
 
 func (s *MetricStorage) Close() {
+	if s.wal == nil {
+		return
+	}
+
+	if s.stopWAL != nil {
+		close(s.stopWAL)
+		s.walSyncWG.Wait()
+	}
+
+	if err := s.wal.close(); err != nil {
+		log.Printf("failed to close WAL: %v", err)
+	}
 }
 
 func (s *MetricStorage) Heartbeat(ctx context.Context) error {
@@ -0,0 +1,217 @@
+package file
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/ddsketch"
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func TestMetricStorage_IncrMetric(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := NewMetricStorage(newTestWALConfig(t))
+	require.NoError(t, err)
+	defer s.Close()
+
+	counter := model.MetricFromCounter("metric1", model.Counter(2))
+	require.NoError(t, s.IncrMetric(ctx, counter))
+	require.NoError(t, s.IncrMetric(ctx, counter))
+
+	// The caller's delta isn't replaced by the sum.
+	assert.Equal(t, model.Counter(2), *counter.Delta)
+	m := loadTestMetric(t, s, model.Metric{ID: "metric1", MType: model.MetricTypeCounter})
+	assert.Equal(t, model.Counter(4), *m.Delta)
+}
+
+func TestMetricStorage_SaveOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := NewMetricStorage(newTestWALConfig(t))
+	require.NoError(t, err)
+	defer s.Close()
+
+	gauge := func(value float64, ts int64) model.Metric {
+		m := model.MetricFromGauge("metric1", model.Gauge(value))
+		m.Timestamp = ts
+		return m
+	}
+	key := model.Metric{ID: "metric1", MType: model.MetricTypeGauge}
+
+	require.NoError(t, s.SaveMetric(ctx, gauge(2, 2000)))
+
+	// A late retry is ignored.
+	require.NoError(t, s.SaveMetric(ctx, gauge(1, 1000)))
+	assert.Equal(t, gauge(2, 2000), *loadTestMetric(t, s, key))
+
+	require.NoError(t, s.SaveMetricList(ctx, []model.Metric{gauge(3, 3000), gauge(1, 1000)}))
+	assert.Equal(t, gauge(3, 3000), *loadTestMetric(t, s, key))
+
+	// Metrics without timestamps are always accepted.
+	require.NoError(t, s.SaveMetric(ctx, gauge(4, 0)))
+	assert.Equal(t, gauge(4, 0), *loadTestMetric(t, s, key))
+}
+
+func TestMetricStorage_IncrHistogram(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestWALConfig(t)
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+
+	h := model.NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	metric := model.MetricFromHistogram("latency", h)
+
+	require.NoError(t, s.IncrMetric(ctx, metric))
+	require.NoError(t, s.IncrMetric(ctx, metric))
+
+	other := model.MetricFromHistogram("latency", model.NewHistogram([]float64{1}))
+	assert.ErrorIs(t, s.IncrMetric(ctx, other), model.ErrHistogramBoundsMismatch)
+
+	// The rejected histogram isn't logged, so the WAL is replayed.
+	s.Close()
+	s, err = NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	m := loadTestMetric(t, s, model.Metric{ID: "latency", MType: model.MetricTypeHistogram})
+	assert.Equal(t, &model.Histogram{
+		Bounds: []float64{0.1, 1},
+		Counts: []uint64{2, 2, 0},
+		Count:  4,
+		Sum:    1.1,
+	}, m.Histogram)
+	assert.Equal(t, []uint64{1, 1, 0}, metric.Histogram.Counts)
+}
+
+func TestMetricStorage_IncrMetricListMismatch(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestWALConfig(t)
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+
+	counter := model.MetricFromCounter("requests", model.Counter(1))
+	latency := model.MetricFromHistogram("latency", model.NewHistogram([]float64{0.1, 1}))
+	other := model.MetricFromHistogram("latency", model.NewHistogram([]float64{1}))
+
+	assertNotStored := func(metric model.Metric) {
+		m, err := s.LoadMetric(ctx, metric)
+		require.NoError(t, err)
+		assert.Nil(t, m)
+	}
+
+	// The mismatch is within the batch, so nothing is applied.
+	err = s.IncrMetricList(ctx, []model.Metric{counter, latency, other})
+	assert.ErrorIs(t, err, model.ErrHistogramBoundsMismatch)
+	assertNotStored(counter)
+	assertNotStored(latency)
+
+	// Nor is anything logged.
+	s.Close()
+	s, err = NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	assertNotStored(counter)
+	assertNotStored(latency)
+}
+
+func TestMetricStorage_IncrSummary(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestWALConfig(t)
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+
+	sketch, err := ddsketch.NewSketch(ddsketch.DefaultRelativeAccuracy)
+	require.NoError(t, err)
+	require.NoError(t, sketch.Add(1))
+	require.NoError(t, sketch.Add(100))
+	metric := model.MetricFromSummary("latency", *sketch)
+
+	require.NoError(t, s.IncrMetric(ctx, metric))
+	require.NoError(t, s.IncrMetric(ctx, metric))
+
+	other, err := ddsketch.NewSketch(0.05)
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.IncrMetric(ctx, model.MetricFromSummary("latency", *other)), ddsketch.ErrAccuracyMismatch)
+
+	// The rejected summary isn't logged, so the WAL is replayed.
+	s.Close()
+	s, err = NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	m := loadTestMetric(t, s, model.Metric{ID: "latency", MType: model.MetricTypeSummary})
+	assert.Equal(t, uint64(4), m.Summary.Count)
+	assert.Equal(t, 202.0, m.Summary.Sum)
+	assert.Equal(t, uint64(2), metric.Summary.Count)
+
+	q, err := m.Summary.Quantile(1)
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, q)
+}
+
+func TestMetricStorage_Metadata(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestWALConfig(t)
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, s.SaveMetadata(ctx, model.Metadata{ID: "Alloc", Unit: "bytes", Owner: "runtime"}))
+	require.NoError(t, s.Flush(ctx))
+	require.NoError(t, s.SaveMetadata(ctx, model.Metadata{ID: "Alloc", Owner: "platform"}))
+	require.NoError(t, s.SaveMetadata(ctx, model.Metadata{ID: "PollCount", Description: "Number of polls."}))
+
+	// The metadata is restored from the snapshot and the WAL.
+	s.Close()
+	s, err = NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	metadata, err := s.LoadMetadata(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, &model.Metadata{ID: "Alloc", Unit: "bytes", Owner: "platform"}, metadata)
+
+	metadata, err = s.LoadMetadata(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+
+	list, err := s.LoadMetadataList(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+}
+
+func TestMetricStorage_SeedMetadata(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestWALConfig(t)
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, s.SaveMetadata(ctx, model.Metadata{ID: "Alloc", Unit: "KiB"}))
+	require.NoError(t, s.SeedMetadata(ctx, model.Metadata{ID: "Alloc", Unit: "bytes", Owner: "agent/memstats"}))
+	require.NoError(t, s.SeedMetadata(ctx, model.Metadata{ID: "PollCount", Unit: "polls"}))
+
+	// Seeding keeps the stored metadata, also after the WAL is replayed.
+	s.Close()
+	s, err = NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	metadata, err := s.LoadMetadata(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, &model.Metadata{ID: "Alloc", Unit: "KiB"}, metadata)
+
+	metadata, err = s.LoadMetadata(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, &model.Metadata{ID: "PollCount", Unit: "polls"}, metadata)
+}
@@ -0,0 +1,196 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+type WALSyncPolicy string
+
+const (
+	// WALSyncAlways fsyncs the log after every record.
+	WALSyncAlways WALSyncPolicy = "always"
+	// WALSyncInterval fsyncs the log periodically, every WALSyncInterval.
+	WALSyncInterval WALSyncPolicy = "interval"
+	// WALSyncNever leaves flushing the log to the operating system.
+	WALSyncNever WALSyncPolicy = "never"
+)
+
+func (p WALSyncPolicy) Validate() error {
+	switch p {
+	case WALSyncAlways, WALSyncInterval, WALSyncNever:
+		return nil
+	default:
+		return fmt.Errorf("unknown WALSyncPolicy: %s", p)
+	}
+}
+
+type walOp string
+
+const (
+	walOpSave     walOp = "save"
+	walOpIncr     walOp = "incr"
+	walOpIncrList walOp = "incr_list"
+	walOpMetadata walOp = "metadata"
+)
+
+// walRecord holds the Metric of a save or an incr, the Metrics of an incr
+// batch and the Metadata of a metadata record. A batch is a single record,
+// so that it is replayed either whole or not at all. Seq numbers the
+// records, so that the ones already covered by a snapshot are skipped on
+// replay. Records written before Seq was added have a zero Seq and are
+// always replayed.
+type walRecord struct {
+	Seq      uint64          `json:"seq,omitempty"`
+	Op       walOp           `json:"op"`
+	Metric   model.Metric    `json:"metric"`
+	Metrics  []model.Metric  `json:"metrics,omitempty"`
+	Metadata *model.Metadata `json:"metadata,omitempty"`
+}
+
+// wal is an append-only log of metric updates made since the last snapshot.
+// Records are stored as JSON lines.
+type wal struct {
+	sync.Mutex
+
+	file   *os.File
+	policy WALSyncPolicy
+	dirty  bool
+	// seq is the Seq of the last record appended or replayed. It isn't reset
+	// on truncate.
+	seq uint64
+}
+
+func openWAL(name string, policy WALSyncPolicy) (*wal, error) {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wal{
+		file:   file,
+		policy: policy,
+	}, nil
+}
+
+// replay applies every complete record of the log with a Seq after the given
+// one. A torn record at the tail, left by a crash in the middle of a write, is
+// discarded.
+func (w *wal) replay(after uint64, apply func(record walRecord) error) error {
+	w.Lock()
+	defer w.Unlock()
+
+	w.seq = after
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(w.file)
+	offset := int64(0)
+
+	for {
+		var record walRecord
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			log.Printf("discarding a torn WAL tail at offset %d: %v", offset, err)
+			return w.file.Truncate(offset)
+		}
+
+		// Records covered by the snapshot were logged before a crash
+		// between writing the snapshot and truncating the log.
+		if record.Seq == 0 || record.Seq > after {
+			if err := apply(record); err != nil {
+				return err
+			}
+		}
+		if record.Seq > w.seq {
+			w.seq = record.Seq
+		}
+		offset = dec.InputOffset()
+	}
+}
+
+func (w *wal) append(record walRecord) error {
+	w.Lock()
+	defer w.Unlock()
+
+	record.Seq = w.seq + 1
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	w.seq = record.Seq
+
+	if w.policy == WALSyncAlways {
+		return w.file.Sync()
+	}
+
+	w.dirty = true
+
+	return nil
+}
+
+// lastSeq returns the Seq of the last record.
+func (w *wal) lastSeq() uint64 {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.seq
+}
+
+func (w *wal) sync() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if !w.dirty {
+		return nil
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.dirty = false
+
+	return nil
+}
+
+// truncate compacts the log once its records are covered by a snapshot.
+func (w *wal) truncate() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	w.dirty = false
+
+	return w.file.Sync()
+}
+
+func (w *wal) close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
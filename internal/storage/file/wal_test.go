@@ -0,0 +1,175 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
+)
+
+func newTestWALConfig(t *testing.T) Config {
+	dir := t.TempDir()
+	return Config{
+		InitStore:     true,
+		StoreFile:     filepath.Join(dir, "metrics.json"),
+		WALFile:       filepath.Join(dir, "metrics.wal"),
+		WALSyncPolicy: WALSyncAlways,
+	}
+}
+
+func loadTestMetric(t *testing.T, s *MetricStorage, metric model.Metric) *model.Metric {
+	m, err := s.LoadMetric(context.Background(), metric)
+	require.NoError(t, err)
+	require.NotNil(t, m)
+	return m
+}
+
+func TestWAL_Replay(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestWALConfig(t)
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, s.SaveMetric(ctx, model.MetricFromGauge("metric1", model.Gauge(1.5))))
+	require.NoError(t, s.IncrMetric(ctx, model.MetricFromCounter("metric2", model.Counter(2))))
+	require.NoError(t, s.Flush(ctx))
+	require.NoError(t, s.IncrMetric(ctx, model.MetricFromCounter("metric2", model.Counter(3))))
+	require.NoError(t, s.SaveMetric(ctx, model.MetricFromGauge("metric1", model.Gauge(2.5))))
+
+	// Simulate a crash: the storage isn't flushed before being reopened.
+	s.Close()
+
+	s, err = NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	gauge := loadTestMetric(t, s, model.Metric{ID: "metric1", MType: model.MetricTypeGauge})
+	assert.Equal(t, model.Gauge(2.5), *gauge.Value)
+
+	counter := loadTestMetric(t, s, model.Metric{ID: "metric2", MType: model.MetricTypeCounter})
+	assert.Equal(t, model.Counter(5), *counter.Delta)
+}
+
+func TestWAL_CrashBeforeTruncate(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestWALConfig(t)
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, s.IncrMetric(ctx, model.MetricFromCounter("metric1", model.Counter(2))))
+	require.NoError(t, s.Flush(ctx))
+	require.NoError(t, s.IncrMetric(ctx, model.MetricFromCounter("metric1", model.Counter(3))))
+
+	// Simulate a crash after the snapshot is written but before the WAL is
+	// truncated.
+	require.NoError(t, writeSnapshot(cfg.StoreFile, cfg.StoreBackups, s.snapshot()))
+	s.Close()
+
+	s, err = NewMetricStorage(cfg)
+	require.NoError(t, err)
+
+	counter := loadTestMetric(t, s, model.Metric{ID: "metric1", MType: model.MetricTypeCounter})
+	assert.Equal(t, model.Counter(5), *counter.Delta)
+
+	// The numbering continues after the replay, so new records aren't
+	// mistaken for covered ones.
+	require.NoError(t, s.IncrMetric(ctx, model.MetricFromCounter("metric1", model.Counter(1))))
+	s.Close()
+
+	s, err = NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	counter = loadTestMetric(t, s, model.Metric{ID: "metric1", MType: model.MetricTypeCounter})
+	assert.Equal(t, model.Counter(6), *counter.Delta)
+}
+
+func TestWAL_CompactOnFlush(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestWALConfig(t)
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.IncrMetric(ctx, model.MetricFromCounter("metric1", model.Counter(1))))
+
+	info, err := os.Stat(cfg.WALFile)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Size())
+
+	require.NoError(t, s.Flush(ctx))
+
+	info, err = os.Stat(cfg.WALFile)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+}
+
+func TestWAL_TornTail(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestWALConfig(t)
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+	require.NoError(t, s.IncrMetric(ctx, model.MetricFromCounter("metric1", model.Counter(1))))
+	s.Close()
+
+	f, err := os.OpenFile(cfg.WALFile, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"incr","metric":{"id":"metr`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = NewMetricStorage(cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, s.IncrMetric(ctx, model.MetricFromCounter("metric1", model.Counter(2))))
+
+	counter := loadTestMetric(t, s, model.Metric{ID: "metric1", MType: model.MetricTypeCounter})
+	assert.Equal(t, model.Counter(3), *counter.Delta)
+	s.Close()
+
+	s, err = NewMetricStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	counter = loadTestMetric(t, s, model.Metric{ID: "metric1", MType: model.MetricTypeCounter})
+	assert.Equal(t, model.Counter(3), *counter.Delta)
+}
+
+func TestWAL_IncrMetricList(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestWALConfig(t)
+
+	s, err := NewMetricStorage(cfg)
+	require.NoError(t, err)
+
+	batch := []model.Metric{
+		model.MetricFromCounter("metric1", model.Counter(1)),
+		model.MetricFromCounter("metric2", model.Counter(2)),
+	}
+	require.NoError(t, s.IncrMetricList(ctx, batch))
+	s.Close()
+
+	s, err = NewMetricStorage(cfg)
+	require.NoError(t, err)
+
+	counter := loadTestMetric(t, s, model.Metric{ID: "metric2", MType: model.MetricTypeCounter})
+	assert.Equal(t, model.Counter(2), *counter.Delta)
+
+	// A batch that can't be logged leaves nothing applied.
+	require.NoError(t, s.wal.file.Close())
+	assert.Error(t, s.IncrMetricList(ctx, batch))
+
+	counter = loadTestMetric(t, s, model.Metric{ID: "metric1", MType: model.MetricTypeCounter})
+	assert.Equal(t, model.Counter(1), *counter.Delta)
+	counter = loadTestMetric(t, s, model.Metric{ID: "metric2", MType: model.MetricTypeCounter})
+	assert.Equal(t, model.Counter(2), *counter.Delta)
+}
@@ -3,11 +3,14 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
 )
 
 type MetricStorage interface {
+	// SaveMetric ignores a metric sampled earlier than the stored one, see
+	// model.Metric.Supersedes.
 	SaveMetric(ctx context.Context, metric model.Metric) error
 	IncrMetric(ctx context.Context, metric model.Metric) error
 	LoadMetric(ctx context.Context, metric model.Metric) (*model.Metric, error)
@@ -21,3 +24,24 @@ type MetricStorage interface {
 
 	Heartbeat(ctx context.Context) error
 }
+
+// MetadataStorage is implemented by storages that keep metric metadata.
+// SaveMetadata merges the metadata into the stored one, see
+// model.Metadata.Merge. SeedMetadata stores the metadata only if the metric
+// has none, so that it never overwrites values set by operators.
+type MetadataStorage interface {
+	SaveMetadata(ctx context.Context, metadata model.Metadata) error
+	SeedMetadata(ctx context.Context, metadata model.Metadata) error
+	LoadMetadata(ctx context.Context, id model.MetricName) (*model.Metadata, error)
+	LoadMetadataList(ctx context.Context) ([]model.Metadata, error)
+}
+
+// MetricHistoryStorage is implemented by storages that keep timestamped
+// samples of metrics in addition to their latest values.
+type MetricHistoryStorage interface {
+	LoadMetricHistory(
+		ctx context.Context,
+		metric model.Metric,
+		from, to time.Time,
+	) ([]model.Sample, error)
+}
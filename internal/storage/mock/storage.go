@@ -7,6 +7,7 @@ package storagemock
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	model "github.com/ale0x78ey/yandex-practicum-go-developer-devops/internal/model"
 	gomock "github.com/golang/mock/gomock"
@@ -160,3 +161,122 @@ func (mr *MockMetricStorageMockRecorder) SaveMetricList(ctx, metrics interface{}
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveMetricList", reflect.TypeOf((*MockMetricStorage)(nil).SaveMetricList), ctx, metrics)
 }
+
+// MockMetadataStorage is a mock of MetadataStorage interface.
+type MockMetadataStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockMetadataStorageMockRecorder
+}
+
+// MockMetadataStorageMockRecorder is the mock recorder for MockMetadataStorage.
+type MockMetadataStorageMockRecorder struct {
+	mock *MockMetadataStorage
+}
+
+// NewMockMetadataStorage creates a new mock instance.
+func NewMockMetadataStorage(ctrl *gomock.Controller) *MockMetadataStorage {
+	mock := &MockMetadataStorage{ctrl: ctrl}
+	mock.recorder = &MockMetadataStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMetadataStorage) EXPECT() *MockMetadataStorageMockRecorder {
+	return m.recorder
+}
+
+// LoadMetadata mocks base method.
+func (m *MockMetadataStorage) LoadMetadata(ctx context.Context, id model.MetricName) (*model.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoadMetadata", ctx, id)
+	ret0, _ := ret[0].(*model.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoadMetadata indicates an expected call of LoadMetadata.
+func (mr *MockMetadataStorageMockRecorder) LoadMetadata(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadMetadata", reflect.TypeOf((*MockMetadataStorage)(nil).LoadMetadata), ctx, id)
+}
+
+// LoadMetadataList mocks base method.
+func (m *MockMetadataStorage) LoadMetadataList(ctx context.Context) ([]model.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoadMetadataList", ctx)
+	ret0, _ := ret[0].([]model.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoadMetadataList indicates an expected call of LoadMetadataList.
+func (mr *MockMetadataStorageMockRecorder) LoadMetadataList(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadMetadataList", reflect.TypeOf((*MockMetadataStorage)(nil).LoadMetadataList), ctx)
+}
+
+// SaveMetadata mocks base method.
+func (m *MockMetadataStorage) SaveMetadata(ctx context.Context, metadata model.Metadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveMetadata", ctx, metadata)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveMetadata indicates an expected call of SaveMetadata.
+func (mr *MockMetadataStorageMockRecorder) SaveMetadata(ctx, metadata interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveMetadata", reflect.TypeOf((*MockMetadataStorage)(nil).SaveMetadata), ctx, metadata)
+}
+
+// SeedMetadata mocks base method.
+func (m *MockMetadataStorage) SeedMetadata(ctx context.Context, metadata model.Metadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SeedMetadata", ctx, metadata)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SeedMetadata indicates an expected call of SeedMetadata.
+func (mr *MockMetadataStorageMockRecorder) SeedMetadata(ctx, metadata interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SeedMetadata", reflect.TypeOf((*MockMetadataStorage)(nil).SeedMetadata), ctx, metadata)
+}
+
+// MockMetricHistoryStorage is a mock of MetricHistoryStorage interface.
+type MockMetricHistoryStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockMetricHistoryStorageMockRecorder
+}
+
+// MockMetricHistoryStorageMockRecorder is the mock recorder for MockMetricHistoryStorage.
+type MockMetricHistoryStorageMockRecorder struct {
+	mock *MockMetricHistoryStorage
+}
+
+// NewMockMetricHistoryStorage creates a new mock instance.
+func NewMockMetricHistoryStorage(ctrl *gomock.Controller) *MockMetricHistoryStorage {
+	mock := &MockMetricHistoryStorage{ctrl: ctrl}
+	mock.recorder = &MockMetricHistoryStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMetricHistoryStorage) EXPECT() *MockMetricHistoryStorageMockRecorder {
+	return m.recorder
+}
+
+// LoadMetricHistory mocks base method.
+func (m *MockMetricHistoryStorage) LoadMetricHistory(ctx context.Context, metric model.Metric, from, to time.Time) ([]model.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoadMetricHistory", ctx, metric, from, to)
+	ret0, _ := ret[0].([]model.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoadMetricHistory indicates an expected call of LoadMetricHistory.
+func (mr *MockMetricHistoryStorageMockRecorder) LoadMetricHistory(ctx, metric, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadMetricHistory", reflect.TypeOf((*MockMetricHistoryStorage)(nil).LoadMetricHistory), ctx, metric, from, to)
+}
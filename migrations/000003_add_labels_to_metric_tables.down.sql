@@ -0,0 +1,9 @@
+DELETE FROM gauge_metrics WHERE labels <> '{}';
+ALTER TABLE gauge_metrics DROP CONSTRAINT gauge_metrics_id_labels_key;
+ALTER TABLE gauge_metrics DROP COLUMN labels;
+ALTER TABLE gauge_metrics ADD CONSTRAINT gauge_metrics_id_key UNIQUE (id);
+
+DELETE FROM counter_metrics WHERE labels <> '{}';
+ALTER TABLE counter_metrics DROP CONSTRAINT counter_metrics_id_labels_key;
+ALTER TABLE counter_metrics DROP COLUMN labels;
+ALTER TABLE counter_metrics ADD CONSTRAINT counter_metrics_id_key UNIQUE (id);
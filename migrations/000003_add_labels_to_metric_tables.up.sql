@@ -0,0 +1,7 @@
+ALTER TABLE gauge_metrics ADD COLUMN labels jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE gauge_metrics DROP CONSTRAINT gauge_metrics_id_key;
+ALTER TABLE gauge_metrics ADD CONSTRAINT gauge_metrics_id_labels_key UNIQUE (id, labels);
+
+ALTER TABLE counter_metrics ADD COLUMN labels jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE counter_metrics DROP CONSTRAINT counter_metrics_id_key;
+ALTER TABLE counter_metrics ADD CONSTRAINT counter_metrics_id_labels_key UNIQUE (id, labels);
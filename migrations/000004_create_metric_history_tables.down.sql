@@ -0,0 +1,2 @@
+DROP TABLE counter_metrics_history;
+DROP TABLE gauge_metrics_history;
@@ -0,0 +1,15 @@
+CREATE TABLE gauge_metrics_history (
+  id         text NOT NULL,
+  labels     jsonb NOT NULL DEFAULT '{}',
+  value      double precision NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX gauge_metrics_history_id_created_at_idx ON gauge_metrics_history (id, created_at);
+
+CREATE TABLE counter_metrics_history (
+  id         text NOT NULL,
+  labels     jsonb NOT NULL DEFAULT '{}',
+  value      bigint NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX counter_metrics_history_id_created_at_idx ON counter_metrics_history (id, created_at);
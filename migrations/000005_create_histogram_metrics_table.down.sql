@@ -0,0 +1 @@
+DROP TABLE histogram_metrics;
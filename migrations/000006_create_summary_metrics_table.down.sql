@@ -0,0 +1 @@
+DROP TABLE summary_metrics;
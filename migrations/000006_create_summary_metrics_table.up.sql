@@ -0,0 +1,6 @@
+CREATE TABLE summary_metrics (
+  id     text NOT NULL,
+  labels jsonb NOT NULL DEFAULT '{}',
+  value  jsonb NOT NULL,
+  UNIQUE (id, labels)
+);
@@ -0,0 +1 @@
+ALTER TABLE gauge_metrics DROP COLUMN timestamp_ms;
@@ -0,0 +1 @@
+ALTER TABLE gauge_metrics ADD COLUMN timestamp_ms bigint;
@@ -0,0 +1,7 @@
+CREATE TABLE metric_metadata (
+  id          text PRIMARY KEY,
+  unit        text NOT NULL DEFAULT '',
+  description text NOT NULL DEFAULT '',
+  owner       text NOT NULL DEFAULT '',
+  type        text NOT NULL DEFAULT ''
+);
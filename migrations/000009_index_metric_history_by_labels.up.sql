@@ -0,0 +1,7 @@
+DROP INDEX gauge_metrics_history_id_created_at_idx;
+CREATE INDEX gauge_metrics_history_id_labels_created_at_idx ON gauge_metrics_history (id, labels, created_at);
+CREATE INDEX gauge_metrics_history_created_at_idx ON gauge_metrics_history (created_at);
+
+DROP INDEX counter_metrics_history_id_created_at_idx;
+CREATE INDEX counter_metrics_history_id_labels_created_at_idx ON counter_metrics_history (id, labels, created_at);
+CREATE INDEX counter_metrics_history_created_at_idx ON counter_metrics_history (created_at);